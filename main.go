@@ -144,7 +144,9 @@ func main() {
 		close(certsReady)
 	}
 
-	cCache := cache.New(mgr.GetClient(), cache.WithPodsReadyTracking(blockForPodsReady(&cfg)))
+	cCache := cache.New(mgr.GetClient(),
+		cache.WithPodsReadyTracking(blockForPodsReady(&cfg)),
+		cache.WithEventRecorder(mgr.GetEventRecorderFor(constants.KueueName+"-cache")))
 	queues := queue.NewManager(mgr.GetClient(), cCache)
 
 	ctx := ctrl.SetupSignalHandler()
@@ -0,0 +1,137 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"sort"
+	"strings"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/util/priority"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+// AdmissionChecksAnnotation is the Workload annotation holding the state of
+// the admission checks that the workload needs to pass after its quota is
+// reserved, as a comma separated list of name=state pairs.
+const AdmissionChecksAnnotation = "kueue.x-k8s.io/admission-checks"
+
+// AdmissionCheckState is the state of an admission check of a workload.
+type AdmissionCheckState string
+
+const (
+	// CheckStatePending means that the check didn't complete yet.
+	CheckStatePending AdmissionCheckState = "Pending"
+	// CheckStateReady means that the check passed.
+	CheckStateReady AdmissionCheckState = "Ready"
+	// CheckStateRetry means that the check failed and the quota reservation
+	// should be released to retry later.
+	CheckStateRetry AdmissionCheckState = "Retry"
+	// CheckStateRejected means that the check failed and the workload
+	// can't be admitted.
+	CheckStateRejected AdmissionCheckState = "Rejected"
+)
+
+// admissionCheckStates returns the states of the admission checks of the
+// workload, keyed by check name. Entries with an unknown state are
+// considered Pending, so that the workload isn't taken as fully admitted.
+func admissionCheckStates(w *kueue.Workload) map[string]AdmissionCheckState {
+	v, ok := w.Annotations[AdmissionChecksAnnotation]
+	if !ok {
+		return nil
+	}
+	states := make(map[string]AdmissionCheckState)
+	for _, entry := range strings.Split(v, ",") {
+		name, state, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if name == "" {
+			continue
+		}
+		switch s := AdmissionCheckState(state); s {
+		case CheckStateReady, CheckStateRetry, CheckStateRejected:
+			states[name] = s
+		default:
+			states[name] = CheckStatePending
+		}
+	}
+	return states
+}
+
+// checksPending returns whether any of the admission checks is not Ready.
+func checksPending(states map[string]AdmissionCheckState) bool {
+	for _, s := range states {
+		if s != CheckStateReady {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkloadsPendingChecks returns the workloads admitted in the ClusterQueue
+// that reserve quota but have admission checks that are not Ready yet, sorted
+// by key.
+func (c *Cache) WorkloadsPendingChecks(cqName string) []*workload.Info {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil
+	}
+	var keys []string
+	for k, states := range cq.admissionChecks {
+		if cq.Workloads[k] != nil && checksPending(states) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	infos := make([]*workload.Info, 0, len(keys))
+	for _, k := range keys {
+		infos = append(infos, cq.Workloads[k].DeepCopy())
+	}
+	return infos
+}
+
+// ReclaimableUsage returns the quota reserved in the ClusterQueue by the
+// workloads that wait for admission checks and have a priority below the
+// ReclaimableCheckPriority of the ClusterQueue, which higher priority
+// workloads can reclaim under pressure. The usage is empty when the
+// ClusterQueue doesn't set ReclaimableCheckPriority.
+func (c *Cache) ReclaimableUsage(cqName string) (FlavorResourceQuantities, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	usage := make(FlavorResourceQuantities)
+	if cq.ReclaimableCheckPriority == nil {
+		return usage, nil
+	}
+	for k, states := range cq.admissionChecks {
+		wi := cq.Workloads[k]
+		if wi == nil || !checksPending(states) || priority.Priority(wi.Obj) >= *cq.ReclaimableCheckPriority {
+			continue
+		}
+		for fName, resUsage := range workloadUsage(wi) {
+			for rName, v := range resUsage {
+				addQuantity(usage, fName, rName, v)
+			}
+		}
+	}
+	return usage, nil
+}
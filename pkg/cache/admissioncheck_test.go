@@ -0,0 +1,197 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+func TestWorkloadsPendingChecks(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	admitted := func(name, checks string) *kueue.Workload {
+		wl := utiltesting.MakeWorkload(name, "ns").
+			Request(corev1.ResourceCPU, "1").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+			Obj()
+		if checks != "" {
+			wl.Annotations = map[string]string{AdmissionChecksAnnotation: checks}
+		}
+		return wl
+	}
+
+	cases := map[string]struct {
+		workloads []*kueue.Workload
+		update    *kueue.Workload
+		want      []string
+	}{
+		"no checks": {
+			workloads: []*kueue.Workload{admitted("a", "")},
+		},
+		"pending and ready checks": {
+			workloads: []*kueue.Workload{
+				admitted("a", "provision=Ready,budget=Ready"),
+				admitted("b", "provision=Ready,budget=Pending"),
+				admitted("c", "provision=Retry"),
+				admitted("d", "provision"),
+			},
+			want: []string{"ns/b", "ns/c", "ns/d"},
+		},
+		"checks become ready": {
+			workloads: []*kueue.Workload{
+				admitted("a", "provision=Pending"),
+				admitted("b", "provision=Pending"),
+			},
+			update: admitted("a", "provision=Ready"),
+			want:   []string{"ns/b"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			for _, wl := range tc.workloads {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Failed adding workload %s", wl.Name)
+				}
+			}
+			if tc.update != nil {
+				if !cache.AddOrUpdateWorkload(tc.update) {
+					t.Fatalf("Failed updating workload %s", tc.update.Name)
+				}
+			}
+			var got []string
+			for _, wi := range cache.WorkloadsPendingChecks("foo") {
+				got = append(got, workload.Key(wi.Obj))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected workloads pending checks (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWorkloadsPendingChecksDeletedWorkload(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").Obj()
+	wl := utiltesting.MakeWorkload("a", "ns").Admit(utiltesting.MakeAdmission("foo").Obj()).Obj()
+	wl.Annotations = map[string]string{AdmissionChecksAnnotation: "provision=Pending"}
+
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatal("Failed adding workload")
+	}
+	if got := len(cache.WorkloadsPendingChecks("foo")); got != 1 {
+		t.Fatalf("Got %d workloads pending checks, want 1", got)
+	}
+	if err := cache.DeleteWorkload(wl); err != nil {
+		t.Fatalf("Deleting workload: %v", err)
+	}
+	if got := len(cache.WorkloadsPendingChecks("foo")); got != 0 {
+		t.Errorf("Got %d workloads pending checks after deletion, want 0", got)
+	}
+	// A stale entry without the workload is skipped.
+	cache.clusterQueues["foo"].admissionChecks = map[string]map[string]AdmissionCheckState{
+		"ns/a": {"provision": CheckStatePending},
+	}
+	if got := len(cache.WorkloadsPendingChecks("foo")); got != 0 {
+		t.Errorf("Got %d workloads pending checks with a stale entry, want 0", got)
+	}
+}
+
+func TestReclaimableUsage(t *testing.T) {
+	admitted := func(name string, cpu string, prio int32, checks string) *kueue.Workload {
+		wl := utiltesting.MakeWorkload(name, "ns").
+			Priority(prio).
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+		if checks != "" {
+			wl.Annotations = map[string]string{AdmissionChecksAnnotation: checks}
+		}
+		return wl
+	}
+	workloads := []*kueue.Workload{
+		admitted("no-checks", "1", 0, ""),
+		admitted("ready-low", "1", 0, "provision=Ready"),
+		admitted("pending-low", "2", 0, "provision=Pending"),
+		admitted("retry-low", "3", 5, "provision=Ready,budget=Retry"),
+		admitted("pending-threshold", "4", 10, "provision=Pending"),
+		admitted("pending-high", "5", 20, "provision=Pending"),
+	}
+
+	cases := map[string]struct {
+		threshold string
+		want      FlavorResourceQuantities
+	}{
+		"not reclaimable": {
+			want: FlavorResourceQuantities{},
+		},
+		"below the threshold": {
+			threshold: "10",
+			want:      FlavorResourceQuantities{"default": {corev1.ResourceCPU: 5_000}},
+		},
+		"high threshold": {
+			threshold: "100",
+			want:      FlavorResourceQuantities{"default": {corev1.ResourceCPU: 14_000}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cqWrapper := utiltesting.MakeClusterQueue("foo").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "20").Obj())
+			if tc.threshold != "" {
+				cqWrapper.Annotation(ReclaimableCheckPriorityAnnotation, tc.threshold)
+			}
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), cqWrapper.Obj()); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			for _, wl := range workloads {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Failed adding workload %s", wl.Name)
+				}
+			}
+			got, err := cache.ReclaimableUsage("foo")
+			if err != nil {
+				t.Fatalf("Getting the reclaimable usage: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected reclaimable usage (-want,+got):\n%s", diff)
+			}
+		})
+	}
+
+	cache := New(utiltesting.NewFakeClient())
+	_, err := cache.ReclaimableUsage("bar")
+	if diff := cmp.Diff(errCqNotFound.Error(), messageOrEmpty(err)); diff != "" {
+		t.Errorf("Unexpected error for an unknown ClusterQueue (-want,+got):\n%s", diff)
+	}
+}
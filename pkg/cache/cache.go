@@ -20,26 +20,43 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
 	utilindexer "sigs.k8s.io/kueue/pkg/controller/core/indexer"
 	"sigs.k8s.io/kueue/pkg/metrics"
+	"sigs.k8s.io/kueue/pkg/util/maps"
+	"sigs.k8s.io/kueue/pkg/util/priority"
 	"sigs.k8s.io/kueue/pkg/workload"
 )
 
 var (
-	errCqNotFound          = errors.New("cluster queue not found")
-	errQNotFound           = errors.New("queue not found")
-	errWorkloadNotAdmitted = errors.New("workload not admitted by a ClusterQueue")
+	errCqNotFound              = errors.New("cluster queue not found")
+	errCohortNotFound          = errors.New("cohort not found")
+	errQNotFound               = errors.New("queue not found")
+	errWorkloadNotAdmitted     = errors.New("workload not admitted by a ClusterQueue")
+	errConcurrencyLimitReached = errors.New("ClusterQueue has the maximum number of admitted workloads")
+	errWorkloadDoesntFit       = errors.New("workload doesn't fit in the ClusterQueue")
+
+	// ErrWorkloadNotFound is returned when the workload is neither admitted
+	// nor assumed in any ClusterQueue.
+	ErrWorkloadNotFound = errors.New("workload not found in ClusterQueue")
 )
 
 const (
@@ -50,8 +67,29 @@ const (
 
 type options struct {
 	podsReadyTracking bool
+	externalQuota     ExternalQuotaClient
+	resourceAliases   map[corev1.ResourceName]corev1.ResourceName
+	recorder          record.EventRecorder
+	podsReadyTimeout  time.Duration
+	cohortHandler     func(name string, exists bool)
+	adaptiveBorrowing bool
+	statusHandler     func(cqName string, status metrics.ClusterQueueStatus)
+	statusDebounce    time.Duration
+	borrowScopeLabel  string
+	quotaMode         QuotaMode
 }
 
+// QuotaMode is the pod resource field that the workloads consume quota for.
+type QuotaMode string
+
+const (
+	// QuotaModeRequests counts the resource requests of the pods.
+	QuotaModeRequests QuotaMode = "Requests"
+	// QuotaModeLimits counts the resource limits of the pods, or their
+	// requests for the resources without a limit.
+	QuotaModeLimits QuotaMode = "Limits"
+)
+
 // Option configures the reconciler.
 type Option func(*options)
 
@@ -64,12 +102,105 @@ func WithPodsReadyTracking(f bool) Option {
 	}
 }
 
-var defaultOptions = options{}
+// WithResourceAliases maps resource names requested by workloads, such as
+// vendor specific names, to the canonical resource names used in the
+// ClusterQueue quotas. The usage of an alias is counted against the quota of
+// its canonical resource.
+func WithResourceAliases(aliases map[corev1.ResourceName]corev1.ResourceName) Option {
+	return func(o *options) {
+		o.resourceAliases = aliases
+	}
+}
+
+// WithPodsReadyTimeout excludes from the PodsReady tracking the workloads that
+// don't reach the PodsReady condition within the timeout since their
+// admission, so that a stuck workload doesn't block the admission of others.
+// A zero timeout waits indefinitely.
+func WithPodsReadyTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.podsReadyTimeout = timeout
+	}
+}
+
+// WithCohortChangeHandler sets a function called when a cohort is created,
+// with exists=true, or removed after its last ClusterQueue leaves it, with
+// exists=false. The handler is called while holding the cache lock, so it
+// must not call the cache.
+func WithCohortChangeHandler(handler func(name string, exists bool)) Option {
+	return func(o *options) {
+		o.cohortHandler = handler
+	}
+}
+
+// WithAdaptiveBorrowing limits the quota that each ClusterQueue can borrow to
+// its share of the quota that the other members of the cohort don't use, so
+// that a single ClusterQueue can't take all the unused quota of the cohort.
+// The share shrinks as the cohort approaches saturation. The borrowing limits
+// of the ClusterQueues still apply.
+func WithAdaptiveBorrowing(f bool) Option {
+	return func(o *options) {
+		o.adaptiveBorrowing = f
+	}
+}
+
+// WithStatusChangeHandler sets a function called when the status of a
+// ClusterQueue in the cache changes, for example when its flavors are added
+// or removed. It's not called when ClusterQueues are added or deleted. The
+// handler is called while holding the cache lock, so it must not call the
+// cache.
+func WithStatusChangeHandler(handler func(cqName string, status metrics.ClusterQueueStatus)) Option {
+	return func(o *options) {
+		o.statusHandler = handler
+	}
+}
+
+// WithStatusDebounce delays the calls to the status change handler until the
+// status of the ClusterQueue has been stable for the duration, so that a
+// ClusterQueue flapping between statuses produces a single notification, or
+// none if it goes back to the notified status. The status in the cache is
+// updated immediately. The notifications are sent by CleanUpOnContext.
+func WithStatusDebounce(d time.Duration) Option {
+	return func(o *options) {
+		o.statusDebounce = d
+	}
+}
+
+// WithCohortBorrowScope limits the ClusterQueues to borrow only from the
+// members of their cohort that have the same value for the label, for
+// example a region label. ClusterQueues without the label borrow from the
+// members without it.
+func WithCohortBorrowScope(label string) Option {
+	return func(o *options) {
+		o.borrowScopeLabel = label
+	}
+}
+
+// WithQuotaMode sets whether the workloads consume quota for the requests,
+// the default, or for the limits of their pods. With QuotaModeLimits, the
+// usage of a burstable workload is counted at its limits.
+func WithQuotaMode(mode QuotaMode) Option {
+	return func(o *options) {
+		o.quotaMode = mode
+	}
+}
+
+// WithEventRecorder configures the recorder for the events that the cache
+// emits about ClusterQueues, such as exceeding their quota after an update.
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(o *options) {
+		o.recorder = recorder
+	}
+}
+
+var defaultOptions = options{
+	quotaMode: QuotaModeRequests,
+}
 
 // Cache keeps track of the Workloads that got admitted through ClusterQueues.
 type Cache struct {
 	sync.RWMutex
 	podsReadyCond sync.Cond
+	activeCond    sync.Cond
 
 	client            client.Client
 	clusterQueues     map[string]*ClusterQueue
@@ -77,6 +208,39 @@ type Cache struct {
 	assumedWorkloads  map[string]string
 	resourceFlavors   map[kueue.ResourceFlavorReference]*kueue.ResourceFlavor
 	podsReadyTracking bool
+	metrics           *cacheMetrics
+	reporter          *clusterQueueReporter
+	externalQuota     ExternalQuotaClient
+	resourceAliases   map[corev1.ResourceName]corev1.ResourceName
+	clock             clock.WithTicker
+	reservations      map[string]*reservation
+	reservationsCount int
+	recorder          record.EventRecorder
+	podsReadyTimeout  time.Duration
+	cohortHandler     func(name string, exists bool)
+	adaptiveBorrowing bool
+	statusHandler     func(cqName string, status metrics.ClusterQueueStatus)
+	statusDebounce    time.Duration
+	borrowScopeLabel  string
+	quotaMode         QuotaMode
+	// pendingStatuses holds the status changes that are not notified yet
+	// because of the debounce, and notifiedStatuses the last status notified
+	// for the ClusterQueues with pending changes.
+	pendingStatuses  map[string]pendingStatus
+	notifiedStatuses map[string]metrics.ClusterQueueStatus
+	// inadmissibleReasons holds the reason why each pending workload couldn't
+	// be admitted in the last scheduling attempt, keyed by workload key.
+	inadmissibleReasons map[string]string
+	// admissionTimes holds when each admitted or assumed workload was
+	// admitted, keyed by workload key.
+	admissionTimes map[string]time.Time
+	// preemptors maps the keys of the preempted workloads to the keys of the
+	// workloads that preempted them.
+	preemptors map[string]string
+	// cohortBorrowCeilings holds the borrow ceilings set for the cohorts,
+	// keyed by cohort name, so that they apply again when a cohort is
+	// recreated.
+	cohortBorrowCeilings map[string]FlavorResourceQuantities
 }
 
 func New(client client.Client, opts ...Option) *Cache {
@@ -91,26 +255,76 @@ func New(client client.Client, opts ...Option) *Cache {
 		assumedWorkloads:  make(map[string]string),
 		resourceFlavors:   make(map[kueue.ResourceFlavorReference]*kueue.ResourceFlavor),
 		podsReadyTracking: options.podsReadyTracking,
+		reporter:          &clusterQueueReporter{},
+		externalQuota:     options.externalQuota,
+		resourceAliases:   maps.Clone(options.resourceAliases),
+		clock:             clock.RealClock{},
+		reservations:      make(map[string]*reservation),
+		recorder:          options.recorder,
+		podsReadyTimeout:  options.podsReadyTimeout,
+		cohortHandler:     options.cohortHandler,
+		adaptiveBorrowing: options.adaptiveBorrowing,
+		statusHandler:     options.statusHandler,
+		statusDebounce:    options.statusDebounce,
+		borrowScopeLabel:  options.borrowScopeLabel,
+		quotaMode:         options.quotaMode,
 	}
 	c.podsReadyCond.L = &c.RWMutex
+	c.activeCond.L = &c.RWMutex
 	return c
 }
 
 func (c *Cache) newClusterQueue(cq *kueue.ClusterQueue) (*ClusterQueue, error) {
+	cqImpl, err := buildClusterQueue(cq, c.resourceFlavors)
+	if err != nil {
+		return nil, err
+	}
+	cqImpl.podsReadyTracking = c.podsReadyTracking
+	cqImpl.metrics = c.metrics
+	cqImpl.reporter = c.reporter
+	cqImpl.reporter.reportStatus(cqImpl.Name, cqImpl.Status)
+	cqImpl.resourceAliases = c.resourceAliases
+	cqImpl.quotaMode = c.quotaMode
+	cqImpl.AdaptiveBorrowing = c.adaptiveBorrowing
+	c.updateBorrowScope(cqImpl, cq)
+	cqImpl.reportUsage()
+
+	return cqImpl, nil
+}
+
+// updateBorrowScope sets the borrow scope of the ClusterQueue from its label,
+// if the cache is configured with one.
+func (c *Cache) updateBorrowScope(cqImpl *ClusterQueue, cq *kueue.ClusterQueue) {
+	if c.borrowScopeLabel != "" {
+		cqImpl.BorrowScope = cq.Labels[c.borrowScopeLabel]
+	}
+}
+
+// buildClusterQueue parses the ClusterQueue spec into an empty ClusterQueue
+// that doesn't depend on the state of the cache other than the flavors.
+func buildClusterQueue(cq *kueue.ClusterQueue, resourceFlavors map[kueue.ResourceFlavorReference]*kueue.ResourceFlavor) (*ClusterQueue, error) {
 	cqImpl := &ClusterQueue{
 		Name:              cq.Name,
 		Workloads:         make(map[string]*workload.Info),
 		WorkloadsNotReady: sets.New[string](),
 		localQueues:       make(map[string]*queue),
-		podsReadyTracking: c.podsReadyTracking,
+		pendingWorkloads:  make(map[string]pendingWorkload),
 	}
-	if err := cqImpl.update(cq, c.resourceFlavors); err != nil {
+	if err := cqImpl.update(cq, resourceFlavors); err != nil {
 		return nil, err
 	}
-
 	return cqImpl, nil
 }
 
+// ValidateClusterQueue parses the ClusterQueue as AddClusterQueue does and
+// returns any error in its structure, without modifying the cache.
+func (c *Cache) ValidateClusterQueue(cq *kueue.ClusterQueue) error {
+	c.RLock()
+	defer c.RUnlock()
+	_, err := buildClusterQueue(cq, c.resourceFlavors)
+	return err
+}
+
 // WaitForPodsReady waits for all admitted workloads to be in the PodsReady condition
 // if podsReadyTracking is enabled. Otherwise returns immediately.
 func (c *Cache) WaitForPodsReady(ctx context.Context) {
@@ -138,6 +352,44 @@ func (c *Cache) WaitForPodsReady(ctx context.Context) {
 	}
 }
 
+// WaitForClusterQueueActive blocks until the ClusterQueue is active or the
+// context is cancelled, in which case it returns the context error. A
+// ClusterQueue that is not in the cache yet is waited for as well.
+func (c *Cache) WaitForClusterQueueActive(ctx context.Context, cqName string) error {
+	// Wake up the waiter when the context is cancelled, as the condition
+	// variable is only broadcast on status changes.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Lock()
+			c.activeCond.Broadcast()
+			c.Unlock()
+		case <-done:
+		}
+	}()
+
+	c.Lock()
+	defer c.Unlock()
+
+	log := ctrl.LoggerFrom(ctx)
+	for {
+		if cq, ok := c.clusterQueues[cqName]; ok && cq.Status == active {
+			return nil
+		}
+		log.V(3).Info("Waiting for the ClusterQueue to be active", "clusterQueue", cqName)
+		select {
+		case <-ctx.Done():
+			log.V(5).Info("Context cancelled when waiting for the ClusterQueue to be active; returning")
+			return ctx.Err()
+		default:
+			// wait releases the lock and acquires again when awaken
+			c.activeCond.Wait()
+		}
+	}
+}
+
 func (c *Cache) PodsReadyForAllAdmittedWorkloads(log logr.Logger) bool {
 	if !c.podsReadyTracking {
 		return true
@@ -149,7 +401,11 @@ func (c *Cache) PodsReadyForAllAdmittedWorkloads(log logr.Logger) bool {
 
 func (c *Cache) podsReadyForAllAdmittedWorkloads(log logr.Logger) bool {
 	for _, cq := range c.clusterQueues {
-		if len(cq.WorkloadsNotReady) > 0 {
+		for wlKey := range cq.WorkloadsNotReady {
+			if c.podsReadyTimedOut(cq.Workloads[wlKey]) {
+				log.V(2).Info("Ignoring workload that didn't reach the PodsReady condition within the timeout", "workload", wlKey, "clusterQueue", klog.KRef("", cq.Name))
+				continue
+			}
 			log.V(3).Info("There is a ClusterQueue with not ready workloads", "clusterQueue", klog.KRef("", cq.Name))
 			return false
 		}
@@ -158,14 +414,45 @@ func (c *Cache) podsReadyForAllAdmittedWorkloads(log logr.Logger) bool {
 	return true
 }
 
+// podsReadyTimedOut returns whether the workload was admitted longer than the
+// PodsReady timeout ago.
+func (c *Cache) podsReadyTimedOut(wi *workload.Info) bool {
+	if c.podsReadyTimeout == 0 || wi == nil {
+		return false
+	}
+	admittedCond := apimeta.FindStatusCondition(wi.Obj.Status.Conditions, kueue.WorkloadAdmitted)
+	if admittedCond == nil || admittedCond.Status != metav1.ConditionTrue {
+		return false
+	}
+	return c.clock.Since(admittedCond.LastTransitionTime.Time) >= c.podsReadyTimeout
+}
+
 // CleanUpOnContext tracks the context. When closed, it wakes routines waiting
 // on the podsReady condition. It should be called before doing any calls to
-// cache.WaitForPodsReady.
+// cache.WaitForPodsReady. Until then, it periodically releases the expired
+// quota reservations.
 func (c *Cache) CleanUpOnContext(ctx context.Context) {
-	<-ctx.Done()
-	c.Lock()
-	defer c.Unlock()
-	c.podsReadyCond.Broadcast()
+	ticker := c.clock.NewTicker(reservationsCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.Lock()
+			defer c.Unlock()
+			c.podsReadyCond.Broadcast()
+			return
+		case <-ticker.C():
+			c.expireReservations()
+			c.expireQuotaOverrides()
+			c.flushStatusChanges()
+			if c.podsReadyTracking && c.podsReadyTimeout > 0 {
+				// Wake up the routines waiting for workloads that might have timed out.
+				c.Lock()
+				c.podsReadyCond.Broadcast()
+				c.Unlock()
+			}
+		}
+	}
 }
 
 func (c *Cache) AdmittedWorkloadsInLocalQueue(localQueue *kueue.LocalQueue) int32 {
@@ -182,35 +469,305 @@ func (c *Cache) AdmittedWorkloadsInLocalQueue(localQueue *kueue.LocalQueue) int3
 	return int32(qImpl.admittedWorkloads)
 }
 
-func (c *Cache) updateClusterQueues() sets.Set[string] {
-	cqs := sets.New[string]()
+// updateClusterQueues updates the ClusterQueues with the current flavors and
+// returns the ones that became active, and the ones whose status or label keys
+// changed.
+func (c *Cache) updateClusterQueues() (activated, changed sets.Set[string]) {
+	activated = sets.New[string]()
+	changed = sets.New[string]()
 
 	for _, cq := range c.clusterQueues {
 		prevStatus := cq.Status
+		prevLabelKeys := make([]sets.Set[string], len(cq.ResourceGroups))
+		for i := range cq.ResourceGroups {
+			prevLabelKeys[i] = cq.ResourceGroups[i].LabelKeys
+		}
 		// We call update on all ClusterQueues irrespective of which CQ actually use this flavor
 		// because it is not expensive to do so, and is not worth tracking which ClusterQueues use
 		// which flavors.
 		cq.UpdateWithFlavors(c.resourceFlavors)
 		curStatus := cq.Status
+		c.statusChanged(cq, prevStatus)
 		if prevStatus == pending && curStatus == active {
-			cqs.Insert(cq.Name)
+			activated.Insert(cq.Name)
+		}
+		if prevStatus != curStatus {
+			changed.Insert(cq.Name)
+			continue
+		}
+		for i := range cq.ResourceGroups {
+			if !prevLabelKeys[i].Equal(cq.ResourceGroups[i].LabelKeys) {
+				changed.Insert(cq.Name)
+				break
+			}
 		}
 	}
-	return cqs
+	return activated, changed
 }
 
-func (c *Cache) AddOrUpdateResourceFlavor(rf *kueue.ResourceFlavor) sets.Set[string] {
+// AddOrUpdateResourceFlavor stores the ResourceFlavor and returns whether it's
+// new or its spec changed, along with the names of the ClusterQueues whose
+// status or label keys changed as a result. Storing a flavor with the same
+// spec doesn't update the ClusterQueues.
+func (c *Cache) AddOrUpdateResourceFlavor(rf *kueue.ResourceFlavor) (bool, sets.Set[string]) {
 	c.Lock()
 	defer c.Unlock()
-	c.resourceFlavors[kueue.ResourceFlavorReference(rf.Name)] = rf
-	return c.updateClusterQueues()
+	name := kueue.ResourceFlavorReference(rf.Name)
+	old, exists := c.resourceFlavors[name]
+	c.resourceFlavors[name] = rf
+	if exists && equality.Semantic.DeepEqual(old.Spec, rf.Spec) {
+		return false, nil
+	}
+	_, changed := c.updateClusterQueues()
+	return true, changed
 }
 
 func (c *Cache) DeleteResourceFlavor(rf *kueue.ResourceFlavor) sets.Set[string] {
 	c.Lock()
 	defer c.Unlock()
 	delete(c.resourceFlavors, kueue.ResourceFlavorReference(rf.Name))
-	return c.updateClusterQueues()
+	activated, _ := c.updateClusterQueues()
+	return activated
+}
+
+// ResourceFlavorExists returns whether the ResourceFlavor is stored in the
+// cache.
+func (c *Cache) ResourceFlavorExists(name string) bool {
+	c.RLock()
+	defer c.RUnlock()
+	_, ok := c.resourceFlavors[kueue.ResourceFlavorReference(name)]
+	return ok
+}
+
+// ListResourceFlavors returns the names of the ResourceFlavors stored in the
+// cache, sorted.
+func (c *Cache) ListResourceFlavors() []string {
+	c.RLock()
+	defer c.RUnlock()
+	names := make([]string, 0, len(c.resourceFlavors))
+	for name := range c.resourceFlavors {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ClusterQueueCohort returns the name of the cohort of the ClusterQueue and
+// whether it belongs to one.
+func (c *Cache) ClusterQueueCohort(cqName string) (string, bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return "", false, errCqNotFound
+	}
+	if cq.Cohort == nil {
+		return "", false, nil
+	}
+	return cq.Cohort.Name, true, nil
+}
+
+// CanBorrowForPriority returns whether a workload with the given priority
+// can use quota borrowed from the cohort of the ClusterQueue. Workloads below
+// the ClusterQueue's minimum borrowing priority can only use its nominal quota.
+func (c *Cache) CanBorrowForPriority(cqName string, priority int32) (bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return false, errCqNotFound
+	}
+	return cq.CanBorrow(priority), nil
+}
+
+// GetCohortMembers returns the sorted names of the ClusterQueues in the cohort.
+func (c *Cache) GetCohortMembers(cohortName string) ([]string, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cohort, ok := c.cohorts[cohortName]
+	if !ok {
+		return nil, errCohortNotFound
+	}
+	names := make([]string, 0, cohort.Members.Len())
+	for cq := range cohort.Members {
+		names = append(names, cq.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SumUsageAcrossCohort returns the sum of the usage of all the members of
+// the cohort other than excludeCQ, per flavor and resource. It returns an
+// error if excludeCQ is not a member of the cohort.
+func (c *Cache) SumUsageAcrossCohort(cohortName, excludeCQ string) (FlavorResourceQuantities, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cohort, ok := c.cohorts[cohortName]
+	if !ok {
+		return nil, errCohortNotFound
+	}
+	if cq, ok := c.clusterQueues[excludeCQ]; !ok || cq.Cohort != cohort {
+		return nil, errCqNotFound
+	}
+	usage := make(FlavorResourceQuantities)
+	for cq := range cohort.Members {
+		if cq.Name == excludeCQ {
+			continue
+		}
+		for fName, resUsage := range cq.Usage {
+			for rName, v := range resUsage {
+				addQuantity(usage, fName, rName, v)
+			}
+		}
+	}
+	return usage, nil
+}
+
+// TransferCohortMembership moves the ClusterQueue to the cohort, or out of
+// any cohort if newCohort is empty, without a full UpdateClusterQueue. The
+// aggregates of both cohorts reflect the move at once, and the previous
+// cohort is removed if it's left without members. A later
+// UpdateClusterQueue moves the ClusterQueue to the cohort in its spec.
+func (c *Cache) TransferCohortMembership(cqName, newCohort string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return errCqNotFound
+	}
+	var oldCohort string
+	if cq.Cohort != nil {
+		oldCohort = cq.Cohort.Name
+	}
+	if oldCohort == newCohort {
+		return nil
+	}
+	c.deleteClusterQueueFromCohort(cq)
+	c.addClusterQueueToCohort(cq, newCohort)
+	return nil
+}
+
+// SetCohortBorrowCeiling sets the maximum that the members of the cohort can
+// borrow in total, per flavor and resource, even if their BorrowingLimits
+// allow more. Flavors and resources without a ceiling are not limited, and
+// empty limits remove the ceiling. The ceiling can be set before the cohort
+// exists and it's kept when the cohort is left without members.
+func (c *Cache) SetCohortBorrowCeiling(name string, limits FlavorResourceQuantities) {
+	c.Lock()
+	defer c.Unlock()
+
+	var ceiling FlavorResourceQuantities
+	if len(limits) > 0 {
+		ceiling = copyQuantities(limits)
+		if c.cohortBorrowCeilings == nil {
+			c.cohortBorrowCeilings = make(map[string]FlavorResourceQuantities)
+		}
+		c.cohortBorrowCeilings[name] = ceiling
+	} else {
+		delete(c.cohortBorrowCeilings, name)
+	}
+	if cohort, ok := c.cohorts[name]; ok {
+		cohort.BorrowCeiling = ceiling
+	}
+}
+
+// RecomputeCohort rebuilds the usage of all the members of the cohort from
+// their admitted workloads and quota reservations, discarding any drift
+// accumulated by incremental updates.
+func (c *Cache) RecomputeCohort(name string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	cohort, ok := c.cohorts[name]
+	if !ok {
+		return errCohortNotFound
+	}
+	reserved := make(map[string][]FlavorResourceQuantities)
+	for _, r := range c.reservations {
+		reserved[r.clusterQueue] = append(reserved[r.clusterQueue], r.usage)
+	}
+	for cq := range cohort.Members {
+		cq.recomputeUsage(reserved[cq.Name])
+	}
+	return nil
+}
+
+// CohortBorrowOrder returns the names of the members of the cohort in the
+// order in which they borrow: by decreasing borrowing priority, then by name.
+func (c *Cache) CohortBorrowOrder(cohortName string) []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	cohort, ok := c.cohorts[cohortName]
+	if !ok {
+		return nil
+	}
+	members := make([]*ClusterQueue, 0, cohort.Members.Len())
+	for cq := range cohort.Members {
+		members = append(members, cq)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].BorrowingPriority != members[j].BorrowingPriority {
+			return members[i].BorrowingPriority > members[j].BorrowingPriority
+		}
+		return members[i].Name < members[j].Name
+	})
+	names := make([]string, len(members))
+	for i, cq := range members {
+		names[i] = cq.Name
+	}
+	return names
+}
+
+// SetSelfReserve sets the amount of each resource that the ClusterQueue keeps
+// for its own workloads, in every flavor, and doesn't lend to its cohort.
+// A nil reserve lends all the unused quota.
+func (c *Cache) SetSelfReserve(cqName string, reserve map[corev1.ResourceName]int64) error {
+	c.Lock()
+	defer c.Unlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return errCqNotFound
+	}
+	cq.SelfReserve = maps.Clone(reserve)
+	return nil
+}
+
+// SetHeadroom sets the amount of the resource in the flavor that the
+// ClusterQueue keeps free for pods not managed by kueue. The headroom counts
+// as used quota when the cache checks whether workloads fit or can borrow,
+// as in CanFit and AvailableToBorrow. The scheduler doesn't account for it.
+// A non-positive amount removes the headroom.
+func (c *Cache) SetHeadroom(cqName, flavor string, resource corev1.ResourceName, amount int64) error {
+	c.Lock()
+	defer c.Unlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return errCqNotFound
+	}
+	fName := kueue.ResourceFlavorReference(flavor)
+	// Snapshots share the headroom, so it's replaced instead of modified.
+	headroom := copyQuantities(cq.Headroom)
+	if amount > 0 {
+		if headroom == nil {
+			headroom = make(FlavorResourceQuantities)
+		}
+		addQuantity(headroom, fName, resource, amount-headroom[fName][resource])
+	} else {
+		delete(headroom[fName], resource)
+		if len(headroom[fName]) == 0 {
+			delete(headroom, fName)
+		}
+	}
+	cq.Headroom = headroom
+	return nil
 }
 
 func (c *Cache) ClusterQueueActive(name string) bool {
@@ -236,9 +793,91 @@ func (c *Cache) TerminateClusterQueue(name string) {
 	c.Lock()
 	defer c.Unlock()
 	if cq, exists := c.clusterQueues[name]; exists {
+		prevStatus := cq.Status
 		cq.Status = terminating
-		metrics.ReportClusterQueueStatus(cq.Name, cq.Status)
+		cq.reporter.reportStatus(cq.Name, cq.Status)
+		c.statusChanged(cq, prevStatus)
+	}
+}
+
+// SetClusterQueueStatus manually overrides the status of the ClusterQueue.
+// Setting it to pending holds the ClusterQueue, so that it doesn't admit
+// workloads, until it's set back to active. Updates to the ClusterQueue spec
+// don't clear the hold.
+func (c *Cache) SetClusterQueueStatus(cqName string, status metrics.ClusterQueueStatus) error {
+	c.Lock()
+	defer c.Unlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return errCqNotFound
+	}
+	switch status {
+	case pending:
+		cq.held = true
+	case active:
+		cq.held = false
+	default:
+		return fmt.Errorf("unsupported ClusterQueue status %q", status)
+	}
+	prevStatus := cq.Status
+	cq.UpdateWithFlavors(c.resourceFlavors)
+	c.statusChanged(cq, prevStatus)
+	return nil
+}
+
+// DrainClusterQueue removes all the admitted and assumed workloads and the
+// quota reservations from the ClusterQueue, leaving its usage at zero, and
+// returns the sorted keys of the removed workloads. The ClusterQueue stays in
+// the cache.
+func (c *Cache) DrainClusterQueue(cqName string) ([]string, error) {
+	keys, usages, err := c.drainClusterQueue(cqName)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, usage := range usages {
+		if err := c.releaseExternalQuota(usage); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return keys, errors.Join(errs...)
+}
+
+func (c *Cache) drainClusterQueue(cqName string) ([]string, []FlavorResourceQuantities, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, nil, errCqNotFound
+	}
+	keys := make([]string, 0, len(cq.Workloads))
+	for k := range cq.Workloads {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var usages []FlavorResourceQuantities
+	for _, k := range keys {
+		wi := cq.Workloads[k]
+		if assumedCQ, assumed := c.assumedWorkloads[k]; assumed && assumedCQ == cqName {
+			delete(c.assumedWorkloads, k)
+		}
+		cq.deleteWorkload(wi.Obj)
+		if usage := c.externalUsage(wi); usage != nil {
+			usages = append(usages, usage)
+		}
+	}
+	c.reportAssumedWorkloads()
+	for id, r := range c.reservations {
+		if r.clusterQueue == cqName {
+			c.releaseReservation(id)
+		}
+	}
+	if c.podsReadyTracking {
+		c.podsReadyCond.Broadcast()
 	}
+	return keys, usages, nil
 }
 
 // ClusterQueueEmpty indicates whether there's any active workload admitted by
@@ -257,7 +896,26 @@ func (c *Cache) ClusterQueueEmpty(name string) bool {
 func (c *Cache) AddClusterQueue(ctx context.Context, cq *kueue.ClusterQueue) error {
 	c.Lock()
 	defer c.Unlock()
+	return c.addClusterQueue(ctx, cq)
+}
+
+// AddClusterQueues adds the ClusterQueues to the cache holding the lock only
+// once, which is cheaper than calling AddClusterQueue for each of them at
+// startup. The result is the same as adding them one by one, in order. It
+// returns the error of adding each ClusterQueue, in the same order, being nil
+// for the ones successfully added.
+func (c *Cache) AddClusterQueues(ctx context.Context, cqs []*kueue.ClusterQueue) []error {
+	c.Lock()
+	defer c.Unlock()
+
+	errs := make([]error, len(cqs))
+	for i, cq := range cqs {
+		errs[i] = c.addClusterQueue(ctx, cq)
+	}
+	return errs
+}
 
+func (c *Cache) addClusterQueue(ctx context.Context, cq *kueue.ClusterQueue) error {
 	if _, ok := c.clusterQueues[cq.Name]; ok {
 		return fmt.Errorf("ClusterQueue already exists")
 	}
@@ -267,6 +925,9 @@ func (c *Cache) AddClusterQueue(ctx context.Context, cq *kueue.ClusterQueue) err
 	}
 	c.addClusterQueueToCohort(cqImpl, cq.Spec.Cohort)
 	c.clusterQueues[cq.Name] = cqImpl
+	if cqImpl.Status == active {
+		c.activeCond.Broadcast()
+	}
 
 	// On controller restart, an add ClusterQueue event may come after
 	// add queue and workload, so here we explicitly list and add existing queues
@@ -301,35 +962,83 @@ func (c *Cache) AddClusterQueue(ctx context.Context, cq *kueue.ClusterQueue) err
 	return nil
 }
 
-func (c *Cache) UpdateClusterQueue(cq *kueue.ClusterQueue) error {
+// UpdateClusterQueue updates the ClusterQueue in the cache and returns
+// whether its resource groups, quotas or cohort changed, which can make room
+// for pending workloads.
+func (c *Cache) UpdateClusterQueue(cq *kueue.ClusterQueue) (bool, error) {
 	c.Lock()
 	defer c.Unlock()
 	cqImpl, ok := c.clusterQueues[cq.Name]
 	if !ok {
-		return errCqNotFound
+		return false, errCqNotFound
+	}
+	oldResourceGroups := cqImpl.ResourceGroups
+	oldStatus := cqImpl.Status
+	var oldCohort string
+	if cqImpl.Cohort != nil {
+		oldCohort = cqImpl.Cohort.Name
 	}
 	if err := cqImpl.update(cq, c.resourceFlavors); err != nil {
-		return err
+		return false, err
 	}
+	c.pruneReservations(cqImpl)
+	c.statusChanged(cqImpl, oldStatus)
+	c.updateBorrowScope(cqImpl, cq)
 	for _, qImpl := range cqImpl.localQueues {
 		if qImpl == nil {
-			return errQNotFound
+			return false, errQNotFound
 		}
 		if err := qImpl.resetFlavorsAndResources(cqImpl.Usage); err != nil {
-			return err
+			return false, err
 		}
 	}
 
 	if cqImpl.Cohort == nil {
 		c.addClusterQueueToCohort(cqImpl, cq.Spec.Cohort)
-		return nil
-	}
-
-	if cqImpl.Cohort.Name != cq.Spec.Cohort {
+	} else if cqImpl.Cohort.Name != cq.Spec.Cohort {
 		c.deleteClusterQueueFromCohort(cqImpl)
 		c.addClusterQueueToCohort(cqImpl, cq.Spec.Cohort)
 	}
-	return nil
+
+	if c.recorder != nil {
+		for _, msg := range cqImpl.overQuota() {
+			c.recorder.Event(cq, corev1.EventTypeWarning, "OverQuota", msg)
+		}
+	}
+	changed := oldCohort != cq.Spec.Cohort || !equalResourceGroups(oldResourceGroups, cqImpl.ResourceGroups)
+	return changed, nil
+}
+
+// CompareSpec returns whether the resource groups and the cohort of the
+// ClusterQueue in the cache match the ones in the spec of cq, for example
+// freshly listed from the API server, so that drift can be detected without
+// calling UpdateClusterQueue. The nominal quotas replaced with
+// OverrideFlavorQuota are compared by their values in the spec.
+func (c *Cache) CompareSpec(cq *kueue.ClusterQueue) (bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cqImpl, ok := c.clusterQueues[cq.Name]
+	if !ok {
+		return false, errCqNotFound
+	}
+	if err := validateResourceGroups(cq.Spec.ResourceGroups); err != nil {
+		return false, err
+	}
+	usageCaps, err := parseUsageCaps(cq.Annotations[UsageCapsAnnotation])
+	if err != nil {
+		return false, fmt.Errorf("parsing annotation %s: %w", UsageCapsAnnotation, err)
+	}
+	var cohort string
+	if cqImpl.Cohort != nil {
+		cohort = cqImpl.Cohort.Name
+	}
+	if cohort != cq.Spec.Cohort {
+		return false, nil
+	}
+	spec := &ClusterQueue{}
+	spec.updateResourceGroups(cq.Spec.ResourceGroups, parseDefaultFlavors(cq.Annotations[DefaultFlavorsAnnotation]), usageCaps)
+	return equalResourceGroups(cqImpl.specResourceGroups(), spec.ResourceGroups), nil
 }
 
 func (c *Cache) DeleteClusterQueue(cq *kueue.ClusterQueue) {
@@ -341,7 +1050,11 @@ func (c *Cache) DeleteClusterQueue(cq *kueue.ClusterQueue) {
 	}
 	c.deleteClusterQueueFromCohort(cqImpl)
 	delete(c.clusterQueues, cq.Name)
-	metrics.ClearCacheMetrics(cq.Name)
+	c.deleteReservations(cq.Name)
+	delete(c.pendingStatuses, cq.Name)
+	delete(c.notifiedStatuses, cq.Name)
+	c.reporter.clear(cq.Name)
+	cqImpl.clearUsageMetrics()
 }
 
 func (c *Cache) AddLocalQueue(q *kueue.LocalQueue) error {
@@ -365,11 +1078,16 @@ func (c *Cache) DeleteLocalQueue(q *kueue.LocalQueue) {
 }
 
 func (c *Cache) UpdateLocalQueue(oldQ, newQ *kueue.LocalQueue) error {
+	c.Lock()
+	defer c.Unlock()
 	if oldQ.Spec.ClusterQueue == newQ.Spec.ClusterQueue {
+		if cq, ok := c.clusterQueues[string(newQ.Spec.ClusterQueue)]; ok {
+			if qImpl, ok := cq.localQueues[queueKey(newQ)]; ok {
+				return qImpl.updateDefaultPriority(newQ)
+			}
+		}
 		return nil
 	}
-	c.Lock()
-	defer c.Unlock()
 	cq, ok := c.clusterQueues[string(oldQ.Spec.ClusterQueue)]
 	if ok {
 		cq.deleteLocalQueue(oldQ)
@@ -381,6 +1099,56 @@ func (c *Cache) UpdateLocalQueue(oldQ, newQ *kueue.LocalQueue) error {
 	return nil
 }
 
+// StopLocalQueue handles a LocalQueue that was administratively stopped.
+// When releaseUsage is true, the usage of the admitted workloads of the
+// LocalQueue is no longer accounted in its ClusterQueue, freeing capacity for
+// other queues, and the usage of the LocalQueue is zeroed. The workloads are
+// still counted as admitted in the LocalQueue.
+func (c *Cache) StopLocalQueue(lq *kueue.LocalQueue, releaseUsage bool) error {
+	c.Lock()
+	defer c.Unlock()
+	cq, ok := c.clusterQueues[string(lq.Spec.ClusterQueue)]
+	if !ok {
+		return errCqNotFound
+	}
+	if _, ok := cq.localQueues[queueKey(lq)]; !ok {
+		return errQNotFound
+	}
+	if !releaseUsage {
+		return nil
+	}
+	return cq.stopLocalQueue(lq)
+}
+
+// LocalQueueDefaultPriority returns the priority of the workloads submitted
+// to the LocalQueue that don't specify one, as set in its
+// DefaultPriorityAnnotation, and whether it has one.
+func (c *Cache) LocalQueueDefaultPriority(lq *kueue.LocalQueue) (int32, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	cq, ok := c.clusterQueues[string(lq.Spec.ClusterQueue)]
+	if !ok {
+		return 0, false
+	}
+	qImpl, ok := cq.localQueues[queueKey(lq)]
+	if !ok || qImpl.defaultPriority == nil {
+		return 0, false
+	}
+	return *qImpl.defaultPriority, true
+}
+
+// ReconcileLocalQueue recomputes the usage and the number of admitted
+// workloads of the LocalQueue from the workloads in its ClusterQueue.
+func (c *Cache) ReconcileLocalQueue(lq *kueue.LocalQueue) error {
+	c.Lock()
+	defer c.Unlock()
+	cq, ok := c.clusterQueues[string(lq.Spec.ClusterQueue)]
+	if !ok {
+		return errCqNotFound
+	}
+	return cq.reconcileLocalQueue(lq)
+}
+
 func (c *Cache) AddOrUpdateWorkload(w *kueue.Workload) bool {
 	c.Lock()
 	defer c.Unlock()
@@ -397,7 +1165,18 @@ func (c *Cache) addOrUpdateWorkload(w *kueue.Workload) bool {
 		return false
 	}
 
+	// The same object delivered again, for example on an informer resync,
+	// keeps the usage computed when it was added. Any change to the spec or
+	// the admission changes the resourceVersion.
+	if wi, exist := clusterQueue.Workloads[workload.Key(w)]; exist && w.ResourceVersion != "" && wi.Obj.ResourceVersion == w.ResourceVersion {
+		if _, assumed := c.assumedWorkloads[workload.Key(w)]; !assumed {
+			return true
+		}
+	}
+
 	c.cleanupAssumedState(w)
+	c.admitPendingWorkload(workload.Key(w), clusterQueue.Name)
+	delete(c.inadmissibleReasons, workload.Key(w))
 
 	if _, exist := clusterQueue.Workloads[workload.Key(w)]; exist {
 		clusterQueue.deleteWorkload(w)
@@ -406,50 +1185,551 @@ func (c *Cache) addOrUpdateWorkload(w *kueue.Workload) bool {
 	if c.podsReadyTracking {
 		c.podsReadyCond.Broadcast()
 	}
-	return clusterQueue.addWorkload(w) == nil
+	if err := clusterQueue.addWorkload(w); err != nil {
+		return false
+	}
+	c.recordAdmissionTime(w)
+	return true
+}
+
+// AddOrUpdatePendingWorkload records the workload as waiting for admission in
+// the ClusterQueue of its LocalQueue. Returns false if the workload is
+// admitted or its LocalQueue is unknown.
+func (c *Cache) AddOrUpdatePendingWorkload(w *kueue.Workload) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	k := workload.Key(w)
+	prev, found := c.deletePendingWorkload(k)
+	if workload.IsAdmitted(w) {
+		return false
+	}
+	firstSeen := c.clock.Now()
+	if found {
+		firstSeen = prev.firstSeen
+	}
+	qKey := workload.QueueKey(w)
+	for _, cq := range c.clusterQueues {
+		if _, ok := cq.localQueues[qKey]; ok {
+			cq.pendingWorkloads[k] = pendingWorkload{localQueue: qKey, priority: priority.Priority(w), firstSeen: firstSeen}
+			return true
+		}
+	}
+	return false
+}
+
+// DeletePendingWorkload stops tracking the workload as waiting for admission.
+func (c *Cache) DeletePendingWorkload(w *kueue.Workload) {
+	c.Lock()
+	defer c.Unlock()
+	c.deletePendingWorkload(workload.Key(w))
+	delete(c.inadmissibleReasons, workload.Key(w))
+	c.clearPreemptions(workload.Key(w))
+}
+
+// SetInadmissible records the reason why the pending workload couldn't be
+// admitted, replacing the previous one. The reason is cleared when the
+// workload is admitted or assumed.
+func (c *Cache) SetInadmissible(wlKey, reason string) {
+	c.Lock()
+	defer c.Unlock()
+	if c.inadmissibleReasons == nil {
+		c.inadmissibleReasons = make(map[string]string)
+	}
+	c.inadmissibleReasons[wlKey] = reason
+}
+
+// InadmissibleReason returns the last reason recorded with SetInadmissible for
+// the workload, and whether there is one.
+func (c *Cache) InadmissibleReason(wlKey string) (string, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	reason, ok := c.inadmissibleReasons[wlKey]
+	return reason, ok
+}
+
+// deletePendingWorkload stops tracking the workload as pending and returns
+// its previous record, if any.
+func (c *Cache) deletePendingWorkload(k string) (pendingWorkload, bool) {
+	var (
+		prev  pendingWorkload
+		found bool
+	)
+	for _, cq := range c.clusterQueues {
+		if p, ok := cq.pendingWorkloads[k]; ok {
+			prev, found = p, true
+			delete(cq.pendingWorkloads, k)
+		}
+	}
+	return prev, found
+}
+
+// admitPendingWorkload stops tracking the workload as pending and, if it was
+// pending, reports the time it took to admit it in the ClusterQueue.
+func (c *Cache) admitPendingWorkload(k, cqName string) {
+	if pending, found := c.deletePendingWorkload(k); found {
+		c.reportTimeToAdmit(cqName, pending)
+	}
+}
+
+// PendingWorkloadsCount returns the number of workloads waiting for admission
+// in the ClusterQueue.
+func (c *Cache) PendingWorkloadsCount(cqName string) int {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return 0
+	}
+	return len(cq.pendingWorkloads)
+}
+
+// OldestPendingWorkload returns the key of the workload that has been waiting
+// for admission in the ClusterQueue for the longest time, and for how long,
+// to detect starvation. Ties are broken by key. The key is empty when the
+// ClusterQueue has no pending workloads.
+func (c *Cache) OldestPendingWorkload(cqName string) (string, time.Duration, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return "", 0, errCqNotFound
+	}
+	var oldestKey string
+	var oldest time.Time
+	for k, p := range cq.pendingWorkloads {
+		if oldestKey == "" || p.firstSeen.Before(oldest) || (p.firstSeen.Equal(oldest) && k < oldestKey) {
+			oldestKey = k
+			oldest = p.firstSeen
+		}
+	}
+	if oldestKey == "" {
+		return "", 0, nil
+	}
+	return oldestKey, c.clock.Since(oldest), nil
+}
+
+// WorkloadState is the state of a workload tracked by the cache.
+type WorkloadState int
+
+const (
+	// WorkloadStateAdmitted is a workload admitted by a ClusterQueue.
+	WorkloadStateAdmitted WorkloadState = iota
+	// WorkloadStateAssumed is a workload assumed by the scheduler, whose
+	// admission is not persisted yet.
+	WorkloadStateAssumed
+	// WorkloadStatePending is a workload waiting for admission.
+	WorkloadStatePending
+)
+
+// WorkloadFilter selects the workloads counted by WorkloadCount. The zero
+// value selects all the workloads.
+type WorkloadFilter struct {
+	// ClusterQueue restricts the count to the workloads of the ClusterQueue.
+	ClusterQueue string
+	// Cohort restricts the count to the workloads of the members of the cohort.
+	Cohort string
+	// States restricts the count to the workloads in any of the states.
+	States []WorkloadState
+	// MinPriority and MaxPriority restrict the count to the workloads with a
+	// priority in the inclusive range.
+	MinPriority *int32
+	MaxPriority *int32
+}
+
+func (f *WorkloadFilter) hasState(state WorkloadState) bool {
+	if len(f.States) == 0 {
+		return true
+	}
+	for _, s := range f.States {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *WorkloadFilter) hasPriority(p int32) bool {
+	return (f.MinPriority == nil || p >= *f.MinPriority) && (f.MaxPriority == nil || p <= *f.MaxPriority)
+}
+
+// WorkloadCount returns the number of workloads tracked by the cache that
+// match the filter.
+func (c *Cache) WorkloadCount(filter WorkloadFilter) int {
+	c.RLock()
+	defer c.RUnlock()
+
+	var cqs []*ClusterQueue
+	switch {
+	case filter.ClusterQueue != "":
+		cq, ok := c.clusterQueues[filter.ClusterQueue]
+		if !ok || (filter.Cohort != "" && (cq.Cohort == nil || cq.Cohort.Name != filter.Cohort)) {
+			return 0
+		}
+		cqs = []*ClusterQueue{cq}
+	case filter.Cohort != "":
+		cohort, ok := c.cohorts[filter.Cohort]
+		if !ok {
+			return 0
+		}
+		for cq := range cohort.Members {
+			cqs = append(cqs, cq)
+		}
+	default:
+		for _, cq := range c.clusterQueues {
+			cqs = append(cqs, cq)
+		}
+	}
+
+	admitted := filter.hasState(WorkloadStateAdmitted)
+	assumed := filter.hasState(WorkloadStateAssumed)
+	pending := filter.hasState(WorkloadStatePending)
+	count := 0
+	for _, cq := range cqs {
+		if admitted || assumed {
+			for k, wi := range cq.Workloads {
+				_, isAssumed := c.assumedWorkloads[k]
+				if (isAssumed && !assumed) || (!isAssumed && !admitted) {
+					continue
+				}
+				if filter.hasPriority(priority.Priority(wi.Obj)) {
+					count++
+				}
+			}
+		}
+		if pending {
+			for _, p := range cq.pendingWorkloads {
+				if filter.hasPriority(p.priority) {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// QueueDepthByPriority returns the number of workloads waiting for admission
+// in the ClusterQueue, per priority.
+func (c *Cache) QueueDepthByPriority(cqName string) (map[int32]int, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	depth := make(map[int32]int)
+	for _, pending := range cq.pendingWorkloads {
+		depth[pending.priority]++
+	}
+	return depth, nil
+}
+
+// ClusterQueueHasWorkload returns whether the workload with the given key is
+// admitted or assumed in the ClusterQueue.
+func (c *Cache) ClusterQueueHasWorkload(cqName, wlKey string) (bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return false, errCqNotFound
+	}
+	_, ok = cq.Workloads[wlKey]
+	return ok, nil
+}
+
+// TotalAdmittedWorkloads returns the number of workloads admitted in all the
+// ClusterQueues. Workloads that are assumed but not admitted yet are only
+// counted when includeAssumed is true.
+func (c *Cache) TotalAdmittedWorkloads(includeAssumed bool) int {
+	c.RLock()
+	defer c.RUnlock()
+
+	total := 0
+	for _, cq := range c.clusterQueues {
+		total += c.admittedWorkloadsCount(cq, includeAssumed)
+	}
+	return total
+}
+
+// CohortAdmittedWorkloads returns the number of workloads admitted in the
+// members of the cohort. Workloads that are assumed but not admitted yet are
+// only counted when includeAssumed is true.
+func (c *Cache) CohortAdmittedWorkloads(name string, includeAssumed bool) (int, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cohort, ok := c.cohorts[name]
+	if !ok {
+		return 0, errCohortNotFound
+	}
+	total := 0
+	for cq := range cohort.Members {
+		total += c.admittedWorkloadsCount(cq, includeAssumed)
+	}
+	return total, nil
+}
+
+func (c *Cache) admittedWorkloadsCount(cq *ClusterQueue, includeAssumed bool) int {
+	count := len(cq.Workloads)
+	if includeAssumed {
+		return count
+	}
+	for k := range cq.Workloads {
+		if assumedCQ, ok := c.assumedWorkloads[k]; ok && assumedCQ == cq.Name {
+			count--
+		}
+	}
+	return count
 }
 
 func (c *Cache) UpdateWorkload(oldWl, newWl *kueue.Workload) error {
+	released, err := c.updateWorkload(oldWl, newWl)
+	if err != nil {
+		return err
+	}
+	return c.releaseExternalQuota(released)
+}
+
+// updateWorkload updates the workload in the cache and returns the usage to
+// release in the external quota service, if the workload is no longer
+// admitted.
+func (c *Cache) updateWorkload(oldWl, newWl *kueue.Workload) (FlavorResourceQuantities, error) {
 	c.Lock()
 	defer c.Unlock()
+	var oldInfo *workload.Info
 	if workload.IsAdmitted(oldWl) {
 		cq, ok := c.clusterQueues[string(oldWl.Status.Admission.ClusterQueue)]
 		if !ok {
-			return fmt.Errorf("old ClusterQueue doesn't exist")
+			return nil, fmt.Errorf("old ClusterQueue doesn't exist")
 		}
+		oldInfo = cq.Workloads[workload.Key(oldWl)]
 		cq.deleteWorkload(oldWl)
 	}
 	c.cleanupAssumedState(oldWl)
 
 	if !workload.IsAdmitted(newWl) {
-		return nil
+		delete(c.admissionTimes, workload.Key(oldWl))
+		return c.externalUsage(oldInfo), nil
 	}
 	cq, ok := c.clusterQueues[string(newWl.Status.Admission.ClusterQueue)]
 	if !ok {
-		return fmt.Errorf("new ClusterQueue doesn't exist")
+		return nil, fmt.Errorf("new ClusterQueue doesn't exist")
 	}
+	c.admitPendingWorkload(workload.Key(newWl), cq.Name)
 	if c.podsReadyTracking {
 		c.podsReadyCond.Broadcast()
 	}
-	return cq.addWorkload(newWl)
+	if err := cq.addWorkload(newWl); err != nil {
+		return nil, err
+	}
+	c.recordAdmissionTime(newWl)
+	return nil, nil
+}
+
+// MoveWorkload transfers the cached workload from one ClusterQueue to another,
+// moving its usage along, without requiring the old and new workload objects.
+// The destination must admit the workload as AssumeWorkload would: within
+// its size bounds, below its concurrency limit and with enough quota. If the
+// move fails, the workload stays in the source ClusterQueue.
+func (c *Cache) MoveWorkload(wlKey string, fromCQ, toCQ string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	from, ok := c.clusterQueues[fromCQ]
+	if !ok {
+		return fmt.Errorf("source %w", errCqNotFound)
+	}
+	to, ok := c.clusterQueues[toCQ]
+	if !ok {
+		return fmt.Errorf("destination %w", errCqNotFound)
+	}
+	wi, ok := from.Workloads[wlKey]
+	if !ok {
+		return ErrWorkloadNotFound
+	}
+	if _, exist := to.Workloads[wlKey]; exist {
+		return errWorkloadAlreadyExists
+	}
+	if to.atConcurrencyLimit() {
+		return errConcurrencyLimitReached
+	}
+	moved := wi.Obj.DeepCopy()
+	if moved.Status.Admission != nil {
+		moved.Status.Admission.ClusterQueue = kueue.ClusterQueueReference(toCQ)
+	}
+	movedInfo := to.newWorkloadInfo(moved)
+	if err := to.checkWorkloadSize(movedInfo); err != nil {
+		return err
+	}
+
+	checks := from.admissionChecks[wlKey]
+	restore := func() {
+		_ = from.addWorkloadInfo(wi)
+		if checks != nil {
+			from.admissionChecks[wlKey] = checks
+		}
+	}
+	from.deleteWorkload(wi.Obj)
+	// The usage in the source is released first, as both ClusterQueues can
+	// share quota in the same cohort.
+	if !to.fits(movedInfo) {
+		restore()
+		return errWorkloadDoesntFit
+	}
+	if err := to.addWorkloadInfo(movedInfo); err != nil {
+		restore()
+		return err
+	}
+	if checks != nil {
+		if to.admissionChecks == nil {
+			to.admissionChecks = make(map[string]map[string]AdmissionCheckState)
+		}
+		to.admissionChecks[wlKey] = checks
+	}
+
+	if _, assumed := c.assumedWorkloads[wlKey]; assumed {
+		c.assumedWorkloads[wlKey] = toCQ
+	}
+	return nil
 }
 
 func (c *Cache) DeleteWorkload(w *kueue.Workload) error {
+	released, err := c.deleteWorkload(w)
+	if err != nil {
+		return err
+	}
+	return c.releaseExternalQuota(released)
+}
+
+func (c *Cache) deleteWorkload(w *kueue.Workload) (FlavorResourceQuantities, error) {
 	c.Lock()
 	defer c.Unlock()
 
+	c.clearPreemptions(workload.Key(w))
 	cq := c.clusterQueueForWorkload(w)
 	if cq == nil {
-		return errCqNotFound
+		return nil, errCqNotFound
 	}
 
 	c.cleanupAssumedState(w)
 
+	wi := cq.Workloads[workload.Key(w)]
 	cq.deleteWorkload(w)
+	delete(c.admissionTimes, workload.Key(w))
 	if c.podsReadyTracking {
 		c.podsReadyCond.Broadcast()
 	}
-	return nil
+	return c.externalUsage(wi), nil
+}
+
+// EvictWorkload releases the usage of the admitted or assumed workload with
+// the given key, records the reason as why it isn't admitted, retrievable
+// with InadmissibleReason, and counts the eviction in its ClusterQueue. If
+// its LocalQueue is known, the workload is tracked as pending again. It
+// returns ErrWorkloadNotFound if the workload is not in the cache.
+func (c *Cache) EvictWorkload(wlKey, reason string) error {
+	released, err := c.evictWorkload(wlKey, reason)
+	if err != nil {
+		return err
+	}
+	return c.releaseExternalQuota(released)
+}
+
+func (c *Cache) evictWorkload(wlKey, reason string) (FlavorResourceQuantities, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	var cq *ClusterQueue
+	for _, candidate := range c.clusterQueues {
+		if _, ok := candidate.Workloads[wlKey]; ok {
+			cq = candidate
+			break
+		}
+	}
+	if cq == nil {
+		return nil, ErrWorkloadNotFound
+	}
+	wi := cq.Workloads[wlKey]
+	c.cleanupAssumedState(wi.Obj)
+	cq.deleteWorkload(wi.Obj)
+	delete(c.admissionTimes, wlKey)
+	cq.evictedWorkloads++
+	if c.inadmissibleReasons == nil {
+		c.inadmissibleReasons = make(map[string]string)
+	}
+	c.inadmissibleReasons[wlKey] = reason
+	if qKey := workload.QueueKey(wi.Obj); cq.localQueues[qKey] != nil {
+		cq.pendingWorkloads[wlKey] = pendingWorkload{localQueue: qKey, priority: priority.Priority(wi.Obj), firstSeen: c.clock.Now()}
+	}
+	if c.podsReadyTracking {
+		c.podsReadyCond.Broadcast()
+	}
+	return c.externalUsage(wi), nil
+}
+
+// EvictedWorkloadsCount returns the number of workloads evicted from the
+// ClusterQueue with EvictWorkload.
+func (c *Cache) EvictedWorkloadsCount(cqName string) (int, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return 0, errCqNotFound
+	}
+	return cq.evictedWorkloads, nil
+}
+
+// WorkloadInfo returns a copy of the cached information of the workload with
+// the given key, either admitted or assumed, along with the name of its
+// ClusterQueue.
+func (c *Cache) WorkloadInfo(key string) (*workload.Info, string, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	if cqName, assumed := c.assumedWorkloads[key]; assumed {
+		if cq, ok := c.clusterQueues[cqName]; ok {
+			if wi, ok := cq.Workloads[key]; ok {
+				return wi.DeepCopy(), cqName, true
+			}
+		}
+	}
+	for _, cq := range c.clusterQueues {
+		if wi, ok := cq.Workloads[key]; ok {
+			return wi.DeepCopy(), cq.Name, true
+		}
+	}
+	return nil, "", false
+}
+
+// PodSetUsage returns the quota used by each podSet of the admitted or assumed
+// workload with the given key, per flavor and resource.
+func (c *Cache) PodSetUsage(wlKey string) (map[string]FlavorResourceQuantities, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	for _, cq := range c.clusterQueues {
+		wi, ok := cq.Workloads[wlKey]
+		if !ok {
+			continue
+		}
+		usage := make(map[string]FlavorResourceQuantities, len(wi.TotalRequests))
+		for _, ps := range wi.TotalRequests {
+			psUsage := make(FlavorResourceQuantities)
+			for rName, fName := range ps.Flavors {
+				if v, ok := ps.Requests[rName]; ok {
+					addQuantity(psUsage, fName, rName, v)
+				}
+			}
+			usage[ps.Name] = psUsage
+		}
+		return usage, nil
+	}
+	return nil, ErrWorkloadNotFound
 }
 
 func (c *Cache) IsAssumedOrAdmittedWorkload(w workload.Info) bool {
@@ -468,54 +1748,221 @@ func (c *Cache) IsAssumedOrAdmittedWorkload(w workload.Info) bool {
 	return false
 }
 
+// AssumeWorkload adds the admitted workload to the cache as assumed. The
+// external quota, if any, is consumed before the workload is added, without
+// holding the lock, and released again if the workload can't be added.
 func (c *Cache) AssumeWorkload(w *kueue.Workload) error {
+	wi, err := c.assumableWorkload(w)
+	if err != nil {
+		return err
+	}
+	usage := c.externalUsage(wi)
+	if err := c.consumeExternalQuota(usage); err != nil {
+		return err
+	}
+	if err := c.assumeWorkloadInfo(wi); err != nil {
+		// Best effort, the workload is not assumed anyway.
+		_ = c.releaseExternalQuota(usage)
+		return err
+	}
+	return nil
+}
+
+// assumableWorkload returns the info of the workload in the ClusterQueue of
+// its admission, if it can be assumed.
+func (c *Cache) assumableWorkload(w *kueue.Workload) (*workload.Info, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, err := c.validateAssume(w)
+	if err != nil {
+		return nil, err
+	}
+	return cq.newWorkloadInfo(w), nil
+}
+
+func (c *Cache) assumeWorkloadInfo(wi *workload.Info) error {
 	c.Lock()
 	defer c.Unlock()
 
+	// The state might have changed since the workload was validated, while
+	// the lock wasn't held.
+	cq, err := c.validateAssume(wi.Obj)
+	if err != nil {
+		return err
+	}
+	if err := cq.addWorkloadInfo(wi); err != nil {
+		return err
+	}
+	c.markAssumed(wi.Obj, cq.Name)
+	return nil
+}
+
+// validateAssume returns the ClusterQueue of the workload's admission if the
+// workload can be assumed in it. It must be called with the lock held.
+func (c *Cache) validateAssume(w *kueue.Workload) (*ClusterQueue, error) {
 	if !workload.IsAdmitted(w) {
-		return errWorkloadNotAdmitted
+		return nil, errWorkloadNotAdmitted
 	}
 
 	k := workload.Key(w)
 	assumedCq, assumed := c.assumedWorkloads[k]
 	if assumed {
-		return fmt.Errorf("the workload is already assumed to ClusterQueue %q", assumedCq)
+		return nil, fmt.Errorf("the workload is already assumed to ClusterQueue %q", assumedCq)
 	}
 
 	cq, ok := c.clusterQueues[string(w.Status.Admission.ClusterQueue)]
 	if !ok {
-		return errCqNotFound
+		return nil, errCqNotFound
+	}
+	if _, exist := cq.Workloads[k]; exist {
+		return nil, errWorkloadAlreadyExists
 	}
+	if cq.atConcurrencyLimit() {
+		return nil, errConcurrencyLimitReached
+	}
+	// The usage of all the podSets is computed and validated before any of it
+	// is applied, so that a failure doesn't leave partial usage behind.
+	if err := cq.validatePodSetAssignments(w); err != nil {
+		return nil, err
+	}
+	return cq, nil
+}
 
-	if err := cq.addWorkload(w); err != nil {
+// markAssumed records the workload, already added to the ClusterQueue, as
+// assumed.
+func (c *Cache) markAssumed(w *kueue.Workload, cqName string) {
+	k := workload.Key(w)
+	c.assumedWorkloads[k] = cqName
+	c.admitPendingWorkload(k, cqName)
+	delete(c.inadmissibleReasons, k)
+	c.recordAdmissionTime(w)
+	c.reportAssumedWorkloads()
+}
+
+func (c *Cache) ForgetWorkload(w *kueue.Workload) error {
+	released, err := c.forgetWorkload(w)
+	if err != nil {
 		return err
 	}
-	c.assumedWorkloads[k] = string(w.Status.Admission.ClusterQueue)
-	return nil
+	return c.releaseExternalQuota(released)
 }
 
-func (c *Cache) ForgetWorkload(w *kueue.Workload) error {
+func (c *Cache) forgetWorkload(w *kueue.Workload) (FlavorResourceQuantities, error) {
 	c.Lock()
 	defer c.Unlock()
 
 	if _, assumed := c.assumedWorkloads[workload.Key(w)]; !assumed {
-		return fmt.Errorf("the workload is not assumed")
+		return nil, fmt.Errorf("the workload is not assumed")
 	}
 	c.cleanupAssumedState(w)
 
 	if !workload.IsAdmitted(w) {
-		return errWorkloadNotAdmitted
+		return nil, errWorkloadNotAdmitted
 	}
 
 	cq, ok := c.clusterQueues[string(w.Status.Admission.ClusterQueue)]
 	if !ok {
-		return errCqNotFound
+		return nil, errCqNotFound
 	}
+	wi := cq.Workloads[workload.Key(w)]
 	cq.deleteWorkload(w)
+	delete(c.admissionTimes, workload.Key(w))
 	if c.podsReadyTracking {
 		c.podsReadyCond.Broadcast()
 	}
-	return nil
+	return c.externalUsage(wi), nil
+}
+
+// ForgetAllAssumed forgets all the assumed workloads, releasing their usage,
+// and returns their keys, sorted. Releasing the external quota is best effort,
+// as the workloads are forgotten regardless.
+func (c *Cache) ForgetAllAssumed() []string {
+	keys, usages := c.forgetAllAssumed()
+	for _, usage := range usages {
+		_ = c.releaseExternalQuota(usage)
+	}
+	return keys
+}
+
+func (c *Cache) forgetAllAssumed() ([]string, []FlavorResourceQuantities) {
+	c.Lock()
+	defer c.Unlock()
+
+	var usages []FlavorResourceQuantities
+	keys := make([]string, 0, len(c.assumedWorkloads))
+	for k, cqName := range c.assumedWorkloads {
+		keys = append(keys, k)
+		cq, ok := c.clusterQueues[cqName]
+		if !ok {
+			continue
+		}
+		wi, ok := cq.Workloads[k]
+		if !ok {
+			continue
+		}
+		cq.deleteWorkload(wi.Obj)
+		delete(c.admissionTimes, k)
+		if usage := c.externalUsage(wi); usage != nil {
+			usages = append(usages, usage)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return keys, nil
+	}
+	c.assumedWorkloads = make(map[string]string)
+	c.reportAssumedWorkloads()
+	if c.podsReadyTracking {
+		c.podsReadyCond.Broadcast()
+	}
+	return keys, usages
+}
+
+// IsGangPending returns whether the cached workload is a gang, as marked by
+// GangAnnotation, whose usage is withheld until all its pods are ready.
+func (c *Cache) IsGangPending(wlKey string) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	for _, cq := range c.clusterQueues {
+		if wi, ok := cq.Workloads[wlKey]; ok {
+			return isGangPending(wi.Obj)
+		}
+	}
+	return false
+}
+
+// WorkloadAdmissionAge returns how long ago the admitted or assumed workload
+// was admitted, based on the Admitted condition or, if it's not populated,
+// the time when the cache first saw the workload admitted.
+func (c *Cache) WorkloadAdmissionAge(wlKey string) (time.Duration, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	for _, cq := range c.clusterQueues {
+		if _, ok := cq.Workloads[wlKey]; ok {
+			admittedAt, ok := c.admissionTimes[wlKey]
+			if !ok {
+				return 0, errWorkloadNotAdmitted
+			}
+			return c.clock.Since(admittedAt), nil
+		}
+	}
+	return 0, errWorkloadNotAdmitted
+}
+
+// recordAdmissionTime stores the admission time of the workload, unless it's
+// already known.
+func (c *Cache) recordAdmissionTime(w *kueue.Workload) {
+	k := workload.Key(w)
+	if _, ok := c.admissionTimes[k]; ok {
+		return
+	}
+	if c.admissionTimes == nil {
+		c.admissionTimes = make(map[string]time.Time)
+	}
+	c.admissionTimes[k] = admissionTime(w, c.clock.Now())
 }
 
 // Usage reports the used resources and number of workloads admitted by the ClusterQueue.
@@ -561,6 +2008,138 @@ func (c *Cache) Usage(cqObj *kueue.ClusterQueue) ([]kueue.FlavorUsage, int, erro
 	return usage, len(cq.Workloads), nil
 }
 
+// IsBorrowing returns whether the ClusterQueue uses more than its nominal
+// quota of any resource in any flavor, consuming capacity of its cohort.
+// A ClusterQueue without a cohort never borrows.
+func (c *Cache) IsBorrowing(cqName string) (bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return false, errCqNotFound
+	}
+	return cq.IsBorrowing(), nil
+}
+
+// UnknownFlavorUsage returns the usage of the ClusterQueue in the flavors and
+// resources that it doesn't have quota for, like the flavors removed from its
+// spec that admitted workloads still use.
+func (c *Cache) UnknownFlavorUsage(cqName string) (FlavorResourceQuantities, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	unknown := make(FlavorResourceQuantities)
+	for fName, resUsage := range cq.Usage {
+		for rName, used := range resUsage {
+			if cq.resourceQuota(fName, rName) != nil {
+				continue
+			}
+			if unknown[fName] == nil {
+				unknown[fName] = make(map[corev1.ResourceName]int64)
+			}
+			unknown[fName][rName] = used
+		}
+	}
+	return unknown, nil
+}
+
+// NoNominalQuotaRatio is the utilization reported by FlavorFragmentation for
+// the flavors where the ClusterQueue has no nominal quota and can only borrow.
+const NoNominalQuotaRatio = -1
+
+// FlavorFragmentation returns the utilization of each flavor of the
+// ClusterQueue, as the ratio between the usage and the nominal quota of its
+// most utilized resource, to spot flavors that are full while others are
+// idle. Flavors without nominal quota report NoNominalQuotaRatio.
+func (c *Cache) FlavorFragmentation(cqName string) (map[string]float64, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	ratios := make(map[string]float64)
+	for _, rg := range cq.ResourceGroups {
+		for _, flvQuotas := range rg.Flavors {
+			ratio := float64(NoNominalQuotaRatio)
+			for rName, rQuota := range flvQuotas.Resources {
+				if rQuota.Nominal == 0 {
+					continue
+				}
+				if r := float64(cq.Usage[flvQuotas.Name][rName]) / float64(rQuota.Nominal); r > ratio {
+					ratio = r
+				}
+			}
+			ratios[string(flvQuotas.Name)] = ratio
+		}
+	}
+	return ratios, nil
+}
+
+// OverCommitRatio returns, for each flavor of the ClusterQueue, the ratio
+// between the usage and the nominal quota of its most committed resource.
+// Unlike FlavorFragmentation, the ratio is not clamped at 1, so values above 1
+// show that the flavor is borrowed from the cohort. A used resource without
+// nominal quota makes the ratio of its flavor +Inf.
+func (c *Cache) OverCommitRatio(cqName string) (map[string]float64, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	ratios := make(map[string]float64)
+	for _, rg := range cq.ResourceGroups {
+		for _, flvQuotas := range rg.Flavors {
+			var flvRatio float64
+			for rName, rQuota := range flvQuotas.Resources {
+				used := cq.Usage[flvQuotas.Name][rName]
+				ratio := float64(0)
+				switch {
+				case rQuota.Nominal > 0:
+					ratio = float64(used) / float64(rQuota.Nominal)
+				case used > 0:
+					ratio = math.Inf(1)
+				}
+				if ratio > flvRatio {
+					flvRatio = ratio
+				}
+			}
+			ratios[string(flvQuotas.Name)] = flvRatio
+		}
+	}
+	return ratios, nil
+}
+
+// ValidateStoredUsage returns the keys of the workloads admitted by the
+// ClusterQueue whose cached usage differs from the usage computed from their
+// current admission, which indicates a stale cached footprint.
+func (c *Cache) ValidateStoredUsage(cqName string) ([]string, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	var stale []string
+	for k, wi := range cq.Workloads {
+		fresh := cq.newWorkloadInfo(wi.Obj)
+		if !equalUsage(workloadUsage(wi), workloadUsage(fresh)) {
+			stale = append(stale, k)
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
 func (c *Cache) LocalQueueUsage(qObj *kueue.LocalQueue) ([]kueue.LocalQueueFlavorUsage, error) {
 	c.RLock()
 	defer c.RUnlock()
@@ -598,6 +2177,56 @@ func (c *Cache) LocalQueueUsage(qObj *kueue.LocalQueue) ([]kueue.LocalQueueFlavo
 	return qFlvUsages, nil
 }
 
+// LocalQueueWorkloads returns copies of the admitted workloads that were
+// submitted to the LocalQueue, sorted by key.
+func (c *Cache) LocalQueueWorkloads(qObj *kueue.LocalQueue) ([]*workload.Info, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cqImpl, ok := c.clusterQueues[string(qObj.Spec.ClusterQueue)]
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := cqImpl.localQueues[queueKey(qObj)]; !ok {
+		return nil, errQNotFound
+	}
+	var infos []*workload.Info
+	for _, wi := range cqImpl.Workloads {
+		if workloadBelongsToLocalQueue(wi.Obj, qObj) {
+			infos = append(infos, wi.DeepCopy())
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return workload.Key(infos[i].Obj) < workload.Key(infos[j].Obj)
+	})
+	return infos, nil
+}
+
+// LocalQueuesForClusterQueue returns the keys of the LocalQueues bound to the
+// ClusterQueue, sorted.
+func (c *Cache) LocalQueuesForClusterQueue(cqName string) ([]string, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	return sortedKeys(cq.localQueues), nil
+}
+
+// LocalQueueCount returns the number of LocalQueues bound to the ClusterQueue.
+func (c *Cache) LocalQueueCount(cqName string) int {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return 0
+	}
+	return len(cq.localQueues)
+}
+
 func (c *Cache) cleanupAssumedState(w *kueue.Workload) {
 	k := workload.Key(w)
 	assumedCQName, assumed := c.assumedWorkloads[k]
@@ -610,6 +2239,7 @@ func (c *Cache) cleanupAssumedState(w *kueue.Workload) {
 			}
 		}
 		delete(c.assumedWorkloads, k)
+		c.reportAssumedWorkloads()
 	}
 }
 
@@ -633,7 +2263,11 @@ func (c *Cache) addClusterQueueToCohort(cq *ClusterQueue, cohortName string) {
 	cohort, ok := c.cohorts[cohortName]
 	if !ok {
 		cohort = newCohort(cohortName, 1)
+		cohort.BorrowCeiling = c.cohortBorrowCeilings[cohortName]
 		c.cohorts[cohortName] = cohort
+		if c.cohortHandler != nil {
+			c.cohortHandler(cohortName, true)
+		}
 	}
 	cohort.Members.Insert(cq)
 	cq.Cohort = cohort
@@ -646,6 +2280,9 @@ func (c *Cache) deleteClusterQueueFromCohort(cq *ClusterQueue) {
 	cq.Cohort.Members.Delete(cq)
 	if cq.Cohort.Members.Len() == 0 {
 		delete(c.cohorts, cq.Cohort.Name)
+		if c.cohortHandler != nil {
+			c.cohortHandler(cq.Cohort.Name, false)
+		}
 	}
 	cq.Cohort = nil
 }
@@ -663,19 +2300,108 @@ func (c *Cache) ClusterQueuesUsingFlavor(flavor string) []string {
 	return cqs
 }
 
+// FlavorsInUse returns the names of the flavors referenced by the
+// ResourceGroups of any ClusterQueue or assigned to any admitted workload,
+// even if its ClusterQueue no longer references them.
+func (c *Cache) FlavorsInUse() sets.Set[string] {
+	c.RLock()
+	defer c.RUnlock()
+
+	flavors := sets.New[string]()
+	for _, cq := range c.clusterQueues {
+		for _, rg := range cq.ResourceGroups {
+			for _, flvQuotas := range rg.Flavors {
+				flavors.Insert(string(flvQuotas.Name))
+			}
+		}
+		for _, wi := range cq.Workloads {
+			for _, ps := range wi.TotalRequests {
+				for _, fName := range ps.Flavors {
+					flavors.Insert(string(fName))
+				}
+			}
+		}
+	}
+	return flavors
+}
+
+// FlavorCount returns the number of distinct flavors referenced by the
+// ResourceGroups of the ClusterQueue.
+func (c *Cache) FlavorCount(cqName string) (int, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return 0, errCqNotFound
+	}
+	flavors := sets.New[kueue.ResourceFlavorReference]()
+	for _, rg := range cq.ResourceGroups {
+		for _, flvQuotas := range rg.Flavors {
+			flavors.Insert(flvQuotas.Name)
+		}
+	}
+	return flavors.Len(), nil
+}
+
+// FlavorOrder returns the names of the flavors that provide quota for the
+// resource in the ClusterQueue, in the order of preference listed in its
+// ResourceGroup, with the default flavors last.
+func (c *Cache) FlavorOrder(cqName string, resource corev1.ResourceName) ([]string, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	rg := cq.RGByResource[resource]
+	if rg == nil {
+		return nil, nil
+	}
+	flavors := make([]string, 0, len(rg.Flavors))
+	for _, flvQuotas := range rg.OrderedFlavors() {
+		flavors = append(flavors, string(flvQuotas.Name))
+	}
+	return flavors, nil
+}
+
 func (c *Cache) MatchingClusterQueues(nsLabels map[string]string) sets.Set[string] {
 	c.RLock()
 	defer c.RUnlock()
+	return c.matchingClusterQueues(nsLabels)
+}
 
+func (c *Cache) matchingClusterQueues(nsLabels map[string]string) sets.Set[string] {
 	cqs := sets.New[string]()
 	for _, cq := range c.clusterQueues {
-		if cq.NamespaceSelector.Matches(labels.Set(nsLabels)) {
+		if !cq.held && cq.NamespaceSelector.Matches(labels.Set(nsLabels)) {
 			cqs.Insert(cq.Name)
 		}
 	}
 	return cqs
 }
 
+// FindClusterQueuesForWorkload returns the active ClusterQueues, sorted by
+// name, whose namespaceSelector matches the namespace labels, like in
+// MatchingClusterQueues, and that have flavors for all the resources
+// requested by the workload, to route workloads that don't target a queue.
+// Whether the quota is enough is not considered.
+func (c *Cache) FindClusterQueuesForWorkload(nsLabels map[string]string, wl *workload.Info) []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	var found []string
+	for cqName := range c.matchingClusterQueues(nsLabels) {
+		cq := c.clusterQueues[cqName]
+		if cq.Active() && cq.coversRequests(wl) {
+			found = append(found, cqName)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
 // Key is the key used to index the queue.
 func queueKey(q *kueue.LocalQueue) string {
 	return fmt.Sprintf("%s/%s", q.Namespace, q.Name)
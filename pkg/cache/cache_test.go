@@ -18,8 +18,11 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -29,6 +32,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -324,7 +330,7 @@ func TestCacheClusterQueueOperations(t *testing.T) {
 						Obj(),
 				}
 				for _, c := range clusterQueues {
-					if err := cache.UpdateClusterQueue(&c); err != nil {
+					if _, err := cache.UpdateClusterQueue(&c); err != nil {
 						t.Fatalf("Failed updating ClusterQueue: %v", err)
 					}
 				}
@@ -692,6 +698,253 @@ func TestCacheClusterQueueOperations(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("batch add matches sequential add", func(t *testing.T) {
+		sequential := New(utiltesting.NewFakeClient())
+		setup(sequential)
+
+		batch := New(utiltesting.NewFakeClient())
+		batch.AddOrUpdateResourceFlavor(
+			utiltesting.MakeResourceFlavor("default").
+				Label("cpuType", "default").
+				Obj())
+		cqs := make([]*kueue.ClusterQueue, 0, len(initialClusterQueues)+1)
+		for i := range initialClusterQueues {
+			cqs = append(cqs, &initialClusterQueues[i])
+		}
+		cqs = append(cqs, &initialClusterQueues[0])
+		gotErrs := batch.AddClusterQueues(context.Background(), cqs)
+		gotErrMsgs := make([]string, len(gotErrs))
+		for i, err := range gotErrs {
+			gotErrMsgs[i] = messageOrEmpty(err)
+		}
+		wantErrMsgs := []string{"", "", "", "", "", "ClusterQueue already exists"}
+		if diff := cmp.Diff(wantErrMsgs, gotErrMsgs); diff != "" {
+			t.Errorf("Unexpected errors (-want,+got):\n%s", diff)
+		}
+		if diff := cmp.Diff(sequential.clusterQueues, batch.clusterQueues,
+			cmpopts.IgnoreFields(ClusterQueue{}, "Cohort", "Workloads", "RGByResource"),
+			cmpopts.IgnoreUnexported(ClusterQueue{}),
+			cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("Unexpected clusterQueues (-sequential,+batch):\n%s", diff)
+		}
+		cohortMembers := func(cache *Cache) map[string]sets.Set[string] {
+			members := make(map[string]sets.Set[string], len(cache.cohorts))
+			for name, cohort := range cache.cohorts {
+				members[name] = sets.New[string]()
+				for cq := range cohort.Members {
+					members[name].Insert(cq.Name)
+				}
+			}
+			return members
+		}
+		if diff := cmp.Diff(cohortMembers(sequential), cohortMembers(batch)); diff != "" {
+			t.Errorf("Unexpected cohorts (-sequential,+batch):\n%s", diff)
+		}
+	})
+}
+
+func TestAddOrUpdateResourceFlavorChanges(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "15").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("c").Obj(),
+		utiltesting.MakeClusterQueue("e").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("nonexistent-flavor").Resource(corev1.ResourceCPU, "15").Obj()).
+			Obj(),
+	}
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Failed adding ClusterQueue: %v", err)
+		}
+	}
+
+	steps := []struct {
+		name          string
+		flavor        *kueue.ResourceFlavor
+		wantChanged   bool
+		wantCQs       sets.Set[string]
+		wantLabelKeys sets.Set[string]
+	}{
+		{
+			name:          "new flavor activates its ClusterQueues",
+			flavor:        utiltesting.MakeResourceFlavor("default").Label("cpuType", "default").Obj(),
+			wantChanged:   true,
+			wantCQs:       sets.New("a", "b"),
+			wantLabelKeys: sets.New("cpuType"),
+		},
+		{
+			name:          "same flavor",
+			flavor:        utiltesting.MakeResourceFlavor("default").Label("cpuType", "default").Obj(),
+			wantLabelKeys: sets.New("cpuType"),
+		},
+		{
+			name: "new label key",
+			flavor: utiltesting.MakeResourceFlavor("default").
+				Label("cpuType", "default").
+				Label("region", "central").
+				Obj(),
+			wantChanged:   true,
+			wantCQs:       sets.New("a", "b"),
+			wantLabelKeys: sets.New("cpuType", "region"),
+		},
+		{
+			name: "new label value",
+			flavor: utiltesting.MakeResourceFlavor("default").
+				Label("cpuType", "default").
+				Label("region", "east").
+				Obj(),
+			wantChanged:   true,
+			wantLabelKeys: sets.New("cpuType", "region"),
+		},
+		{
+			name:          "flavor of another ClusterQueue",
+			flavor:        utiltesting.MakeResourceFlavor("nonexistent-flavor").Obj(),
+			wantChanged:   true,
+			wantCQs:       sets.New("e"),
+			wantLabelKeys: sets.New("cpuType", "region"),
+		},
+	}
+	for _, step := range steps {
+		changed, cqs := cache.AddOrUpdateResourceFlavor(step.flavor)
+		if changed != step.wantChanged {
+			t.Errorf("%s: got changed %t, want %t", step.name, changed, step.wantChanged)
+		}
+		if diff := cmp.Diff(step.wantCQs, cqs, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("%s: unexpected ClusterQueues (-want,+got):\n%s", step.name, diff)
+		}
+		if diff := cmp.Diff(step.wantLabelKeys, cache.clusterQueues["a"].ResourceGroups[0].LabelKeys); diff != "" {
+			t.Errorf("%s: unexpected label keys (-want,+got):\n%s", step.name, diff)
+		}
+	}
+}
+
+func BenchmarkAddClusterQueues(b *testing.B) {
+	cqs := make([]*kueue.ClusterQueue, 500)
+	for i := range cqs {
+		cqs[i] = utiltesting.MakeClusterQueue(fmt.Sprintf("cq-%d", i)).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort(fmt.Sprintf("cohort-%d", i%10)).
+			Obj()
+	}
+	ctx := context.Background()
+	cl := utiltesting.NewFakeClient()
+	newCache := func() *Cache {
+		cache := New(cl)
+		cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+		return cache
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			cache := newCache()
+			for _, cq := range cqs {
+				if err := cache.AddClusterQueue(ctx, cq); err != nil {
+					b.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			cache := newCache()
+			for _, err := range cache.AddClusterQueues(ctx, cqs) {
+				if err != nil {
+					b.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+		}
+	})
+}
+
+func TestUsageDelta(t *testing.T) {
+	podSets := []kueue.PodSet{
+		*utiltesting.MakePodSet("driver", 1).
+			Request(corev1.ResourceCPU, "10m").
+			Request(corev1.ResourceMemory, "512Ki").
+			Obj(),
+		*utiltesting.MakePodSet("workers", 3).
+			Request(corev1.ResourceCPU, "5m").
+			Obj(),
+	}
+	podSetFlavors := []kueue.PodSetAssignment{
+		{
+			Name: "driver",
+			Flavors: map[corev1.ResourceName]kueue.ResourceFlavorReference{
+				corev1.ResourceCPU: "on-demand",
+			},
+			ResourceUsage: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("10m"),
+			},
+		},
+		{
+			Name: "workers",
+			Flavors: map[corev1.ResourceName]kueue.ResourceFlavorReference{
+				corev1.ResourceCPU: "spot",
+			},
+			ResourceUsage: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("15m"),
+			},
+		},
+	}
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), utiltesting.MakeClusterQueue("one").
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU).Obj(),
+			*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU).Obj(),
+		).
+		Obj()); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+
+	cases := map[string]struct {
+		wl   *kueue.Workload
+		want FlavorResourceQuantities
+	}{
+		"driver and workers": {
+			wl: utiltesting.MakeWorkload("a", "").PodSets(podSets...).Admit(&kueue.Admission{
+				ClusterQueue:      "one",
+				PodSetAssignments: podSetFlavors,
+			}).Obj(),
+			want: FlavorResourceQuantities{
+				"on-demand": {corev1.ResourceCPU: 10},
+				"spot":      {corev1.ResourceCPU: 15},
+			},
+		},
+		"unknown clusterQueue": {
+			wl: utiltesting.MakeWorkload("a", "").PodSets(podSets...).Admit(&kueue.Admission{
+				ClusterQueue:      "two",
+				PodSetAssignments: podSetFlavors,
+			}).Obj(),
+			want: FlavorResourceQuantities{
+				"on-demand": {corev1.ResourceCPU: 10},
+				"spot":      {corev1.ResourceCPU: 15},
+			},
+		},
+		"no admission": {
+			wl:   utiltesting.MakeWorkload("a", "").PodSets(podSets...).Obj(),
+			want: FlavorResourceQuantities{},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := cache.UsageDelta(workload.NewInfo(tc.wl))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected delta (-want,+got):\n%s", diff)
+			}
+			if used := cache.clusterQueues["one"].Usage; !equalUsage(used, FlavorResourceQuantities{
+				"on-demand": {corev1.ResourceCPU: 0},
+				"spot":      {corev1.ResourceCPU: 0},
+			}) {
+				t.Errorf("The cache usage changed: %v", used)
+			}
+		})
+	}
 }
 
 func TestCacheWorkloadOperations(t *testing.T) {
@@ -1313,6 +1566,66 @@ func TestCacheWorkloadOperations(t *testing.T) {
 	}
 }
 
+func TestAdmittedWorkloadsCount(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU).Obj()).
+			Cohort("cohort").
+			Obj(),
+		utiltesting.MakeClusterQueue("two").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU).Obj()).
+			Obj(),
+	}
+	cl := utiltesting.NewFakeClient(
+		utiltesting.MakeWorkload("a", "").Admit(utiltesting.MakeAdmission("one").Obj()).Obj(),
+		utiltesting.MakeWorkload("b", "").Admit(utiltesting.MakeAdmission("one").Obj()).Obj(),
+		utiltesting.MakeWorkload("c", "").Admit(utiltesting.MakeAdmission("two").Obj()).Obj(),
+	)
+	cache := New(cl)
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Failed adding clusterQueue: %v", err)
+		}
+	}
+	assumed := utiltesting.MakeWorkload("d", "").Admit(utiltesting.MakeAdmission("one").Obj()).Obj()
+	if err := cache.AssumeWorkload(assumed); err != nil {
+		t.Fatalf("Failed assuming workload: %v", err)
+	}
+
+	cases := map[string]struct {
+		includeAssumed bool
+		wantTotal      int
+		wantCohort     int
+	}{
+		"without assumed workloads": {
+			wantTotal:  3,
+			wantCohort: 2,
+		},
+		"with assumed workloads": {
+			includeAssumed: true,
+			wantTotal:      4,
+			wantCohort:     3,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := cache.TotalAdmittedWorkloads(tc.includeAssumed); got != tc.wantTotal {
+				t.Errorf("TotalAdmittedWorkloads() = %d, want %d", got, tc.wantTotal)
+			}
+			got, err := cache.CohortAdmittedWorkloads("cohort", tc.includeAssumed)
+			if err != nil {
+				t.Fatalf("CohortAdmittedWorkloads() failed: %v", err)
+			}
+			if got != tc.wantCohort {
+				t.Errorf("CohortAdmittedWorkloads() = %d, want %d", got, tc.wantCohort)
+			}
+		})
+	}
+	if _, err := cache.CohortAdmittedWorkloads("nonexistent", false); err != errCohortNotFound {
+		t.Errorf("CohortAdmittedWorkloads() for unknown cohort returned error %v, want %v", err, errCohortNotFound)
+	}
+}
+
 func TestClusterQueueUsage(t *testing.T) {
 	cq := utiltesting.MakeClusterQueue("foo").
 		ResourceGroup(
@@ -1355,6 +1668,7 @@ func TestClusterQueueUsage(t *testing.T) {
 		workloads         []kueue.Workload
 		wantUsedResources []kueue.FlavorUsage
 		wantWorkloads     int
+		wantBorrowing     bool
 	}{
 		"clusterQueue without cohort; single no borrowing": {
 			clusterQueue: cqWithOutCohort,
@@ -1428,6 +1742,7 @@ func TestClusterQueueUsage(t *testing.T) {
 				},
 			},
 			wantWorkloads: 2,
+			wantBorrowing: true,
 		},
 		"clusterQueue without cohort; multiple borrowing": {
 			clusterQueue: cqWithOutCohort,
@@ -1491,6 +1806,163 @@ func TestClusterQueueUsage(t *testing.T) {
 			if workloads != tc.wantWorkloads {
 				t.Errorf("Got %d workloads, want %d", workloads, tc.wantWorkloads)
 			}
+			borrowing, err := cache.IsBorrowing(tc.clusterQueue.Name)
+			if err != nil {
+				t.Fatalf("Couldn't get whether the clusterQueue is borrowing: %v", err)
+			}
+			if borrowing != tc.wantBorrowing {
+				t.Errorf("Got borrowing %t, want %t", borrowing, tc.wantBorrowing)
+			}
+		})
+	}
+}
+
+func TestFlavorFragmentation(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10", "10").
+				Obj(),
+		).
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("model_a").
+				Resource("example.com/gpu", "5", "5").
+				Obj(),
+			*utiltesting.MakeFlavorQuotas("model_b").
+				Resource("example.com/gpu", "5").
+				Obj(),
+			*utiltesting.MakeFlavorQuotas("model_c").
+				Resource("example.com/gpu", "0").
+				Obj(),
+		).
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("interconnect_a").
+				Resource("example.com/vf-0", "5", "5").
+				Resource("example.com/vf-1", "5", "5").
+				Obj(),
+		).
+		Cohort("one").Obj()
+	workloads := []*kueue.Workload{
+		utiltesting.MakeWorkload("one", "").
+			Request(corev1.ResourceCPU, "8").
+			Request("example.com/gpu", "5").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "8000m").Assignment("example.com/gpu", "model_a", "5").Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("two", "").
+			Request(corev1.ResourceCPU, "5").
+			Request("example.com/gpu", "6").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "5000m").Assignment("example.com/gpu", "model_b", "6").Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("three", "").
+			Request("example.com/vf-1", "1").
+			Admit(utiltesting.MakeAdmission("foo").Assignment("example.com/vf-1", "interconnect_a", "1").Obj()).
+			Obj(),
+	}
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	for _, wl := range workloads {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Workload %s was not added", workload.Key(wl))
+		}
+	}
+	got, err := cache.FlavorFragmentation("foo")
+	if err != nil {
+		t.Fatalf("Getting the flavor fragmentation: %v", err)
+	}
+	want := map[string]float64{
+		"default":        1.3,
+		"model_a":        1,
+		"model_b":        1.2,
+		"model_c":        NoNominalQuotaRatio,
+		"interconnect_a": 0.2,
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+		t.Errorf("Unexpected flavor fragmentation (-want,+got):\n%s", diff)
+	}
+	if _, err := cache.FlavorFragmentation("bar"); err != errCqNotFound {
+		t.Errorf("Got error %v for an unknown ClusterQueue, want %v", err, errCqNotFound)
+	}
+}
+
+func TestOverCommitRatio(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("borrower").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj()).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("model_a").
+				Resource("example.com/gpu", "0").
+				Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj()).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("model_a").
+				Resource("example.com/gpu", "4").
+				Obj()).
+			Cohort("one").
+			Obj(),
+	}
+	cache := New(utiltesting.NewFakeClient())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	wl := utiltesting.MakeWorkload("one", "").
+		Request(corev1.ResourceCPU, "15").
+		Request(corev1.ResourceMemory, "5Gi").
+		Request("example.com/gpu", "2").
+		Admit(utiltesting.MakeAdmission("borrower").
+			Assignment(corev1.ResourceCPU, "default", "15").
+			Assignment(corev1.ResourceMemory, "default", "5Gi").
+			Assignment("example.com/gpu", "model_a", "2").
+			Obj()).
+		Obj()
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatalf("Workload %s was not added", workload.Key(wl))
+	}
+
+	cases := map[string]struct {
+		cq        string
+		want      map[string]float64
+		wantError string
+	}{
+		"borrowing": {
+			cq: "borrower",
+			// The cpu is the most committed resource of the default flavor.
+			want: map[string]float64{
+				"default": 1.5,
+				"model_a": math.Inf(1),
+			},
+		},
+		"lending": {
+			cq: "lender",
+			want: map[string]float64{
+				"default": 0,
+				"model_a": 0,
+			},
+		},
+		"unknown clusterQueue": {
+			cq:        "nonexistent",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := cache.OverCommitRatio(tc.cq)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("Unexpected over-commit ratios (-want,+got):\n%s", diff)
+			}
 		})
 	}
 }
@@ -2019,6 +2491,33 @@ func TestCacheQueueOperations(t *testing.T) {
 				"ns1/gamma": cacheLocalQueuesAfterInsertingAll["ns1/gamma"],
 			},
 		},
+		"reconcile queue": {
+			ops: []func(ctx context.Context, cl client.Client, cache *Cache) error{
+				insertAllClusterQueues,
+				insertAllQueues,
+				insertAllWorkloads,
+				func(ctx context.Context, cl client.Client, cache *Cache) error {
+					q := cache.clusterQueues["foo"].localQueues["ns2/beta"]
+					q.admittedWorkloads = 5
+					q.usage["model-a"]["example.com/gpu"] = 1
+					delete(q.usage, "spot")
+					return cache.ReconcileLocalQueue(queues[1])
+				},
+			},
+			wantLocalQueues: cacheLocalQueuesAfterInsertingAll,
+		},
+		"reconcile unknown queue": {
+			ops: []func(ctx context.Context, cl client.Client, cache *Cache) error{
+				insertAllClusterQueues,
+				func(ctx context.Context, cl client.Client, cache *Cache) error {
+					if err := cache.ReconcileLocalQueue(queues[0]); err != errQNotFound {
+						return fmt.Errorf("got error %v, want %v", err, errQNotFound)
+					}
+					return nil
+				},
+			},
+			wantLocalQueues: map[string]*queue{},
+		},
 		// Not tested: changing a workload's queue and changing a queue's cluster queue.
 		// These operations should not be allowed by the webhook.
 	}
@@ -2048,25 +2547,411 @@ func TestCacheQueueOperations(t *testing.T) {
 	}
 }
 
-func TestClusterQueuesUsingFlavor(t *testing.T) {
-	x86Rf := utiltesting.MakeResourceFlavor("x86").Obj()
-	aarch64Rf := utiltesting.MakeResourceFlavor("aarch64").Obj()
-	fooCq := utiltesting.MakeClusterQueue("fooCq").
-		ResourceGroup(
-			*utiltesting.MakeFlavorQuotas("x86").Resource("cpu", "5").Obj()).
-		Obj()
-	barCq := utiltesting.MakeClusterQueue("barCq").Obj()
-	fizzCq := utiltesting.MakeClusterQueue("fizzCq").
-		ResourceGroup(
-			*utiltesting.MakeFlavorQuotas("x86").Resource("cpu", "5").Obj(),
-			*utiltesting.MakeFlavorQuotas("aarch64").Resource("cpu", "3").Obj(),
-		).
-		Obj()
-
-	tests := []struct {
-		name                       string
-		clusterQueues              []*kueue.ClusterQueue
-		wantInUseClusterQueueNames []string
+func TestLocalQueuesForClusterQueue(t *testing.T) {
+	cqs := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("foo").Obj(),
+		utiltesting.MakeClusterQueue("bar").Obj(),
+		utiltesting.MakeClusterQueue("baz").Obj(),
+	}
+	queues := []*kueue.LocalQueue{
+		utiltesting.MakeLocalQueue("beta", "ns2").ClusterQueue("foo").Obj(),
+		utiltesting.MakeLocalQueue("alpha", "ns1").ClusterQueue("foo").Obj(),
+		utiltesting.MakeLocalQueue("gamma", "ns1").ClusterQueue("bar").Obj(),
+	}
+	cache := New(utiltesting.NewFakeClient())
+	for _, cq := range cqs {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue %s: %v", cq.Name, err)
+		}
+	}
+	for _, q := range queues {
+		if err := cache.AddLocalQueue(q); err != nil {
+			t.Fatalf("Adding LocalQueue %s: %v", q.Name, err)
+		}
+	}
+
+	cases := map[string]struct {
+		cq        string
+		want      []string
+		wantCount int
+		wantErr   string
+	}{
+		"foo": {
+			cq:        "foo",
+			want:      []string{"ns1/alpha", "ns2/beta"},
+			wantCount: 2,
+		},
+		"bar": {
+			cq:        "bar",
+			want:      []string{"ns1/gamma"},
+			wantCount: 1,
+		},
+		"without LocalQueues": {
+			cq:   "baz",
+			want: []string{},
+		},
+		"unknown ClusterQueue": {
+			cq:      "qux",
+			wantErr: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := cache.LocalQueuesForClusterQueue(tc.cq)
+			if diff := cmp.Diff(tc.wantErr, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected LocalQueues (-want,+got):\n%s", diff)
+			}
+			if got := cache.LocalQueueCount(tc.cq); got != tc.wantCount {
+				t.Errorf("LocalQueueCount() = %d, want %d", got, tc.wantCount)
+			}
+		})
+	}
+}
+
+func TestLocalQueueWorkloads(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	queues := map[string]*kueue.LocalQueue{
+		"alpha": utiltesting.MakeLocalQueue("alpha", "ns1").ClusterQueue("foo").Obj(),
+		"beta":  utiltesting.MakeLocalQueue("beta", "ns2").ClusterQueue("foo").Obj(),
+		"gamma": utiltesting.MakeLocalQueue("gamma", "ns1").ClusterQueue("foo").Obj(),
+	}
+	admitted := func(name, ns, queue string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, ns).
+			Queue(queue).
+			Request(corev1.ResourceCPU, "1").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "spot", "1").Obj()).
+			Obj()
+	}
+	workloads := []*kueue.Workload{
+		admitted("job2", "ns1", "alpha"),
+		admitted("job1", "ns1", "alpha"),
+		admitted("job3", "ns2", "beta"),
+		// Same queue name in another namespace.
+		admitted("job4", "ns2", "alpha"),
+	}
+
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	for _, q := range queues {
+		if err := cache.AddLocalQueue(q); err != nil {
+			t.Fatalf("Adding LocalQueue: %v", err)
+		}
+	}
+	for _, wl := range workloads {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Workload %s was not added", wl.Name)
+		}
+	}
+
+	cases := map[string]struct {
+		queue     *kueue.LocalQueue
+		want      []string
+		wantError string
+	}{
+		"alpha": {
+			queue: queues["alpha"],
+			want:  []string{"ns1/job1", "ns1/job2"},
+		},
+		"beta": {
+			queue: queues["beta"],
+			want:  []string{"ns2/job3"},
+		},
+		"gamma without workloads": {
+			queue: queues["gamma"],
+		},
+		"unknown queue": {
+			queue:     utiltesting.MakeLocalQueue("delta", "ns1").ClusterQueue("foo").Obj(),
+			wantError: errQNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			infos, err := cache.LocalQueueWorkloads(tc.queue)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			var got []string
+			for _, wi := range infos {
+				got = append(got, workload.Key(wi.Obj))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected workloads (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStopLocalQueue(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	alpha := utiltesting.MakeLocalQueue("alpha", "ns1").ClusterQueue("foo").Obj()
+	beta := utiltesting.MakeLocalQueue("beta", "ns1").ClusterQueue("foo").Obj()
+	admitted := func(name, queue, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns1").
+			Queue(queue).
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "spot", cpu).Obj()).
+			Obj()
+	}
+	workloads := []*kueue.Workload{
+		admitted("a1", "alpha", "2"),
+		admitted("a2", "alpha", "3"),
+		admitted("b1", "beta", "1"),
+	}
+	cases := map[string]struct {
+		queue          *kueue.LocalQueue
+		releaseUsage   bool
+		deleteWorkload *kueue.Workload
+		wantError      string
+		wantUsage      FlavorResourceQuantities
+		wantQueueUsage FlavorResourceQuantities
+		wantAdmitted   int
+	}{
+		"usage released": {
+			queue:          alpha,
+			releaseUsage:   true,
+			wantUsage:      FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 1_000}},
+			wantQueueUsage: FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 0}},
+			wantAdmitted:   2,
+		},
+		"usage kept": {
+			queue:          alpha,
+			wantUsage:      FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 6_000}},
+			wantQueueUsage: FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 5_000}},
+			wantAdmitted:   2,
+		},
+		"workload of the stopped queue deleted after the release": {
+			queue:          alpha,
+			releaseUsage:   true,
+			deleteWorkload: workloads[0],
+			wantUsage:      FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 1_000}},
+			wantQueueUsage: FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 0}},
+			wantAdmitted:   1,
+		},
+		"unknown queue": {
+			queue:          utiltesting.MakeLocalQueue("gamma", "ns1").ClusterQueue("foo").Obj(),
+			releaseUsage:   true,
+			wantError:      errQNotFound.Error(),
+			wantUsage:      FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 6_000}},
+			wantQueueUsage: FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 5_000}},
+			wantAdmitted:   2,
+		},
+		"unknown clusterQueue": {
+			queue:          utiltesting.MakeLocalQueue("alpha", "ns1").ClusterQueue("bar").Obj(),
+			releaseUsage:   true,
+			wantError:      errCqNotFound.Error(),
+			wantUsage:      FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 6_000}},
+			wantQueueUsage: FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 5_000}},
+			wantAdmitted:   2,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			for _, q := range []*kueue.LocalQueue{alpha, beta} {
+				if err := cache.AddLocalQueue(q); err != nil {
+					t.Fatalf("Adding LocalQueue: %v", err)
+				}
+			}
+			for _, wl := range workloads {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", wl.Name)
+				}
+			}
+			err := cache.StopLocalQueue(tc.queue, tc.releaseUsage)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if tc.deleteWorkload != nil {
+				if err := cache.DeleteWorkload(tc.deleteWorkload); err != nil {
+					t.Fatalf("Deleting workload: %v", err)
+				}
+			}
+			cqImpl := cache.clusterQueues["foo"]
+			if diff := cmp.Diff(tc.wantUsage, cqImpl.Usage); diff != "" {
+				t.Errorf("Unexpected ClusterQueue usage (-want,+got):\n%s", diff)
+			}
+			qImpl := cqImpl.localQueues[queueKey(alpha)]
+			if diff := cmp.Diff(tc.wantQueueUsage, qImpl.usage); diff != "" {
+				t.Errorf("Unexpected LocalQueue usage (-want,+got):\n%s", diff)
+			}
+			if qImpl.admittedWorkloads != tc.wantAdmitted {
+				t.Errorf("Got %d admitted workloads in the LocalQueue, want %d", qImpl.admittedWorkloads, tc.wantAdmitted)
+			}
+		})
+	}
+}
+
+func TestEvictWorkload(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	lq := utiltesting.MakeLocalQueue("lq", "ns").ClusterQueue("foo").Obj()
+	admitted := func(name, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Queue("lq").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	cases := map[string]struct {
+		wlKey        string
+		wantError    error
+		wantUsage    int64
+		wantAssumed  map[string]string
+		wantEvicted  int
+		wantPending  int
+		wantReason   bool
+		wantWorkload []string
+	}{
+		"admitted workload": {
+			wlKey:        "ns/admitted",
+			wantUsage:    3_000,
+			wantAssumed:  map[string]string{"ns/assumed": "foo"},
+			wantEvicted:  1,
+			wantPending:  1,
+			wantReason:   true,
+			wantWorkload: []string{"ns/assumed"},
+		},
+		"assumed workload": {
+			wlKey:        "ns/assumed",
+			wantUsage:    2_000,
+			wantAssumed:  map[string]string{},
+			wantEvicted:  1,
+			wantPending:  1,
+			wantReason:   true,
+			wantWorkload: []string{"ns/admitted"},
+		},
+		"unknown workload": {
+			wlKey:        "ns/unknown",
+			wantError:    ErrWorkloadNotFound,
+			wantUsage:    5_000,
+			wantAssumed:  map[string]string{"ns/assumed": "foo"},
+			wantWorkload: []string{"ns/admitted", "ns/assumed"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			if err := cache.AddLocalQueue(lq); err != nil {
+				t.Fatalf("Adding LocalQueue: %v", err)
+			}
+			if !cache.AddOrUpdateWorkload(admitted("admitted", "2")) {
+				t.Fatal("Workload admitted was not added")
+			}
+			if err := cache.AssumeWorkload(admitted("assumed", "3")); err != nil {
+				t.Fatalf("Assuming workload: %v", err)
+			}
+
+			if err := cache.EvictWorkload(tc.wlKey, "Preempted"); !errors.Is(err, tc.wantError) {
+				t.Errorf("EvictWorkload() returned %v, want %v", err, tc.wantError)
+			}
+			cqImpl := cache.clusterQueues["foo"]
+			if used := cqImpl.Usage["default"][corev1.ResourceCPU]; used != tc.wantUsage {
+				t.Errorf("Got usage %d, want %d", used, tc.wantUsage)
+			}
+			if diff := cmp.Diff(tc.wantWorkload, sortedKeys(cqImpl.Workloads)); diff != "" {
+				t.Errorf("Unexpected workloads (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantAssumed, cache.assumedWorkloads); diff != "" {
+				t.Errorf("Unexpected assumed workloads (-want,+got):\n%s", diff)
+			}
+			evicted, err := cache.EvictedWorkloadsCount("foo")
+			if err != nil {
+				t.Fatalf("EvictedWorkloadsCount failed: %v", err)
+			}
+			if evicted != tc.wantEvicted {
+				t.Errorf("EvictedWorkloadsCount() = %d, want %d", evicted, tc.wantEvicted)
+			}
+			if pending := cache.PendingWorkloadsCount("foo"); pending != tc.wantPending {
+				t.Errorf("PendingWorkloadsCount() = %d, want %d", pending, tc.wantPending)
+			}
+			reason, found := cache.InadmissibleReason(tc.wlKey)
+			if found != tc.wantReason || (found && reason != "Preempted") {
+				t.Errorf("InadmissibleReason() = %q, %t, want \"Preempted\", %t", reason, found, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestLocalQueueDefaultPriority(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").Obj()
+	withDefault := utiltesting.MakeLocalQueue("with-default", "ns").ClusterQueue("foo").Obj()
+	withDefault.Annotations = map[string]string{DefaultPriorityAnnotation: "100"}
+	withoutDefault := utiltesting.MakeLocalQueue("without-default", "ns").ClusterQueue("foo").Obj()
+	invalid := utiltesting.MakeLocalQueue("invalid", "ns").ClusterQueue("foo").Obj()
+	invalid.Annotations = map[string]string{DefaultPriorityAnnotation: "high"}
+
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	for _, q := range []*kueue.LocalQueue{withDefault, withoutDefault} {
+		if err := cache.AddLocalQueue(q); err != nil {
+			t.Fatalf("Adding LocalQueue: %v", err)
+		}
+	}
+	err := cache.AddLocalQueue(invalid)
+	wantErr := `parsing annotation kueue.x-k8s.io/default-priority: strconv.ParseInt: parsing "high": invalid syntax`
+	if diff := cmp.Diff(wantErr, messageOrEmpty(err)); diff != "" {
+		t.Errorf("Unexpected error adding the invalid LocalQueue (-want,+got):\n%s", diff)
+	}
+
+	check := func(q *kueue.LocalQueue, wantPriority int32, wantFound bool) {
+		t.Helper()
+		p, found := cache.LocalQueueDefaultPriority(q)
+		if p != wantPriority || found != wantFound {
+			t.Errorf("LocalQueueDefaultPriority(%s) = %d, %t, want %d, %t", q.Name, p, found, wantPriority, wantFound)
+		}
+	}
+	check(withDefault, 100, true)
+	check(withoutDefault, 0, false)
+	check(invalid, 0, false)
+	check(utiltesting.MakeLocalQueue("unknown", "ns").ClusterQueue("foo").Obj(), 0, false)
+
+	// Updating the annotation changes the default priority.
+	updated := withoutDefault.DeepCopy()
+	updated.Annotations = map[string]string{DefaultPriorityAnnotation: "-5"}
+	if err := cache.UpdateLocalQueue(withoutDefault, updated); err != nil {
+		t.Fatalf("Updating LocalQueue: %v", err)
+	}
+	check(updated, -5, true)
+}
+
+func TestClusterQueuesUsingFlavor(t *testing.T) {
+	x86Rf := utiltesting.MakeResourceFlavor("x86").Obj()
+	aarch64Rf := utiltesting.MakeResourceFlavor("aarch64").Obj()
+	fooCq := utiltesting.MakeClusterQueue("fooCq").
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("x86").Resource("cpu", "5").Obj()).
+		Obj()
+	barCq := utiltesting.MakeClusterQueue("barCq").Obj()
+	fizzCq := utiltesting.MakeClusterQueue("fizzCq").
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("x86").Resource("cpu", "5").Obj(),
+			*utiltesting.MakeFlavorQuotas("aarch64").Resource("cpu", "3").Obj(),
+		).
+		Obj()
+
+	tests := []struct {
+		name                       string
+		clusterQueues              []*kueue.ClusterQueue
+		wantInUseClusterQueueNames []string
 	}{
 		{
 			name: "single clusterQueue with flavor in use",
@@ -2113,6 +2998,49 @@ func TestClusterQueuesUsingFlavor(t *testing.T) {
 	}
 }
 
+func TestFlavorsInUse(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("foo").
+			ResourceGroup(
+				*utiltesting.MakeFlavorQuotas("x86").Resource(corev1.ResourceCPU, "5").Obj(),
+				*utiltesting.MakeFlavorQuotas("aarch64").Resource(corev1.ResourceCPU, "3").Obj(),
+			).
+			Obj(),
+		utiltesting.MakeClusterQueue("bar").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "5").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("empty").Obj(),
+	}
+	// The workload was admitted with a flavor that bar no longer references.
+	wl := utiltesting.MakeWorkload("wl", "ns").
+		Request(corev1.ResourceCPU, "1").
+		Admit(utiltesting.MakeAdmission("bar").Assignment(corev1.ResourceCPU, "on-demand", "1").Obj()).
+		Obj()
+
+	cache := New(utiltesting.NewFakeClient())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatal("Failed adding workload")
+	}
+	want := sets.New("x86", "aarch64", "spot", "on-demand")
+	if diff := cmp.Diff(want, cache.FlavorsInUse()); diff != "" {
+		t.Errorf("Unexpected flavors in use (-want,+got):\n%s", diff)
+	}
+
+	if err := cache.DeleteWorkload(wl); err != nil {
+		t.Fatalf("Deleting workload: %v", err)
+	}
+	cache.DeleteClusterQueue(clusterQueues[0])
+	want = sets.New("spot")
+	if diff := cmp.Diff(want, cache.FlavorsInUse()); diff != "" {
+		t.Errorf("Unexpected flavors in use after deletions (-want,+got):\n%s", diff)
+	}
+}
+
 func TestMatchingClusterQueues(t *testing.T) {
 	clusterQueues := []*kueue.ClusterQueue{
 		utiltesting.MakeClusterQueue("matching1").
@@ -2145,50 +3073,318 @@ func TestMatchingClusterQueues(t *testing.T) {
 	}
 }
 
-// TestWaitForPodsReadyCancelled ensures that the WaitForPodsReady call does not block when the context is closed.
-func TestWaitForPodsReadyCancelled(t *testing.T) {
-	cache := New(utiltesting.NewFakeClient(), WithPodsReadyTracking(true))
-	ctx, cancel := context.WithCancel(context.Background())
-	log := ctrl.LoggerFrom(ctx)
-
-	go cache.CleanUpOnContext(ctx)
+func TestFindClusterQueuesForWorkload(t *testing.T) {
+	engSelector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{"dep": "eng"},
+	}
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("cpu-gpu").
+			NamespaceSelector(&metav1.LabelSelector{}).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10").
+				Resource("example.com/gpu", "4").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("cpu-only").
+			NamespaceSelector(&metav1.LabelSelector{}).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("eng-cpu").
+			NamespaceSelector(engSelector).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		// Pending, as the flavor doesn't exist.
+		utiltesting.MakeClusterQueue("pending").
+			NamespaceSelector(&metav1.LabelSelector{}).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("nonexistent-flavor").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("not-matching").
+			NamespaceSelector(nil).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue %s: %v", cq.Name, err)
+		}
+	}
 
-	cq := kueue.ClusterQueue{
-		ObjectMeta: metav1.ObjectMeta{Name: "one"},
+	cases := map[string]struct {
+		nsLabels map[string]string
+		wl       *kueue.Workload
+		want     []string
+	}{
+		"cpu in eng namespace": {
+			nsLabels: map[string]string{"dep": "eng"},
+			wl:       utiltesting.MakeWorkload("wl", "ns").Request(corev1.ResourceCPU, "1").Obj(),
+			want:     []string{"cpu-gpu", "cpu-only", "eng-cpu"},
+		},
+		"cpu in other namespace": {
+			nsLabels: map[string]string{"dep": "sales"},
+			wl:       utiltesting.MakeWorkload("wl", "ns").Request(corev1.ResourceCPU, "1").Obj(),
+			want:     []string{"cpu-gpu", "cpu-only"},
+		},
+		"cpu and gpu in eng namespace": {
+			nsLabels: map[string]string{"dep": "eng"},
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				Request(corev1.ResourceCPU, "1").
+				Request("example.com/gpu", "1").
+				Obj(),
+			want: []string{"cpu-gpu"},
+		},
+		"uncovered resource": {
+			nsLabels: map[string]string{"dep": "eng"},
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				Request(corev1.ResourceCPU, "1").
+				Request(corev1.ResourceMemory, "1Gi").
+				Obj(),
+		},
 	}
-	if err := cache.AddClusterQueue(ctx, &cq); err != nil {
-		t.Fatalf("Failed adding clusterQueue: %v", err)
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := cache.FindClusterQueuesForWorkload(tc.nsLabels, workload.NewInfo(tc.wl))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Wrong ClusterQueues (-want,+got):\n%s", diff)
+			}
+		})
 	}
+}
 
-	wl := utiltesting.MakeWorkload("a", "").Admit(&kueue.Admission{
-		ClusterQueue: "one",
-	}).Obj()
-	if err := cache.AssumeWorkload(wl); err != nil {
-		t.Fatalf("Failed assuming the workload to block the further admission: %v", err)
+// TestWaitForPodsReadyCancelled ensures that the WaitForPodsReady call does not block when the context is closed.
+func TestSetClusterQueueStatus(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		NamespaceSelector(&metav1.LabelSelector{}).
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
 	}
 
-	if cache.PodsReadyForAllAdmittedWorkloads(log) {
-		t.Fatalf("Unexpected that all admitted workloads are in PodsReady condition")
+	if err := cache.SetClusterQueueStatus("foo", pending); err != nil {
+		t.Fatalf("Holding ClusterQueue: %v", err)
+	}
+	if cache.ClusterQueueActive("foo") {
+		t.Error("ClusterQueue is active after the hold")
+	}
+	if got := cache.MatchingClusterQueues(nil); got.Len() != 0 {
+		t.Errorf("Held ClusterQueue matches namespaces, got %v", sets.List(got))
 	}
 
-	// cancel the context so that the WaitForPodsReady is returns
-	go cancel()
+	updated := cq.DeepCopy()
+	updated.Spec.ResourceGroups[0].Flavors[0].Resources[0].NominalQuota = resource.MustParse("20")
+	if _, err := cache.UpdateClusterQueue(updated); err != nil {
+		t.Fatalf("Updating ClusterQueue: %v", err)
+	}
+	if cache.ClusterQueueActive("foo") {
+		t.Error("ClusterQueue is active after the spec update")
+	}
 
-	cache.WaitForPodsReady(ctx)
-}
+	if err := cache.SetClusterQueueStatus("foo", active); err != nil {
+		t.Fatalf("Releasing ClusterQueue: %v", err)
+	}
+	if !cache.ClusterQueueActive("foo") {
+		t.Error("ClusterQueue is not active after the release")
+	}
+	if diff := cmp.Diff(sets.New("foo"), cache.MatchingClusterQueues(nil)); diff != "" {
+		t.Errorf("Wrong ClusterQueues (-want,+got):\n%s", diff)
+	}
 
-// TestCachePodsReadyForAllAdmittedWorkloads verifies the condition used to determine whether to wait
-func TestCachePodsReadyForAllAdmittedWorkloads(t *testing.T) {
-	clusterQueues := []kueue.ClusterQueue{
-		{
-			ObjectMeta: metav1.ObjectMeta{Name: "one"},
-		},
-		{
-			ObjectMeta: metav1.ObjectMeta{Name: "two"},
-		},
+	if diff := cmp.Diff(errCqNotFound.Error(), messageOrEmpty(cache.SetClusterQueueStatus("bar", pending))); diff != "" {
+		t.Errorf("Unexpected error for an unknown ClusterQueue (-want,+got):\n%s", diff)
+	}
+	if err := cache.SetClusterQueueStatus("foo", terminating); err == nil {
+		t.Error("Setting the ClusterQueue as terminating didn't fail")
 	}
+}
 
-	cl := utiltesting.NewFakeClient()
+func TestDrainClusterQueue(t *testing.T) {
+	cqs := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("foo").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("bar").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	admitted := func(name, cqName string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Queue("lq").
+			Request(corev1.ResourceCPU, "1").
+			Admit(utiltesting.MakeAdmission(cqName).Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+			Obj()
+	}
+	cache := New(utiltesting.NewFakeClient())
+	for _, cq := range cqs {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	if err := cache.AddLocalQueue(utiltesting.MakeLocalQueue("lq", "ns").ClusterQueue("foo").Obj()); err != nil {
+		t.Fatalf("Adding LocalQueue: %v", err)
+	}
+	for _, wl := range []*kueue.Workload{admitted("a", "foo"), admitted("b", "foo"), admitted("c", "bar")} {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Failed adding workload %s", wl.Name)
+		}
+	}
+	if err := cache.AssumeWorkload(admitted("d", "foo")); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+	if _, err := cache.ReserveQuota("foo", FlavorResourceQuantities{"default": {corev1.ResourceCPU: 2_000}}, time.Hour); err != nil {
+		t.Fatalf("Reserving quota: %v", err)
+	}
+
+	got, err := cache.DrainClusterQueue("foo")
+	if err != nil {
+		t.Fatalf("Draining ClusterQueue: %v", err)
+	}
+	if diff := cmp.Diff([]string{"ns/a", "ns/b", "ns/d"}, got); diff != "" {
+		t.Errorf("Unexpected drained workloads (-want,+got):\n%s", diff)
+	}
+	wantUsage := map[string]FlavorResourceQuantities{
+		"foo": {"default": {corev1.ResourceCPU: 0}},
+		"bar": {"default": {corev1.ResourceCPU: 1_000}},
+	}
+	gotUsage := make(map[string]FlavorResourceQuantities)
+	for name, cq := range cache.clusterQueues {
+		gotUsage[name] = cq.Usage
+	}
+	if diff := cmp.Diff(wantUsage, gotUsage); diff != "" {
+		t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+	}
+	if len(cache.assumedWorkloads) != 0 {
+		t.Errorf("Got assumed workloads %v, want none", cache.assumedWorkloads)
+	}
+	if lq := cache.clusterQueues["foo"].localQueues["ns/lq"]; lq.admittedWorkloads != 0 {
+		t.Errorf("Got %d admitted workloads in the LocalQueue, want 0", lq.admittedWorkloads)
+	}
+	if _, ok := cache.clusterQueues["foo"]; !ok {
+		t.Error("Drained ClusterQueue was removed from the cache")
+	}
+
+	if _, err := cache.DrainClusterQueue("baz"); err != errCqNotFound {
+		t.Errorf("Got error %v for an unknown ClusterQueue, want %v", err, errCqNotFound)
+	}
+}
+
+func TestWaitForPodsReadyCancelled(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient(), WithPodsReadyTracking(true))
+	ctx, cancel := context.WithCancel(context.Background())
+	log := ctrl.LoggerFrom(ctx)
+
+	go cache.CleanUpOnContext(ctx)
+
+	cq := kueue.ClusterQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "one"},
+	}
+	if err := cache.AddClusterQueue(ctx, &cq); err != nil {
+		t.Fatalf("Failed adding clusterQueue: %v", err)
+	}
+
+	wl := utiltesting.MakeWorkload("a", "").Admit(&kueue.Admission{
+		ClusterQueue: "one",
+	}).Obj()
+	if err := cache.AssumeWorkload(wl); err != nil {
+		t.Fatalf("Failed assuming the workload to block the further admission: %v", err)
+	}
+
+	if cache.PodsReadyForAllAdmittedWorkloads(log) {
+		t.Fatalf("Unexpected that all admitted workloads are in PodsReady condition")
+	}
+
+	// cancel the context so that the WaitForPodsReady is returns
+	go cancel()
+
+	cache.WaitForPodsReady(ctx)
+}
+
+func TestWaitForClusterQueueActive(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if cache.ClusterQueueActive("foo") {
+		t.Fatal("ClusterQueue is active without its flavor")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wait.ForeverTestTimeout)
+	defer cancel()
+	errCh := make(chan error)
+	go func() {
+		errCh <- cache.WaitForClusterQueueActive(ctx, "foo")
+	}()
+
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	if err := <-errCh; err != nil {
+		t.Errorf("Waiting for the ClusterQueue to be active: %v", err)
+	}
+	if err := cache.WaitForClusterQueueActive(ctx, "foo"); err != nil {
+		t.Errorf("Waiting for an active ClusterQueue: %v", err)
+	}
+}
+
+func TestWaitForClusterQueueActiveClone(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	clone := cache.Clone()
+
+	ctx, cancel := context.WithTimeout(context.Background(), wait.ForeverTestTimeout)
+	defer cancel()
+	errCh := make(chan error)
+	go func() {
+		errCh <- clone.WaitForClusterQueueActive(ctx, "foo")
+	}()
+
+	clone.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	if err := <-errCh; err != nil {
+		t.Errorf("Waiting for the ClusterQueue to be active in the clone: %v", err)
+	}
+	if cache.ClusterQueueActive("foo") {
+		t.Error("ClusterQueue is active in the original cache")
+	}
+}
+
+func TestWaitForClusterQueueActiveCancelled(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// cancel the context so that the WaitForClusterQueueActive returns
+	go cancel()
+
+	if diff := cmp.Diff(context.Canceled.Error(), messageOrEmpty(cache.WaitForClusterQueueActive(ctx, "foo"))); diff != "" {
+		t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+	}
+}
+
+// TestCachePodsReadyForAllAdmittedWorkloads verifies the condition used to determine whether to wait
+func TestCachePodsReadyForAllAdmittedWorkloads(t *testing.T) {
+	clusterQueues := []kueue.ClusterQueue{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "one"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "two"},
+		},
+	}
+
+	cl := utiltesting.NewFakeClient()
 
 	tests := []struct {
 		name      string
@@ -2433,6 +3629,334 @@ func TestCachePodsReadyForAllAdmittedWorkloads(t *testing.T) {
 	}
 }
 
+func TestCachePodsReadyTimeout(t *testing.T) {
+	admittedAt := time.Now().Truncate(time.Second)
+	cases := map[string]struct {
+		opts      []Option
+		wantReady bool
+	}{
+		"workload past the timeout is ignored": {
+			opts:      []Option{WithPodsReadyTracking(true), WithPodsReadyTimeout(time.Minute)},
+			wantReady: true,
+		},
+		"no timeout": {
+			opts: []Option{WithPodsReadyTracking(true)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient(), tc.opts...)
+			fakeClock := testingclock.NewFakeClock(admittedAt)
+			cache.clock = fakeClock
+			ctx := context.Background()
+			log := ctrl.LoggerFrom(ctx)
+
+			cq := kueue.ClusterQueue{
+				ObjectMeta: metav1.ObjectMeta{Name: "one"},
+			}
+			if err := cache.AddClusterQueue(ctx, &cq); err != nil {
+				t.Fatalf("Failed adding clusterQueue: %v", err)
+			}
+			wl := utiltesting.MakeWorkload("a", "").
+				Admit(&kueue.Admission{ClusterQueue: "one"}).
+				SetOrReplaceCondition(metav1.Condition{
+					Type:               kueue.WorkloadAdmitted,
+					Status:             metav1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(admittedAt),
+				}).
+				Obj()
+			cache.AddOrUpdateWorkload(wl)
+
+			if cache.PodsReadyForAllAdmittedWorkloads(log) {
+				t.Errorf("Unexpected that all admitted workloads are in PodsReady condition before the timeout")
+			}
+			fakeClock.Step(2 * time.Minute)
+			if diff := cmp.Diff(tc.wantReady, cache.PodsReadyForAllAdmittedWorkloads(log)); diff != "" {
+				t.Errorf("Unexpected response about workloads without pods ready after the timeout (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWorkloadAdmissionAge(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	cache := New(utiltesting.NewFakeClient())
+	fakeClock := testingclock.NewFakeClock(now)
+	cache.clock = fakeClock
+	if err := cache.AddClusterQueue(context.Background(), utiltesting.MakeClusterQueue("one").Obj()); err != nil {
+		t.Fatalf("Failed adding clusterQueue: %v", err)
+	}
+	admittedCond := func(at time.Time) metav1.Condition {
+		return metav1.Condition{
+			Type:               kueue.WorkloadAdmitted,
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(at),
+		}
+	}
+	admitted := utiltesting.MakeWorkload("admitted", "ns").
+		Admit(utiltesting.MakeAdmission("one").Obj()).
+		SetOrReplaceCondition(admittedCond(now)).
+		Obj()
+	if !cache.AddOrUpdateWorkload(admitted) {
+		t.Fatal("Failed adding admitted workload")
+	}
+	withCondition := utiltesting.MakeWorkload("with-condition", "ns").
+		Admit(utiltesting.MakeAdmission("one").Obj()).
+		SetOrReplaceCondition(admittedCond(now.Add(-5 * time.Minute))).
+		Obj()
+	if !cache.AddOrUpdateWorkload(withCondition) {
+		t.Fatal("Failed adding workload with condition")
+	}
+	assumed := utiltesting.MakeWorkload("assumed", "ns").
+		Admit(utiltesting.MakeAdmission("one").Obj()).
+		SetOrReplaceCondition(admittedCond(now)).
+		Obj()
+	if err := cache.AssumeWorkload(assumed); err != nil {
+		t.Fatalf("Failed assuming workload: %v", err)
+	}
+
+	check := func(key string, want time.Duration, wantErr string) {
+		t.Helper()
+		got, err := cache.WorkloadAdmissionAge(key)
+		if diff := cmp.Diff(wantErr, messageOrEmpty(err)); diff != "" {
+			t.Errorf("Unexpected error for %s (-want,+got):\n%s", key, diff)
+		}
+		if got != want {
+			t.Errorf("WorkloadAdmissionAge(%q) = %v, want %v", key, got, want)
+		}
+	}
+	check("ns/admitted", 0, "")
+	check("ns/with-condition", 5*time.Minute, "")
+	check("ns/assumed", 0, "")
+	check("ns/unknown", 0, errWorkloadNotAdmitted.Error())
+
+	fakeClock.Step(time.Minute)
+	check("ns/admitted", time.Minute, "")
+	check("ns/with-condition", 6*time.Minute, "")
+	check("ns/assumed", time.Minute, "")
+
+	// Updating the workload keeps the original admission time.
+	if !cache.AddOrUpdateWorkload(admitted) {
+		t.Fatal("Failed updating admitted workload")
+	}
+	fakeClock.Step(time.Minute)
+	check("ns/admitted", 2*time.Minute, "")
+
+	if err := cache.ForgetWorkload(assumed); err != nil {
+		t.Fatalf("Failed forgetting workload: %v", err)
+	}
+	check("ns/assumed", 0, errWorkloadNotAdmitted.Error())
+	if err := cache.DeleteWorkload(admitted); err != nil {
+		t.Fatalf("Failed deleting workload: %v", err)
+	}
+	check("ns/admitted", 0, errWorkloadNotAdmitted.Error())
+}
+
+func TestGangUsage(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	cq := utiltesting.MakeClusterQueue("one").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Failed adding clusterQueue: %v", err)
+	}
+	gang := utiltesting.MakeWorkload("gang", "ns").
+		Request(corev1.ResourceCPU, "4").
+		Admit(utiltesting.MakeAdmission("one").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+		Obj()
+	gang.Annotations = map[string]string{GangAnnotation: "true"}
+	regular := utiltesting.MakeWorkload("regular", "ns").
+		Request(corev1.ResourceCPU, "2").
+		Admit(utiltesting.MakeAdmission("one").Assignment(corev1.ResourceCPU, "default", "2").Obj()).
+		Obj()
+	for _, wl := range []*kueue.Workload{gang, regular} {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Failed adding workload %s", wl.Name)
+		}
+	}
+
+	check := func(wantUsage int64, wantPending bool) {
+		t.Helper()
+		wantUsageMap := FlavorResourceQuantities{"default": {corev1.ResourceCPU: wantUsage}}
+		if diff := cmp.Diff(wantUsageMap, cache.clusterQueues["one"].Usage); diff != "" {
+			t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+		}
+		if got := cache.IsGangPending("ns/gang"); got != wantPending {
+			t.Errorf("IsGangPending() = %t, want %t", got, wantPending)
+		}
+		if err := cache.Verify(); err != nil {
+			t.Errorf("Unexpected inconsistency: %v", err)
+		}
+	}
+	check(2_000, true)
+	if cache.IsGangPending("ns/regular") {
+		t.Error("Regular workload reported as a pending gang")
+	}
+
+	ready := gang.DeepCopy()
+	apimeta.SetStatusCondition(&ready.Status.Conditions, metav1.Condition{
+		Type:   kueue.WorkloadPodsReady,
+		Status: metav1.ConditionTrue,
+		Reason: "PodsReady",
+	})
+	if err := cache.UpdateWorkload(gang, ready); err != nil {
+		t.Fatalf("Failed updating workload: %v", err)
+	}
+	check(6_000, false)
+
+	if err := cache.DeleteWorkload(ready); err != nil {
+		t.Fatalf("Failed deleting workload: %v", err)
+	}
+	check(2_000, false)
+}
+
+func TestQuotaMode(t *testing.T) {
+	cases := map[string]struct {
+		opts      []Option
+		wantUsage FlavorResourceQuantities
+	}{
+		"default counts requests": {
+			wantUsage: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 1_000, corev1.ResourceMemory: 512}},
+		},
+		"requests": {
+			opts:      []Option{WithQuotaMode(QuotaModeRequests)},
+			wantUsage: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 1_000, corev1.ResourceMemory: 512}},
+		},
+		"limits": {
+			opts:      []Option{WithQuotaMode(QuotaModeLimits)},
+			wantUsage: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 3_000, corev1.ResourceMemory: 512}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient(), tc.opts...)
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			cq := utiltesting.MakeClusterQueue("one").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+					Resource(corev1.ResourceCPU, "10").
+					Resource(corev1.ResourceMemory, "10Ki").Obj()).
+				Obj()
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Failed adding clusterQueue: %v", err)
+			}
+			// The memory has no limit, so its request is counted in both modes.
+			wl := utiltesting.MakeWorkload("burstable", "ns").
+				Request(corev1.ResourceCPU, "1").
+				Limit(corev1.ResourceCPU, "3").
+				Request(corev1.ResourceMemory, "512").
+				Admit(utiltesting.MakeAdmission("one").
+					Assignment(corev1.ResourceCPU, "default", "1").
+					Assignment(corev1.ResourceMemory, "default", "512").Obj()).
+				Obj()
+			if !cache.AddOrUpdateWorkload(wl) {
+				t.Fatal("Failed adding workload")
+			}
+			if diff := cmp.Diff(tc.wantUsage, cache.clusterQueues["one"].Usage); diff != "" {
+				t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+			}
+			if err := cache.Verify(); err != nil {
+				t.Errorf("Unexpected inconsistency: %v", err)
+			}
+		})
+	}
+}
+
+func TestInitContainersAndOverheadUsage(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	cq := utiltesting.MakeClusterQueue("one").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Failed adding clusterQueue: %v", err)
+	}
+	ps := utiltesting.MakePodSet(kueue.DefaultPodSetName, 2).
+		Request(corev1.ResourceCPU, "1").
+		InitContainers(corev1.Container{
+			Name: "init",
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("3")},
+			},
+		}).
+		Obj()
+	ps.Template.Spec.Overhead = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")}
+	// The admission only accounts for the main containers.
+	wl := utiltesting.MakeWorkload("wl", "ns").
+		PodSets(*ps).
+		Admit(utiltesting.MakeAdmission("one").
+			Assignment(corev1.ResourceCPU, "default", "2").
+			AssignmentPodCount(2).Obj()).
+		Obj()
+
+	// Each pod requests max(1, 3) + 0.5 CPUs.
+	wantUsage := FlavorResourceQuantities{"default": {corev1.ResourceCPU: 7_000}}
+	if diff := cmp.Diff(wantUsage, cache.UsageDelta(workload.NewInfo(wl))); diff != "" {
+		t.Errorf("Unexpected usage delta (-want,+got):\n%s", diff)
+	}
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatal("Failed adding workload")
+	}
+	if diff := cmp.Diff(wantUsage, cache.clusterQueues["one"].Usage); diff != "" {
+		t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+	}
+	if err := cache.Verify(); err != nil {
+		t.Errorf("Unexpected inconsistency: %v", err)
+	}
+}
+
+func TestAddOrUpdateWorkloadSameResourceVersion(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	cq := utiltesting.MakeClusterQueue("one").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Failed adding clusterQueue: %v", err)
+	}
+	admitted := func(resourceVersion, cpu string) *kueue.Workload {
+		wl := utiltesting.MakeWorkload("wl", "ns").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission("one").Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+		wl.ResourceVersion = resourceVersion
+		return wl
+	}
+	check := func(wantUsage int64) {
+		t.Helper()
+		wantUsageMap := FlavorResourceQuantities{"default": {corev1.ResourceCPU: wantUsage}}
+		if diff := cmp.Diff(wantUsageMap, cache.clusterQueues["one"].Usage); diff != "" {
+			t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+		}
+	}
+
+	if !cache.AddOrUpdateWorkload(admitted("1", "2")) {
+		t.Fatal("Failed adding workload")
+	}
+	check(2_000)
+
+	// The usage is not recomputed for the same resourceVersion, which would
+	// result in a different usage here.
+	if !cache.AddOrUpdateWorkload(admitted("1", "5")) {
+		t.Fatal("Failed adding the same workload again")
+	}
+	check(2_000)
+
+	if !cache.AddOrUpdateWorkload(admitted("2", "5")) {
+		t.Fatal("Failed updating workload")
+	}
+	check(5_000)
+
+	// Objects without resourceVersion are always recomputed.
+	if !cache.AddOrUpdateWorkload(admitted("", "3")) {
+		t.Fatal("Failed updating workload without resourceVersion")
+	}
+	check(3_000)
+	if err := cache.Verify(); err != nil {
+		t.Errorf("Unexpected inconsistency: %v", err)
+	}
+}
+
 // TestIsAssumedOrAdmittedCheckWorkload verifies if workload is in Assumed map from cache or if it is Admitted in one ClusterQueue
 func TestIsAssumedOrAdmittedCheckWorkload(t *testing.T) {
 	tests := []struct {
@@ -2547,9 +4071,2227 @@ func TestIsAssumedOrAdmittedCheckWorkload(t *testing.T) {
 	}
 }
 
-func messageOrEmpty(err error) string {
-	if err == nil {
-		return ""
+func TestCanBorrowForPriority(t *testing.T) {
+	cqs := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("limited").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Annotation(MinBorrowingPriorityAnnotation, "100").
+			Obj(),
+		utiltesting.MakeClusterQueue("unlimited").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+	}
+	cases := map[string]struct {
+		cq        string
+		priority  int32
+		want      bool
+		wantError string
+	}{
+		"low priority can't borrow": {
+			cq:       "limited",
+			priority: 10,
+		},
+		"priority at the threshold can borrow": {
+			cq:       "limited",
+			priority: 100,
+			want:     true,
+		},
+		"high priority can borrow": {
+			cq:       "limited",
+			priority: 1000,
+			want:     true,
+		},
+		"no threshold": {
+			cq:       "unlimited",
+			priority: -10,
+			want:     true,
+		},
+		"unknown clusterQueue": {
+			cq:        "nonexistent",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			for _, cq := range cqs {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			got, err := cache.CanBorrowForPriority(tc.cq, tc.priority)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if got != tc.want {
+				t.Errorf("CanBorrowForPriority(%q, %d) = %t, want %t", tc.cq, tc.priority, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateClusterQueueChanged(t *testing.T) {
+	base := utiltesting.MakeClusterQueue("foo").
+		Cohort("one").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "5").Obj()).
+		Obj()
+	cases := map[string]struct {
+		update      func(*kueue.ClusterQueue)
+		wantChanged bool
+	}{
+		"same spec": {
+			update: func(*kueue.ClusterQueue) {},
+		},
+		"cosmetic change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Labels = map[string]string{"team": "a"}
+			},
+		},
+		"nominal quota change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Spec.ResourceGroups[0].Flavors[0].Resources[0].NominalQuota = resource.MustParse("20")
+			},
+			wantChanged: true,
+		},
+		"borrowing limit change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Spec.ResourceGroups[0].Flavors[0].Resources[0].BorrowingLimit = nil
+			},
+			wantChanged: true,
+		},
+		"flavor change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Spec.ResourceGroups[0].Flavors[0].Name = "spot"
+			},
+			wantChanged: true,
+		},
+		"cohort change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Spec.Cohort = "two"
+			},
+			wantChanged: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), base); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			updated := base.DeepCopy()
+			tc.update(updated)
+			changed, err := cache.UpdateClusterQueue(updated)
+			if err != nil {
+				t.Fatalf("Updating ClusterQueue: %v", err)
+			}
+			if changed != tc.wantChanged {
+				t.Errorf("UpdateClusterQueue returned changed=%t, want %t", changed, tc.wantChanged)
+			}
+		})
+	}
+}
+
+func TestCompareSpec(t *testing.T) {
+	base := utiltesting.MakeClusterQueue("foo").
+		Cohort("one").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "5").Obj()).
+		Obj()
+	cases := map[string]struct {
+		update    func(*kueue.ClusterQueue)
+		override  bool
+		wantEqual bool
+		wantErr   bool
+	}{
+		"same spec": {
+			update:    func(*kueue.ClusterQueue) {},
+			wantEqual: true,
+		},
+		"cosmetic change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Labels = map[string]string{"team": "a"}
+			},
+			wantEqual: true,
+		},
+		"same spec with an overridden quota": {
+			update:    func(*kueue.ClusterQueue) {},
+			override:  true,
+			wantEqual: true,
+		},
+		"nominal quota change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Spec.ResourceGroups[0].Flavors[0].Resources[0].NominalQuota = resource.MustParse("20")
+			},
+		},
+		"borrowing limit change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Spec.ResourceGroups[0].Flavors[0].Resources[0].BorrowingLimit = nil
+			},
+		},
+		"flavor change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Spec.ResourceGroups[0].Flavors[0].Name = "spot"
+			},
+		},
+		"default flavors change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Annotations = map[string]string{DefaultFlavorsAnnotation: "default"}
+			},
+		},
+		"cohort change": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Spec.Cohort = "two"
+			},
+		},
+		"invalid usage caps": {
+			update: func(cq *kueue.ClusterQueue) {
+				cq.Annotations = map[string]string{UsageCapsAnnotation: "default"}
+			},
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), base); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			if tc.override {
+				if err := cache.OverrideFlavorQuota("foo", "default", corev1.ResourceCPU, 20_000, time.Hour); err != nil {
+					t.Fatalf("Overriding the quota: %v", err)
+				}
+			}
+			live := base.DeepCopy()
+			tc.update(live)
+			equal, err := cache.CompareSpec(live)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("CompareSpec returned error %v, want error %t", err, tc.wantErr)
+			}
+			if equal != tc.wantEqual {
+				t.Errorf("CompareSpec returned %t, want %t", equal, tc.wantEqual)
+			}
+			if tc.wantErr {
+				return
+			}
+			if _, err := cache.UpdateClusterQueue(live); err != nil {
+				t.Fatalf("Updating ClusterQueue: %v", err)
+			}
+			if equal, err = cache.CompareSpec(live); err != nil || !equal {
+				t.Errorf("CompareSpec after the update returned %t, %v, want true", equal, err)
+			}
+		})
+	}
+
+	cache := New(utiltesting.NewFakeClient())
+	_, err := cache.CompareSpec(base)
+	if diff := cmp.Diff(errCqNotFound.Error(), messageOrEmpty(err)); diff != "" {
+		t.Errorf("Unexpected error for an unknown ClusterQueue (-want,+got):\n%s", diff)
+	}
+}
+
+func TestUpdateClusterQueueRetainsUsage(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "10").Obj(),
+			*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "10").Obj(),
+		).
+		Obj()
+	workloads := []*kueue.Workload{
+		utiltesting.MakeWorkload("a", "ns").
+			Request(corev1.ResourceCPU, "8").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "on-demand", "8").Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("b", "ns").
+			Request(corev1.ResourceCPU, "3").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "spot", "3").Obj()).
+			Obj(),
+	}
+	recorder := record.NewFakeRecorder(10)
+	cache := New(utiltesting.NewFakeClient(), WithEventRecorder(recorder))
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	for _, wl := range workloads {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Failed adding workload %s", wl.Name)
+		}
+	}
+
+	// Shrink the on-demand quota below its usage and remove the spot flavor.
+	updated := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "5").Obj()).
+		Obj()
+	if _, err := cache.UpdateClusterQueue(updated); err != nil {
+		t.Fatalf("Updating ClusterQueue: %v", err)
+	}
+	wantUsage := FlavorResourceQuantities{
+		"on-demand": {corev1.ResourceCPU: 8_000},
+		"spot":      {corev1.ResourceCPU: 3_000},
+	}
+	if diff := cmp.Diff(wantUsage, cache.clusterQueues["foo"].Usage); diff != "" {
+		t.Errorf("Unexpected usage after the update (-want,+got):\n%s", diff)
+	}
+	var gotEvents []string
+	for len(recorder.Events) > 0 {
+		gotEvents = append(gotEvents, <-recorder.Events)
+	}
+	wantEvents := []string{
+		"Warning OverQuota Usage of cpu in flavor on-demand (8) exceeds the quota of the ClusterQueue (5)",
+		"Warning OverQuota 3 of cpu in flavor spot is used, but the ClusterQueue has no quota for it",
+	}
+	if diff := cmp.Diff(wantEvents, gotEvents); diff != "" {
+		t.Errorf("Unexpected events (-want,+got):\n%s", diff)
+	}
+
+	if err := cache.DeleteWorkload(workloads[1]); err != nil {
+		t.Fatalf("Deleting workload: %v", err)
+	}
+	if _, err := cache.UpdateClusterQueue(updated); err != nil {
+		t.Fatalf("Updating ClusterQueue: %v", err)
+	}
+	wantUsage = FlavorResourceQuantities{
+		"on-demand": {corev1.ResourceCPU: 8_000},
+	}
+	if diff := cmp.Diff(wantUsage, cache.clusterQueues["foo"].Usage); diff != "" {
+		t.Errorf("Unexpected usage after the workload in the removed flavor finished (-want,+got):\n%s", diff)
+	}
+}
+
+func TestAddWorkloadWithUnknownFlavor(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	wl := utiltesting.MakeWorkload("a", "ns").
+		Request(corev1.ResourceCPU, "3").
+		Request(corev1.ResourceMemory, "1Gi").
+		Admit(utiltesting.MakeAdmission("foo").
+			Assignment(corev1.ResourceCPU, "spot", "3").
+			Assignment(corev1.ResourceMemory, "spot", "1Gi").
+			Obj()).
+		Obj()
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatal("Failed adding workload")
+	}
+
+	// Memory is not covered by the ClusterQueue, so it's not tracked.
+	wantUsage := FlavorResourceQuantities{
+		"on-demand": {corev1.ResourceCPU: 0},
+		"spot":      {corev1.ResourceCPU: 3_000},
+	}
+	if diff := cmp.Diff(wantUsage, cache.clusterQueues["foo"].Usage); diff != "" {
+		t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+	}
+	gotUnknown, err := cache.UnknownFlavorUsage("foo")
+	if err != nil {
+		t.Fatalf("Getting the usage in unknown flavors: %v", err)
+	}
+	wantUnknown := FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 3_000}}
+	if diff := cmp.Diff(wantUnknown, gotUnknown); diff != "" {
+		t.Errorf("Unexpected usage in unknown flavors (-want,+got):\n%s", diff)
+	}
+	gotUsage, _, err := cache.Usage(cq)
+	if err != nil {
+		t.Fatalf("Getting usage: %v", err)
+	}
+	wantFlavorUsage := []kueue.FlavorUsage{{
+		Name:      "on-demand",
+		Resources: []kueue.ResourceUsage{{Name: corev1.ResourceCPU}},
+	}}
+	if diff := cmp.Diff(wantFlavorUsage, gotUsage); diff != "" {
+		t.Errorf("Unexpected usage of the flavors in the spec (-want,+got):\n%s", diff)
+	}
+
+	if err := cache.DeleteWorkload(wl); err != nil {
+		t.Fatalf("Deleting workload: %v", err)
+	}
+	wantUsage = FlavorResourceQuantities{
+		"on-demand": {corev1.ResourceCPU: 0},
+	}
+	if diff := cmp.Diff(wantUsage, cache.clusterQueues["foo"].Usage); diff != "" {
+		t.Errorf("Unexpected usage after deleting the workload (-want,+got):\n%s", diff)
+	}
+}
+
+func TestSumUsageAcrossCohort(t *testing.T) {
+	member := func(name string) *kueue.ClusterQueue {
+		return utiltesting.MakeClusterQueue(name).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj()).
+			Cohort("one").
+			Obj()
+	}
+	clusterQueues := []*kueue.ClusterQueue{
+		member("a"),
+		member("b"),
+		member("c"),
+		utiltesting.MakeClusterQueue("standalone").Obj(),
+	}
+	workloads := []*kueue.Workload{
+		utiltesting.MakeWorkload("a-wl", "").
+			Request(corev1.ResourceCPU, "1").
+			Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("b-wl", "").
+			Request(corev1.ResourceCPU, "2").
+			Request(corev1.ResourceMemory, "1Gi").
+			Admit(utiltesting.MakeAdmission("b").
+				Assignment(corev1.ResourceCPU, "default", "2").
+				Assignment(corev1.ResourceMemory, "default", "1Gi").
+				Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("c-wl", "").
+			Request(corev1.ResourceCPU, "4").
+			Admit(utiltesting.MakeAdmission("c").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+			Obj(),
+	}
+	cache := New(utiltesting.NewFakeClient())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	for _, wl := range workloads {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Workload %s was not added", wl.Name)
+		}
+	}
+
+	cases := map[string]struct {
+		cohort    string
+		exclude   string
+		want      FlavorResourceQuantities
+		wantError string
+	}{
+		"exclude a": {
+			cohort:  "one",
+			exclude: "a",
+			want: FlavorResourceQuantities{
+				"default": {corev1.ResourceCPU: 6_000, corev1.ResourceMemory: 1024 * 1024 * 1024},
+			},
+		},
+		"exclude b": {
+			cohort:  "one",
+			exclude: "b",
+			want: FlavorResourceQuantities{
+				"default": {corev1.ResourceCPU: 5_000, corev1.ResourceMemory: 0},
+			},
+		},
+		"unknown cohort": {
+			cohort:    "two",
+			exclude:   "a",
+			wantError: errCohortNotFound.Error(),
+		},
+		"excluded clusterQueue not in the cohort": {
+			cohort:    "one",
+			exclude:   "standalone",
+			wantError: errCqNotFound.Error(),
+		},
+		"unknown excluded clusterQueue": {
+			cohort:    "one",
+			exclude:   "nonexistent",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := cache.SumUsageAcrossCohort(tc.cohort, tc.exclude)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetCohortMembers(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").Cohort("one").Obj(),
+		utiltesting.MakeClusterQueue("b").Cohort("one").Obj(),
+		utiltesting.MakeClusterQueue("c").Cohort("two").Obj(),
+		utiltesting.MakeClusterQueue("d").Obj(),
+		utiltesting.MakeClusterQueue("e").Cohort("two").Obj(),
+	}
+	cache := New(utiltesting.NewFakeClient())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	cases := map[string]struct {
+		cohort    string
+		want      []string
+		wantError string
+	}{
+		"cohort one": {
+			cohort: "one",
+			want:   []string{"a", "b"},
+		},
+		"cohort two": {
+			cohort: "two",
+			want:   []string{"c", "e"},
+		},
+		"unknown cohort": {
+			cohort:    "three",
+			wantError: errCohortNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := cache.GetCohortMembers(tc.cohort)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected members (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTransferCohortMembership(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			Cohort("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			Cohort("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "5").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("c").
+			Cohort("two").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "3").Obj()).
+			Obj(),
+	}
+	var cohortEvents []string
+	cache := New(utiltesting.NewFakeClient(), WithCohortChangeHandler(func(name string, exists bool) {
+		cohortEvents = append(cohortEvents, fmt.Sprintf("%s=%t", name, exists))
+	}))
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	wl := utiltesting.MakeWorkload("a-wl", "ns").
+		Request(corev1.ResourceCPU, "4").
+		Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+		Obj()
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatalf("Workload %s was not added", wl.Name)
+	}
+	cohortEvents = nil
+	check := func(cohort string, wantMembers []string, wantCapacity, wantUsage FlavorResourceQuantities) {
+		t.Helper()
+		members, err := cache.GetCohortMembers(cohort)
+		if err != nil {
+			t.Fatalf("Getting the members of cohort %s: %v", cohort, err)
+		}
+		if diff := cmp.Diff(wantMembers, members); diff != "" {
+			t.Errorf("Unexpected members of cohort %s (-want,+got):\n%s", cohort, diff)
+		}
+		for _, summary := range cache.ListCohorts() {
+			if summary.Name != cohort {
+				continue
+			}
+			if diff := cmp.Diff(wantCapacity, summary.Capacity); diff != "" {
+				t.Errorf("Unexpected capacity of cohort %s (-want,+got):\n%s", cohort, diff)
+			}
+			if diff := cmp.Diff(wantUsage, summary.Usage); diff != "" {
+				t.Errorf("Unexpected usage of cohort %s (-want,+got):\n%s", cohort, diff)
+			}
+		}
+	}
+
+	if err := cache.TransferCohortMembership("a", "two"); err != nil {
+		t.Fatalf("Moving a to cohort two: %v", err)
+	}
+	check("one", []string{"b"},
+		FlavorResourceQuantities{"default": {corev1.ResourceCPU: 5_000}},
+		FlavorResourceQuantities{"default": {corev1.ResourceCPU: 0}})
+	check("two", []string{"a", "c"},
+		FlavorResourceQuantities{"default": {corev1.ResourceCPU: 13_000}},
+		FlavorResourceQuantities{"default": {corev1.ResourceCPU: 4_000}})
+
+	if err := cache.TransferCohortMembership("b", "two"); err != nil {
+		t.Fatalf("Moving b to cohort two: %v", err)
+	}
+	if _, err := cache.GetCohortMembers("one"); !errors.Is(err, errCohortNotFound) {
+		t.Errorf("Cohort one wasn't removed after losing its members, got error %v", err)
+	}
+	if err := cache.TransferCohortMembership("c", ""); err != nil {
+		t.Fatalf("Moving c out of its cohort: %v", err)
+	}
+	check("two", []string{"a", "b"},
+		FlavorResourceQuantities{"default": {corev1.ResourceCPU: 15_000}},
+		FlavorResourceQuantities{"default": {corev1.ResourceCPU: 4_000}})
+	if cohort, found, _ := cache.ClusterQueueCohort("c"); found {
+		t.Errorf("ClusterQueue c is still in cohort %s", cohort)
+	}
+	if diff := cmp.Diff([]string{"one=false"}, cohortEvents); diff != "" {
+		t.Errorf("Unexpected cohort events (-want,+got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(errCqNotFound.Error(), messageOrEmpty(cache.TransferCohortMembership("d", "two"))); diff != "" {
+		t.Errorf("Unexpected error for an unknown ClusterQueue (-want,+got):\n%s", diff)
+	}
+}
+
+func TestRecomputeCohort(t *testing.T) {
+	cqs := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			Cohort("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			Cohort("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("c").
+			Cohort("two").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	workloads := []*kueue.Workload{
+		utiltesting.MakeWorkload("wl-a", "ns").
+			Queue("lq").
+			Request(corev1.ResourceCPU, "2").
+			Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "default", "2").Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("wl-b", "ns").
+			Request(corev1.ResourceCPU, "3").
+			Admit(utiltesting.MakeAdmission("b").Assignment(corev1.ResourceCPU, "default", "3").Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("wl-c", "ns").
+			Request(corev1.ResourceCPU, "4").
+			Admit(utiltesting.MakeAdmission("c").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+			Obj(),
+	}
+	cache := New(utiltesting.NewFakeClient())
+	ctx := context.Background()
+	for _, cq := range cqs {
+		if err := cache.AddClusterQueue(ctx, cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	if err := cache.AddLocalQueue(utiltesting.MakeLocalQueue("lq", "ns").ClusterQueue("a").Obj()); err != nil {
+		t.Fatalf("Adding LocalQueue: %v", err)
+	}
+	for _, wl := range workloads {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Failed adding workload %s", wl.Name)
+		}
+	}
+	if _, err := cache.ReserveQuota("b", FlavorResourceQuantities{"default": {corev1.ResourceCPU: 1_000}}, time.Hour); err != nil {
+		t.Fatalf("Reserving quota: %v", err)
+	}
+
+	// Simulate the drift of incremental updates.
+	perturb := func(cqName string) {
+		cq := cache.clusterQueues[cqName]
+		cq.Usage["default"][corev1.ResourceCPU] += 500
+		for _, q := range cq.localQueues {
+			q.usage["default"][corev1.ResourceCPU] -= 500
+			q.admittedWorkloads += 3
+		}
+	}
+	for _, cq := range cqs {
+		perturb(cq.Name)
+	}
+
+	if err := cache.RecomputeCohort("one"); err != nil {
+		t.Fatalf("Recomputing cohort: %v", err)
+	}
+	wantUsage := map[string]FlavorResourceQuantities{
+		"a": {"default": {corev1.ResourceCPU: 2_000}},
+		"b": {"default": {corev1.ResourceCPU: 4_000}},
+		// Not in the cohort, so it keeps the perturbed usage.
+		"c": {"default": {corev1.ResourceCPU: 4_500}},
+	}
+	gotUsage := make(map[string]FlavorResourceQuantities)
+	for name, cq := range cache.clusterQueues {
+		gotUsage[name] = cq.Usage
+	}
+	if diff := cmp.Diff(wantUsage, gotUsage); diff != "" {
+		t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+	}
+	wantQueue := &queue{
+		key:               "ns/lq",
+		admittedWorkloads: 1,
+		usage:             FlavorResourceQuantities{"default": {corev1.ResourceCPU: 2_000}},
+	}
+	if diff := cmp.Diff(wantQueue, cache.clusterQueues["a"].localQueues["ns/lq"], cmp.AllowUnexported(queue{})); diff != "" {
+		t.Errorf("Unexpected localQueue (-want,+got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(errCohortNotFound.Error(), messageOrEmpty(cache.RecomputeCohort("three"))); diff != "" {
+		t.Errorf("Unexpected error for an unknown cohort (-want,+got):\n%s", diff)
+	}
+}
+
+func TestCohortChangeHandler(t *testing.T) {
+	type cohortChange struct {
+		Name   string
+		Exists bool
+	}
+	var changes []cohortChange
+	cache := New(utiltesting.NewFakeClient(), WithCohortChangeHandler(func(name string, exists bool) {
+		changes = append(changes, cohortChange{Name: name, Exists: exists})
+	}))
+	cqs := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").Cohort("one").Obj(),
+		utiltesting.MakeClusterQueue("b").Cohort("one").Obj(),
+		utiltesting.MakeClusterQueue("c").Cohort("two").Obj(),
+	}
+	for _, cq := range cqs {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	cache.DeleteClusterQueue(cqs[0])
+	moved := cqs[1].DeepCopy()
+	moved.Spec.Cohort = "three"
+	if _, err := cache.UpdateClusterQueue(moved); err != nil {
+		t.Fatalf("Updating ClusterQueue: %v", err)
+	}
+	cache.DeleteClusterQueue(cqs[2])
+
+	wantChanges := []cohortChange{
+		{Name: "one", Exists: true},
+		{Name: "two", Exists: true},
+		{Name: "one", Exists: false},
+		{Name: "three", Exists: true},
+		{Name: "two", Exists: false},
+	}
+	if diff := cmp.Diff(wantChanges, changes); diff != "" {
+		t.Errorf("Unexpected cohort changes (-want,+got):\n%s", diff)
+	}
+	gotCohorts := sets.New[string]()
+	for name := range cache.cohorts {
+		gotCohorts.Insert(name)
+	}
+	if diff := cmp.Diff(sets.New("three"), gotCohorts); diff != "" {
+		t.Errorf("Unexpected cohorts (-want,+got):\n%s", diff)
+	}
+}
+
+func TestCohortBorrowOrder(t *testing.T) {
+	cases := map[string]struct {
+		cqs    []*kueue.ClusterQueue
+		cohort string
+		want   []string
+	}{
+		"default priority": {
+			cqs: []*kueue.ClusterQueue{
+				utiltesting.MakeClusterQueue("c").Cohort("one").Obj(),
+				utiltesting.MakeClusterQueue("a").Cohort("one").Obj(),
+				utiltesting.MakeClusterQueue("b").Cohort("one").Obj(),
+			},
+			cohort: "one",
+			want:   []string{"a", "b", "c"},
+		},
+		"mixed priorities": {
+			cqs: []*kueue.ClusterQueue{
+				utiltesting.MakeClusterQueue("a").Cohort("one").Obj(),
+				utiltesting.MakeClusterQueue("b").Cohort("one").
+					Annotation(BorrowingPriorityAnnotation, "10").Obj(),
+				utiltesting.MakeClusterQueue("c").Cohort("one").
+					Annotation(BorrowingPriorityAnnotation, "-5").Obj(),
+				utiltesting.MakeClusterQueue("d").Cohort("one").
+					Annotation(BorrowingPriorityAnnotation, "10").Obj(),
+				utiltesting.MakeClusterQueue("e").Cohort("two").
+					Annotation(BorrowingPriorityAnnotation, "100").Obj(),
+			},
+			cohort: "one",
+			want:   []string{"b", "d", "a", "c"},
+		},
+		"unknown cohort": {
+			cqs: []*kueue.ClusterQueue{
+				utiltesting.MakeClusterQueue("a").Cohort("one").Obj(),
+			},
+			cohort: "two",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			for _, cq := range tc.cqs {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			if diff := cmp.Diff(tc.want, cache.CohortBorrowOrder(tc.cohort)); diff != "" {
+				t.Errorf("Unexpected borrow order (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateClusterQueue(t *testing.T) {
+	cases := map[string]struct {
+		cq        *kueue.ClusterQueue
+		wantError string
+	}{
+		"valid": {
+			cq: utiltesting.MakeClusterQueue("foo").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+				ResourceGroup(
+					*utiltesting.MakeFlavorQuotas("model_a").Resource("example.com/gpu", "5").Obj(),
+					*utiltesting.MakeFlavorQuotas("model_b").Resource("example.com/gpu", "5").Obj(),
+				).
+				Cohort("one").
+				Obj(),
+		},
+		"duplicate resource across groups": {
+			cq: utiltesting.MakeClusterQueue("foo").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "10").Obj()).
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "10").Obj()).
+				Obj(),
+			wantError: "resource cpu is covered by resource groups 0 and 1",
+		},
+		"invalid namespaceSelector": {
+			cq: utiltesting.MakeClusterQueue("foo").
+				NamespaceSelector(&metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{{
+						Key:      "team",
+						Operator: "Unknown",
+					}},
+				}).
+				Obj(),
+			wantError: `"Unknown" is not a valid label selector operator`,
+		},
+		"invalid annotation": {
+			cq: utiltesting.MakeClusterQueue("foo").
+				Annotation(BorrowingPriorityAnnotation, "high").
+				Obj(),
+			wantError: `parsing annotation kueue.x-k8s.io/borrowing-priority: strconv.ParseInt: parsing "high": invalid syntax`,
+		},
+		"invalid workload size annotation": {
+			cq: utiltesting.MakeClusterQueue("foo").
+				Annotation(MaxWorkloadSizeAnnotation, "cpu").
+				Obj(),
+			wantError: `parsing annotation kueue.x-k8s.io/max-workload-size: invalid entry "cpu"`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			err := cache.ValidateClusterQueue(tc.cq)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if len(cache.clusterQueues) != 0 || len(cache.cohorts) != 0 {
+				t.Error("Validating the ClusterQueue modified the cache")
+			}
+		})
+	}
+}
+
+func TestAddClusterQueueInvalidMinBorrowingPriority(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	cq := utiltesting.MakeClusterQueue("foo").
+		Annotation(MinBorrowingPriorityAnnotation, "high").
+		Obj()
+	if err := cache.AddClusterQueue(context.Background(), cq); err == nil {
+		t.Error("Expected an error parsing the minimum borrowing priority")
+	}
+}
+
+func TestUpdateClusterQueueInvalidAnnotation(t *testing.T) {
+	base := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Annotation(MaxAdmittedWorkloadsAnnotation, "2").
+		Annotation(NamespaceCapsAnnotation, "ns/default:cpu=4").
+		Obj()
+	cases := map[string]string{
+		MinBorrowingPriorityAnnotation:     "high",
+		BorrowingPriorityAnnotation:        "high",
+		MaxAdmittedWorkloadsAnnotation:     "many",
+		ReclaimableCheckPriorityAnnotation: "low",
+		NamespaceCapsAnnotation:            "cpu=4",
+		MinWorkloadSizeAnnotation:          "cpu",
+		MaxWorkloadSizeAnnotation:          "cpu",
+		UsageCapsAnnotation:                "cpu=12",
+	}
+	for annotation, value := range cases {
+		t.Run(annotation, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			if err := cache.AddClusterQueue(context.Background(), base); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			updated := utiltesting.MakeClusterQueue("foo").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "20").Obj()).
+				Annotation(annotation, value).
+				Obj()
+			if _, err := cache.UpdateClusterQueue(updated); err == nil {
+				t.Fatal("Expected an error updating the ClusterQueue")
+			}
+			cq := cache.clusterQueues["foo"]
+			if diff := cmp.Diff(pointer.Int32(2), cq.MaxAdmittedWorkloads); diff != "" {
+				t.Errorf("Unexpected MaxAdmittedWorkloads (-want,+got):\n%s", diff)
+			}
+			wantNamespaceCaps := map[string]FlavorResourceQuantities{"ns": {"default": {corev1.ResourceCPU: 4_000}}}
+			if diff := cmp.Diff(wantNamespaceCaps, cq.NamespaceCaps); diff != "" {
+				t.Errorf("Unexpected NamespaceCaps (-want,+got):\n%s", diff)
+			}
+			if got := cq.resourceQuota("default", corev1.ResourceCPU).Nominal; got != 10_000 {
+				t.Errorf("Nominal quota = %d, want 10000", got)
+			}
+		})
+	}
+}
+
+func TestAddClusterQueueDuplicatesAcrossResourceGroups(t *testing.T) {
+	cases := map[string]struct {
+		cq        *kueue.ClusterQueue
+		wantError string
+	}{
+		"duplicate flavor": {
+			cq: utiltesting.MakeClusterQueue("foo").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource("example.com/gpu", "5").Obj()).
+				Obj(),
+			wantError: "flavor default is used in resource groups 0 and 1",
+		},
+		"duplicate resource": {
+			cq: utiltesting.MakeClusterQueue("foo").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "10").Obj()).
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "10").Obj()).
+				Obj(),
+			wantError: "resource cpu is covered by resource groups 0 and 1",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			err := cache.AddClusterQueue(context.Background(), tc.cq)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if _, found := cache.clusterQueues["foo"]; found {
+				t.Error("The invalid ClusterQueue was added to the cache")
+			}
+		})
+	}
+}
+
+func TestValidateStoredUsage(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	workloads := []*kueue.Workload{
+		utiltesting.MakeWorkload("a", "").
+			Request(corev1.ResourceCPU, "1").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("b", "").
+			Request(corev1.ResourceCPU, "2").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "2").Obj()).
+			Obj(),
+	}
+	cases := map[string]struct {
+		cq        string
+		corrupt   func(*Cache)
+		want      []string
+		wantError string
+	}{
+		"consistent usage": {
+			cq: "foo",
+		},
+		"stale footprint": {
+			cq: "foo",
+			corrupt: func(c *Cache) {
+				c.clusterQueues["foo"].Workloads["/b"].TotalRequests[0].Requests[corev1.ResourceCPU] = 5_000
+			},
+			want: []string{"/b"},
+		},
+		"unknown clusterQueue": {
+			cq:        "bar",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			for _, wl := range workloads {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", workload.Key(wl))
+				}
+			}
+			if tc.corrupt != nil {
+				tc.corrupt(cache)
+			}
+			got, err := cache.ValidateStoredUsage(tc.cq)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Unexpected stale workloads (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMoveWorkload(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("two").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("full").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "1").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("small").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Annotation(MaxWorkloadSizeAnnotation, "cpu=1").
+			Obj(),
+		utiltesting.MakeClusterQueue("limited").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Annotation(MaxAdmittedWorkloadsAnnotation, "0").
+			Obj(),
+	}
+	wl := utiltesting.MakeWorkload("a", "ns").
+		Request(corev1.ResourceCPU, "2").
+		Admit(utiltesting.MakeAdmission("one").Assignment(corev1.ResourceCPU, "default", "2").Obj()).
+		Obj()
+	wl.Annotations = map[string]string{AdmissionChecksAnnotation: "provision=Pending"}
+
+	type result struct {
+		Workloads     sets.Set[string]
+		UsedResources FlavorResourceQuantities
+	}
+	empty := result{
+		Workloads:     sets.New[string](),
+		UsedResources: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 0}},
+	}
+	holding := result{
+		Workloads:     sets.New("ns/a"),
+		UsedResources: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 2_000}},
+	}
+	unchanged := map[string]result{
+		"one":     holding,
+		"two":     empty,
+		"full":    empty,
+		"small":   empty,
+		"limited": empty,
+	}
+	cases := map[string]struct {
+		wlKey       string
+		from, to    string
+		wantError   string
+		wantResults map[string]result
+	}{
+		"success": {
+			wlKey: "ns/a",
+			from:  "one",
+			to:    "two",
+			wantResults: map[string]result{
+				"one":     empty,
+				"two":     holding,
+				"full":    empty,
+				"small":   empty,
+				"limited": empty,
+			},
+		},
+		"source clusterQueue doesn't exist": {
+			wlKey:       "ns/a",
+			from:        "three",
+			to:          "two",
+			wantError:   "source cluster queue not found",
+			wantResults: unchanged,
+		},
+		"destination clusterQueue doesn't exist": {
+			wlKey:       "ns/a",
+			from:        "one",
+			to:          "three",
+			wantError:   "destination cluster queue not found",
+			wantResults: unchanged,
+		},
+		"workload not in the source clusterQueue": {
+			wlKey:       "ns/a",
+			from:        "two",
+			to:          "one",
+			wantError:   ErrWorkloadNotFound.Error(),
+			wantResults: unchanged,
+		},
+		"workload doesn't fit in the destination": {
+			wlKey:       "ns/a",
+			from:        "one",
+			to:          "full",
+			wantError:   errWorkloadDoesntFit.Error(),
+			wantResults: unchanged,
+		},
+		"workload larger than the maximum size of the destination": {
+			wlKey:       "ns/a",
+			from:        "one",
+			to:          "small",
+			wantError:   ErrWorkloadTooLarge.Error() + ": requests 2 of cpu, the maximum is 1",
+			wantResults: unchanged,
+		},
+		"destination at its concurrency limit": {
+			wlKey:       "ns/a",
+			from:        "one",
+			to:          "limited",
+			wantError:   errConcurrencyLimitReached.Error(),
+			wantResults: unchanged,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			if !cache.AddOrUpdateWorkload(wl) {
+				t.Fatalf("Workload %s was not added", workload.Key(wl))
+			}
+			err := cache.MoveWorkload(tc.wlKey, tc.from, tc.to)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			gotResults := make(map[string]result)
+			for name, cq := range cache.clusterQueues {
+				gotResults[name] = result{Workloads: sets.KeySet(cq.Workloads), UsedResources: cq.Usage}
+			}
+			if diff := cmp.Diff(tc.wantResults, gotResults); diff != "" {
+				t.Errorf("Unexpected clusterQueues (-want,+got):\n%s", diff)
+			}
+			if err != nil && cache.clusterQueues[tc.from] != nil {
+				if got := cache.WorkloadsPendingChecks(tc.from); len(got) != len(tc.wantResults[tc.from].Workloads) {
+					t.Errorf("WorkloadsPendingChecks(%q) returned %d workloads after the failed move, want %d", tc.from, len(got), len(tc.wantResults[tc.from].Workloads))
+				}
+			}
+			if err == nil {
+				if got := cache.clusterQueues[tc.to].Workloads[tc.wlKey].ClusterQueue; got != tc.to {
+					t.Errorf("Moved workload has ClusterQueue %q, want %q", got, tc.to)
+				}
+				if got := cache.WorkloadsPendingChecks(tc.from); len(got) != 0 {
+					t.Errorf("WorkloadsPendingChecks(%q) returned %d workloads, want none", tc.from, len(got))
+				}
+				gotPending := cache.WorkloadsPendingChecks(tc.to)
+				if len(gotPending) != 1 || workload.Key(gotPending[0].Obj) != tc.wlKey {
+					t.Errorf("WorkloadsPendingChecks(%q) = %v, want only %s", tc.to, gotPending, tc.wlKey)
+				}
+			}
+		})
+	}
+}
+
+func TestListResourceFlavors(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	if diff := cmp.Diff([]string{}, cache.ListResourceFlavors()); diff != "" {
+		t.Errorf("Unexpected flavors in an empty cache (-want,+got):\n%s", diff)
+	}
+	for _, name := range []string{"spot", "on-demand", "model-a"} {
+		cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor(name).Obj())
+	}
+	// Updating a flavor doesn't duplicate it.
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("spot").Label("type", "spot").Obj())
+	if diff := cmp.Diff([]string{"model-a", "on-demand", "spot"}, cache.ListResourceFlavors()); diff != "" {
+		t.Errorf("Unexpected flavors (-want,+got):\n%s", diff)
+	}
+	if !cache.ResourceFlavorExists("on-demand") {
+		t.Error("Flavor on-demand doesn't exist")
+	}
+	if cache.ResourceFlavorExists("model-b") {
+		t.Error("Unknown flavor model-b exists")
+	}
+
+	cache.DeleteResourceFlavor(utiltesting.MakeResourceFlavor("on-demand").Obj())
+	if diff := cmp.Diff([]string{"model-a", "spot"}, cache.ListResourceFlavors()); diff != "" {
+		t.Errorf("Unexpected flavors after the delete (-want,+got):\n%s", diff)
+	}
+	if cache.ResourceFlavorExists("on-demand") {
+		t.Error("Deleted flavor on-demand exists")
+	}
+}
+
+func TestClusterQueueCohort(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	for _, cq := range []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").Cohort("one").Obj(),
+		utiltesting.MakeClusterQueue("d").Obj(),
+	} {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	cases := map[string]struct {
+		cq         string
+		wantCohort string
+		wantFound  bool
+		wantError  string
+	}{
+		"in a cohort": {
+			cq:         "a",
+			wantCohort: "one",
+			wantFound:  true,
+		},
+		"without cohort": {
+			cq: "d",
+		},
+		"unknown clusterQueue": {
+			cq:        "z",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cohort, found, err := cache.ClusterQueueCohort(tc.cq)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if cohort != tc.wantCohort || found != tc.wantFound {
+				t.Errorf("ClusterQueueCohort() = %q, %t, want %q, %t", cohort, found, tc.wantCohort, tc.wantFound)
+			}
+		})
+	}
+}
+
+func TestFlavorCount(t *testing.T) {
+	cases := map[string]struct {
+		cq        *kueue.ClusterQueue
+		cqName    string
+		want      int
+		wantError string
+	}{
+		"distinct flavors across groups": {
+			cq: utiltesting.MakeClusterQueue("foo").
+				ResourceGroup(
+					*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "10").Obj(),
+					*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "10").Obj(),
+				).
+				ResourceGroup(
+					*utiltesting.MakeFlavorQuotas("model_a").Resource("example.com/gpu", "5").Obj(),
+					*utiltesting.MakeFlavorQuotas("model_b").Resource("example.com/gpu", "5").Obj(),
+				).
+				Obj(),
+			cqName: "foo",
+			want:   4,
+		},
+		"no resource groups": {
+			cq:     utiltesting.MakeClusterQueue("foo").Obj(),
+			cqName: "foo",
+		},
+		"unknown clusterQueue": {
+			cq:        utiltesting.MakeClusterQueue("foo").Obj(),
+			cqName:    "bar",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), tc.cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			got, err := cache.FlavorCount(tc.cqName)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if got != tc.want {
+				t.Errorf("FlavorCount() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFlavorOrder(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10").
+				Obj(),
+		).
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("model_a").
+				Resource("example.com/gpu", "5").
+				Obj(),
+			*utiltesting.MakeFlavorQuotas("model_b").
+				Resource("example.com/gpu", "5").
+				Obj(),
+		).
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("any").
+				Resource(corev1.ResourceMemory, "5Gi").
+				Obj(),
+			*utiltesting.MakeFlavorQuotas("mem_a").
+				Resource(corev1.ResourceMemory, "5Gi").
+				Obj(),
+			*utiltesting.MakeFlavorQuotas("mem_b").
+				Resource(corev1.ResourceMemory, "5Gi").
+				Obj(),
+		).
+		Annotation(DefaultFlavorsAnnotation, "any").
+		Obj()
+	cases := map[string]struct {
+		cq        string
+		resource  corev1.ResourceName
+		want      []string
+		wantError string
+	}{
+		"single flavor": {
+			cq:       "foo",
+			resource: corev1.ResourceCPU,
+			want:     []string{"default"},
+		},
+		"multiple flavors in order": {
+			cq:       "foo",
+			resource: "example.com/gpu",
+			want:     []string{"model_a", "model_b"},
+		},
+		"default flavor last": {
+			cq:       "foo",
+			resource: corev1.ResourceMemory,
+			want:     []string{"mem_a", "mem_b", "any"},
+		},
+		"resource not covered": {
+			cq:       "foo",
+			resource: corev1.ResourceEphemeralStorage,
+		},
+		"unknown clusterQueue": {
+			cq:        "bar",
+			resource:  corev1.ResourceCPU,
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			got, err := cache.FlavorOrder(tc.cq, tc.resource)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected flavors (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWorkloadInfo(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	admitted := utiltesting.MakeWorkload("admitted", "ns").
+		Request(corev1.ResourceCPU, "2").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "2").Obj()).
+		Obj()
+	assumed := utiltesting.MakeWorkload("assumed", "ns").
+		Request(corev1.ResourceCPU, "3").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "3").Obj()).
+		Obj()
+
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	cache.AddOrUpdateWorkload(admitted)
+	if err := cache.AssumeWorkload(assumed); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+
+	cases := map[string]struct {
+		key       string
+		wantInfo  *workload.Info
+		wantCQ    string
+		wantFound bool
+	}{
+		"admitted": {
+			key:       "ns/admitted",
+			wantInfo:  workload.NewInfo(admitted),
+			wantCQ:    "foo",
+			wantFound: true,
+		},
+		"assumed": {
+			key:       "ns/assumed",
+			wantInfo:  workload.NewInfo(assumed),
+			wantCQ:    "foo",
+			wantFound: true,
+		},
+		"not found": {
+			key: "ns/other",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			gotInfo, gotCQ, gotFound := cache.WorkloadInfo(tc.key)
+			if gotFound != tc.wantFound {
+				t.Errorf("WorkloadInfo() found = %t, want %t", gotFound, tc.wantFound)
+			}
+			if gotCQ != tc.wantCQ {
+				t.Errorf("WorkloadInfo() clusterQueue = %q, want %q", gotCQ, tc.wantCQ)
+			}
+			if diff := cmp.Diff(tc.wantInfo, gotInfo); diff != "" {
+				t.Errorf("Unexpected info (-want,+got):\n%s", diff)
+			}
+		})
+	}
+
+	info, _, _ := cache.WorkloadInfo("ns/admitted")
+	info.TotalRequests[0].Requests[corev1.ResourceCPU] = 8_000
+	info.Obj.Status.Admission.ClusterQueue = "bar"
+	if diff := cmp.Diff(workload.NewInfo(admitted), cache.clusterQueues["foo"].Workloads["ns/admitted"]); diff != "" {
+		t.Errorf("Modifying the returned info changed the cache (-want,+got):\n%s", diff)
+	}
+}
+
+func TestResourceAliases(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("model_a").Resource("example.com/gpu", "10").Obj()).
+		Obj()
+	wl := utiltesting.MakeWorkload("wl", "ns").
+		Request("nvidia.com/gpu", "3").
+		Admit(utiltesting.MakeAdmission("foo").Assignment("nvidia.com/gpu", "model_a", "3").Obj()).
+		Obj()
+
+	cache := New(utiltesting.NewFakeClient(), WithResourceAliases(map[corev1.ResourceName]corev1.ResourceName{
+		"nvidia.com/gpu": "example.com/gpu",
+	}))
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("model_a").Obj())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatal("Failed adding workload")
+	}
+
+	gotUsage, gotWorkloads, err := cache.Usage(cq)
+	if err != nil {
+		t.Fatalf("Getting usage: %v", err)
+	}
+	wantUsage := []kueue.FlavorUsage{{
+		Name: "model_a",
+		Resources: []kueue.ResourceUsage{{
+			Name:  "example.com/gpu",
+			Total: resource.MustParse("3"),
+		}},
+	}}
+	if diff := cmp.Diff(wantUsage, gotUsage); diff != "" {
+		t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+	}
+	if gotWorkloads != 1 {
+		t.Errorf("Got %d admitted workloads, want 1", gotWorkloads)
+	}
+	if flavor := wl.Status.Admission.PodSetAssignments[0].Flavors["nvidia.com/gpu"]; flavor != "model_a" {
+		t.Errorf("The admission of the workload object was modified, got flavor %q for the alias", flavor)
+	}
+	stale, err := cache.ValidateStoredUsage("foo")
+	if err != nil {
+		t.Fatalf("Validating stored usage: %v", err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("Got stale workloads %v, want none", stale)
+	}
+
+	for gpus, want := range map[string]bool{"7": true, "8": false} {
+		aliased := utiltesting.MakeWorkload("aliased-"+gpus, "ns").
+			Request("nvidia.com/gpu", gpus).
+			Admit(utiltesting.MakeAdmission("foo").Assignment("nvidia.com/gpu", "model_a", gpus).Obj()).
+			Obj()
+		fits, err := cache.CanFit("foo", workload.NewInfo(aliased))
+		if err != nil {
+			t.Fatalf("CanFit(%s): %v", aliased.Name, err)
+		}
+		if fits != want {
+			t.Errorf("CanFit(%s) = %t, want %t", aliased.Name, fits, want)
+		}
+	}
+	pods, breakdown, err := cache.MaxAdmissiblePods("foo", utiltesting.MakePodSet("workers", 5).Request("nvidia.com/gpu", "2").Obj())
+	if err != nil {
+		t.Fatalf("MaxAdmissiblePods: %v", err)
+	}
+	if pods != 3 {
+		t.Errorf("MaxAdmissiblePods = %d, want 3", pods)
+	}
+	if diff := cmp.Diff(map[kueue.ResourceFlavorReference]int32{"model_a": 3}, breakdown); diff != "" {
+		t.Errorf("Unexpected pods per flavor (-want,+got):\n%s", diff)
+	}
+
+	if err := cache.DeleteWorkload(wl); err != nil {
+		t.Fatalf("Deleting workload: %v", err)
+	}
+	if diff := cmp.Diff(FlavorResourceQuantities{"model_a": {"example.com/gpu": 0}}, cache.clusterQueues["foo"].Usage); diff != "" {
+		t.Errorf("Unexpected usage after deleting the workload (-want,+got):\n%s", diff)
+	}
+}
+
+func TestRequestPercentages(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("model_a").Resource("example.com/gpu", "10").Obj()).
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	cases := map[string]struct {
+		annotations map[string]string
+		want        FlavorResourceQuantities
+	}{
+		"absolute requests": {
+			want: FlavorResourceQuantities{
+				"model_a": {"example.com/gpu": 1},
+				"default": {corev1.ResourceCPU: 2_000},
+			},
+		},
+		"percentage of the flavor quota": {
+			annotations: map[string]string{RequestPercentagesAnnotation: "main:example.com/gpu=50%"},
+			want: FlavorResourceQuantities{
+				"model_a": {"example.com/gpu": 5},
+				"default": {corev1.ResourceCPU: 2_000},
+			},
+		},
+		"percentage for another podSet": {
+			annotations: map[string]string{RequestPercentagesAnnotation: "workers:example.com/gpu=50"},
+			want: FlavorResourceQuantities{
+				"model_a": {"example.com/gpu": 1},
+				"default": {corev1.ResourceCPU: 2_000},
+			},
+		},
+		"malformed percentage": {
+			annotations: map[string]string{RequestPercentagesAnnotation: "main:example.com/gpu=half"},
+			want: FlavorResourceQuantities{
+				"model_a": {"example.com/gpu": 1},
+				"default": {corev1.ResourceCPU: 2_000},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			wl := utiltesting.MakeWorkload("a", "ns").
+				Request("example.com/gpu", "1").
+				Request(corev1.ResourceCPU, "2").
+				Admit(utiltesting.MakeAdmission("foo").
+					Assignment("example.com/gpu", "model_a", "1").
+					Assignment(corev1.ResourceCPU, "default", "2").
+					Obj()).
+				Obj()
+			wl.Annotations = tc.annotations
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			if !cache.AddOrUpdateWorkload(wl) {
+				t.Fatal("Failed adding workload")
+			}
+			if diff := cmp.Diff(tc.want, cache.clusterQueues["foo"].Usage); diff != "" {
+				t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+			}
+			if err := cache.DeleteWorkload(wl); err != nil {
+				t.Fatalf("Deleting workload: %v", err)
+			}
+			wantEmpty := FlavorResourceQuantities{
+				"model_a": {"example.com/gpu": 0},
+				"default": {corev1.ResourceCPU: 0},
+			}
+			if diff := cmp.Diff(wantEmpty, cache.clusterQueues["foo"].Usage); diff != "" {
+				t.Errorf("Unexpected usage after deleting the workload (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPendingWorkloadsCount(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	lq := utiltesting.MakeLocalQueue("lq", "ns").ClusterQueue("foo").Obj()
+	pending := func(name string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").Queue("lq").Request(corev1.ResourceCPU, "1").Obj()
+	}
+	admitted := func(name string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Queue("lq").
+			Request(corev1.ResourceCPU, "1").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+			Obj()
+	}
+
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if err := cache.AddLocalQueue(lq); err != nil {
+		t.Fatalf("Adding LocalQueue: %v", err)
+	}
+	checkCounts := func(wantPending, wantAdmitted int) {
+		t.Helper()
+		if got := cache.PendingWorkloadsCount("foo"); got != wantPending {
+			t.Errorf("PendingWorkloadsCount() = %d, want %d", got, wantPending)
+		}
+		if got := len(cache.clusterQueues["foo"].Workloads); got != wantAdmitted {
+			t.Errorf("Got %d admitted workloads, want %d", got, wantAdmitted)
+		}
+	}
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if !cache.AddOrUpdatePendingWorkload(pending(name)) {
+			t.Errorf("Failed adding pending workload %s", name)
+		}
+	}
+	// Updating a pending workload doesn't count it twice.
+	cache.AddOrUpdatePendingWorkload(pending("a"))
+	checkCounts(4, 0)
+
+	cache.AddOrUpdateWorkload(admitted("a"))
+	if err := cache.AssumeWorkload(admitted("b")); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+	checkCounts(2, 2)
+
+	if cache.AddOrUpdatePendingWorkload(admitted("a")) {
+		t.Error("An admitted workload was recorded as pending")
+	}
+	cache.DeletePendingWorkload(pending("c"))
+	checkCounts(1, 2)
+
+	if cache.AddOrUpdatePendingWorkload(utiltesting.MakeWorkload("e", "ns").Queue("other").Obj()) {
+		t.Error("A workload in an unknown LocalQueue was recorded as pending")
+	}
+	cache.DeleteLocalQueue(lq)
+	checkCounts(0, 2)
+	if got := cache.PendingWorkloadsCount("bar"); got != 0 {
+		t.Errorf("PendingWorkloadsCount() for unknown ClusterQueue = %d, want 0", got)
+	}
+}
+
+func TestOldestPendingWorkload(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	lq := utiltesting.MakeLocalQueue("lq", "ns").ClusterQueue("foo").Obj()
+	pending := func(name string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").Queue("lq").Request(corev1.ResourceCPU, "1").Obj()
+	}
+
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	cache := New(utiltesting.NewFakeClient())
+	cache.clock = fakeClock
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if err := cache.AddLocalQueue(lq); err != nil {
+		t.Fatalf("Adding LocalQueue: %v", err)
+	}
+	check := func(wantKey string, wantWait time.Duration) {
+		t.Helper()
+		key, wait, err := cache.OldestPendingWorkload("foo")
+		if err != nil {
+			t.Fatalf("OldestPendingWorkload failed: %v", err)
+		}
+		if key != wantKey || wait != wantWait {
+			t.Errorf("OldestPendingWorkload() = %q, %v, want %q, %v", key, wait, wantKey, wantWait)
+		}
+	}
+
+	check("", 0)
+	for _, name := range []string{"c", "b"} {
+		cache.AddOrUpdatePendingWorkload(pending(name))
+	}
+	fakeClock.Step(time.Minute)
+	cache.AddOrUpdatePendingWorkload(pending("a"))
+	fakeClock.Step(time.Minute)
+	// Ties are broken by key.
+	check("ns/b", 2*time.Minute)
+
+	// Updating a pending workload keeps the time it was first seen.
+	cache.AddOrUpdatePendingWorkload(pending("b"))
+	check("ns/b", 2*time.Minute)
+
+	cache.DeletePendingWorkload(pending("b"))
+	check("ns/c", 2*time.Minute)
+	cache.DeletePendingWorkload(pending("c"))
+	check("ns/a", time.Minute)
+	cache.DeletePendingWorkload(pending("a"))
+	check("", 0)
+
+	_, _, err := cache.OldestPendingWorkload("bar")
+	if diff := cmp.Diff(errCqNotFound.Error(), messageOrEmpty(err)); diff != "" {
+		t.Errorf("Unexpected error for an unknown ClusterQueue (-want,+got):\n%s", diff)
+	}
+}
+
+func TestQueueDepthByPriority(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	lq := utiltesting.MakeLocalQueue("lq", "ns").ClusterQueue("foo").Obj()
+	pending := func(name string, priority int32) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").Queue("lq").Priority(priority).Request(corev1.ResourceCPU, "1").Obj()
+	}
+
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if err := cache.AddLocalQueue(lq); err != nil {
+		t.Fatalf("Adding LocalQueue: %v", err)
+	}
+	check := func(want map[int32]int) {
+		t.Helper()
+		got, err := cache.QueueDepthByPriority("foo")
+		if err != nil {
+			t.Fatalf("QueueDepthByPriority() failed: %v", err)
+		}
+		if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("Unexpected queue depth (-want,+got):\n%s", diff)
+		}
+	}
+
+	check(nil)
+	for _, wl := range []*kueue.Workload{
+		pending("a", 0),
+		pending("b", 100),
+		pending("c", 100),
+		pending("d", 1000),
+		utiltesting.MakeWorkload("e", "ns").Queue("lq").Obj(),
+	} {
+		if !cache.AddOrUpdatePendingWorkload(wl) {
+			t.Fatalf("Failed adding pending workload %s", wl.Name)
+		}
+	}
+	check(map[int32]int{0: 2, 100: 2, 1000: 1})
+
+	// Updating the priority moves the workload to another bucket.
+	cache.AddOrUpdatePendingWorkload(pending("c", 1000))
+	check(map[int32]int{0: 2, 100: 1, 1000: 2})
+
+	cache.DeletePendingWorkload(pending("d", 1000))
+	check(map[int32]int{0: 2, 100: 1, 1000: 1})
+
+	if _, err := cache.QueueDepthByPriority("bar"); err != errCqNotFound {
+		t.Errorf("Got error %v for an unknown ClusterQueue, want %v", err, errCqNotFound)
+	}
+}
+
+func TestWorkloadCount(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	for _, name := range []string{"a", "b"} {
+		cq := utiltesting.MakeClusterQueue(name).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj()
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+		if err := cache.AddLocalQueue(utiltesting.MakeLocalQueue(name+"-lq", "ns").ClusterQueue(name).Obj()); err != nil {
+			t.Fatalf("Adding LocalQueue: %v", err)
+		}
+	}
+	if err := cache.AddClusterQueue(context.Background(), utiltesting.MakeClusterQueue("standalone").Obj()); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	admitted := func(name, cq string, priority int32) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Queue(cq+"-lq").
+			Priority(priority).
+			Request(corev1.ResourceCPU, "1").
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+			Obj()
+	}
+	pending := func(name, cq string, priority int32) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").Queue(cq + "-lq").Priority(priority).Obj()
+	}
+	for _, wl := range []*kueue.Workload{admitted("a1", "a", 0), admitted("a2", "a", 100)} {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Workload %s was not added", wl.Name)
+		}
+	}
+	if err := cache.AssumeWorkload(admitted("b1", "b", 100)); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+	for _, wl := range []*kueue.Workload{pending("a3", "a", 10), pending("b2", "b", 1000)} {
+		if !cache.AddOrUpdatePendingWorkload(wl) {
+			t.Fatalf("Pending workload %s was not added", wl.Name)
+		}
+	}
+
+	cases := map[string]struct {
+		filter WorkloadFilter
+		want   int
+	}{
+		"all": {
+			want: 5,
+		},
+		"clusterQueue": {
+			filter: WorkloadFilter{ClusterQueue: "a"},
+			want:   3,
+		},
+		"cohort": {
+			filter: WorkloadFilter{Cohort: "one"},
+			want:   5,
+		},
+		"clusterQueue not in the cohort": {
+			filter: WorkloadFilter{ClusterQueue: "standalone", Cohort: "one"},
+		},
+		"unknown cohort": {
+			filter: WorkloadFilter{Cohort: "two"},
+		},
+		"unknown clusterQueue": {
+			filter: WorkloadFilter{ClusterQueue: "nonexistent"},
+		},
+		"admitted": {
+			filter: WorkloadFilter{States: []WorkloadState{WorkloadStateAdmitted}},
+			want:   2,
+		},
+		"assumed": {
+			filter: WorkloadFilter{States: []WorkloadState{WorkloadStateAssumed}},
+			want:   1,
+		},
+		"admitted or assumed in a clusterQueue": {
+			filter: WorkloadFilter{ClusterQueue: "b", States: []WorkloadState{WorkloadStateAdmitted, WorkloadStateAssumed}},
+			want:   1,
+		},
+		"pending": {
+			filter: WorkloadFilter{States: []WorkloadState{WorkloadStatePending}},
+			want:   2,
+		},
+		"priority range": {
+			filter: WorkloadFilter{MinPriority: pointer.Int32(10), MaxPriority: pointer.Int32(100)},
+			want:   3,
+		},
+		"minimum priority of pending workloads in the cohort": {
+			filter: WorkloadFilter{Cohort: "one", States: []WorkloadState{WorkloadStatePending}, MinPriority: pointer.Int32(100)},
+			want:   1,
+		},
+		"maximum priority in a clusterQueue": {
+			filter: WorkloadFilter{ClusterQueue: "a", MaxPriority: pointer.Int32(10)},
+			want:   2,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := cache.WorkloadCount(tc.filter); got != tc.want {
+				t.Errorf("WorkloadCount() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInadmissibleReason(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	admitted := func(name string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Request(corev1.ResourceCPU, "1").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+			Obj()
+	}
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	checkReason := func(wlKey, wantReason string, wantFound bool) {
+		t.Helper()
+		reason, found := cache.InadmissibleReason(wlKey)
+		if reason != wantReason || found != wantFound {
+			t.Errorf("InadmissibleReason(%q) = (%q, %t), want (%q, %t)", wlKey, reason, found, wantReason, wantFound)
+		}
+	}
+
+	checkReason("ns/a", "", false)
+	for _, name := range []string{"a", "b", "c"} {
+		cache.SetInadmissible("ns/"+name, "insufficient quota")
+	}
+	cache.SetInadmissible("ns/a", "flavor not found")
+	checkReason("ns/a", "flavor not found", true)
+	checkReason("ns/b", "insufficient quota", true)
+
+	// Admission clears the reason.
+	cache.AddOrUpdateWorkload(admitted("a"))
+	checkReason("ns/a", "", false)
+	if err := cache.AssumeWorkload(admitted("b")); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+	checkReason("ns/b", "", false)
+
+	// So does the deletion of the pending workload.
+	cache.DeletePendingWorkload(utiltesting.MakeWorkload("c", "ns").Obj())
+	checkReason("ns/c", "", false)
+}
+
+func TestClusterQueueHasWorkload(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	wl := utiltesting.MakeWorkload("a", "ns").
+		Request(corev1.ResourceCPU, "1").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+		Obj()
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatal("Failed adding workload")
+	}
+
+	cases := map[string]struct {
+		cq        string
+		wl        string
+		want      bool
+		wantError string
+	}{
+		"workload in the clusterQueue": {
+			cq:   "foo",
+			wl:   "ns/a",
+			want: true,
+		},
+		"workload not in the clusterQueue": {
+			cq: "foo",
+			wl: "ns/b",
+		},
+		"unknown clusterQueue": {
+			cq:        "bar",
+			wl:        "ns/a",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := cache.ClusterQueueHasWorkload(tc.cq, tc.wl)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if got != tc.want {
+				t.Errorf("ClusterQueueHasWorkload(%q, %q) = %t, want %t", tc.cq, tc.wl, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAssumeWorkloadValidatesPodSetAssignments(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+			Resource(corev1.ResourceCPU, "10").
+			Resource(corev1.ResourceMemory, "10Gi").
+			Obj()).
+		Obj()
+	podSets := []kueue.PodSet{
+		*utiltesting.MakePodSet("driver", 1).
+			Request(corev1.ResourceCPU, "1").
+			Obj(),
+		*utiltesting.MakePodSet("workers", 3).
+			Request(corev1.ResourceCPU, "1").
+			Request(corev1.ResourceMemory, "1Gi").
+			Obj(),
+	}
+	driverAssignment := kueue.PodSetAssignment{
+		Name:          "driver",
+		Flavors:       map[corev1.ResourceName]kueue.ResourceFlavorReference{corev1.ResourceCPU: "default"},
+		ResourceUsage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		Count:         pointer.Int32(1),
+	}
+	workersAssignment := kueue.PodSetAssignment{
+		Name: "workers",
+		Flavors: map[corev1.ResourceName]kueue.ResourceFlavorReference{
+			corev1.ResourceCPU:    "default",
+			corev1.ResourceMemory: "default",
+		},
+		ResourceUsage: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("3"),
+			corev1.ResourceMemory: resource.MustParse("3Gi"),
+		},
+		Count: pointer.Int32(3),
+	}
+	workersWithoutMemory := *workersAssignment.DeepCopy()
+	delete(workersWithoutMemory.Flavors, corev1.ResourceMemory)
+	delete(workersWithoutMemory.ResourceUsage, corev1.ResourceMemory)
+
+	cases := map[string]struct {
+		wl        *kueue.Workload
+		wantError string
+	}{
+		"all podSets assigned": {
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				PodSets(podSets...).
+				Admit(utiltesting.MakeAdmission("foo").PodSets(driverAssignment, workersAssignment).Obj()).
+				Obj(),
+		},
+		"missing assignment for the workers podSet": {
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				PodSets(podSets...).
+				Admit(utiltesting.MakeAdmission("foo").PodSets(driverAssignment).Obj()).
+				Obj(),
+			wantError: "podSet workers has no assignment in the admission",
+		},
+		"missing flavor for a resource": {
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				PodSets(podSets...).
+				Admit(utiltesting.MakeAdmission("foo").PodSets(driverAssignment, workersWithoutMemory).Obj()).
+				Obj(),
+			wantError: "podSet workers has no flavor assigned for memory",
+		},
+		"unknown clusterQueue": {
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				PodSets(podSets...).
+				Admit(utiltesting.MakeAdmission("bar").Obj()).
+				Obj(),
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			err := cache.AssumeWorkload(tc.wl)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			wantAssumed := map[string]string{}
+			if tc.wantError == "" {
+				wantAssumed["ns/wl"] = "foo"
+			}
+			if diff := cmp.Diff(wantAssumed, cache.assumedWorkloads); diff != "" {
+				t.Errorf("Unexpected assumed workloads (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPodSetUsage(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("on-demand").
+				Resource(corev1.ResourceCPU, "10").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj(),
+			*utiltesting.MakeFlavorQuotas("spot").
+				Resource(corev1.ResourceCPU, "10").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj(),
+		).
+		Obj()
+	wl := utiltesting.MakeWorkload("wl", "ns").
+		PodSets(
+			*utiltesting.MakePodSet("driver", 1).
+				Request(corev1.ResourceCPU, "1").
+				Request(corev1.ResourceMemory, "1Gi").
+				Obj(),
+			*utiltesting.MakePodSet("workers", 3).
+				Request(corev1.ResourceCPU, "2").
+				Obj(),
+		).
+		Admit(utiltesting.MakeAdmission("foo").PodSets(
+			kueue.PodSetAssignment{
+				Name: "driver",
+				Flavors: map[corev1.ResourceName]kueue.ResourceFlavorReference{
+					corev1.ResourceCPU:    "on-demand",
+					corev1.ResourceMemory: "on-demand",
+				},
+				ResourceUsage: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1"),
+					corev1.ResourceMemory: resource.MustParse("1Gi"),
+				},
+				Count: pointer.Int32(1),
+			},
+			kueue.PodSetAssignment{
+				Name: "workers",
+				Flavors: map[corev1.ResourceName]kueue.ResourceFlavorReference{
+					corev1.ResourceCPU: "spot",
+				},
+				ResourceUsage: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("6"),
+				},
+				Count: pointer.Int32(3),
+			},
+		).Obj()).
+		Obj()
+
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	cache.AddOrUpdateWorkload(wl)
+
+	got, err := cache.PodSetUsage("ns/wl")
+	if err != nil {
+		t.Fatalf("PodSetUsage failed: %v", err)
+	}
+	want := map[string]FlavorResourceQuantities{
+		"driver": {
+			"on-demand": {corev1.ResourceCPU: 1_000, corev1.ResourceMemory: utiltesting.Gi},
+		},
+		"workers": {
+			"spot": {corev1.ResourceCPU: 6_000},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected podSet usage (-want,+got):\n%s", diff)
+	}
+
+	if _, err := cache.PodSetUsage("ns/other"); err != ErrWorkloadNotFound {
+		t.Errorf("PodSetUsage for an unknown workload returned error %v, want %v", err, ErrWorkloadNotFound)
+	}
+}
+
+func messageOrEmpty(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestForgetAllAssumed(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	for _, name := range []string{"a", "b"} {
+		cq := utiltesting.MakeClusterQueue(name).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj()
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	makeWorkload := func(name, cq, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	usage := func() map[string]FlavorResourceQuantities {
+		got := make(map[string]FlavorResourceQuantities, len(cache.clusterQueues))
+		for name, cq := range cache.clusterQueues {
+			got[name] = copyQuantities(cq.Usage)
+		}
+		return got
+	}
+
+	if got := cache.ForgetAllAssumed(); len(got) != 0 {
+		t.Errorf("ForgetAllAssumed() without assumed workloads = %v, want empty", got)
+	}
+
+	for _, wl := range []*kueue.Workload{makeWorkload("admitted-a", "a", "2"), makeWorkload("admitted-b", "b", "3")} {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Workload %s was not added", wl.Name)
+		}
+	}
+	baseline := usage()
+	for _, wl := range []*kueue.Workload{
+		makeWorkload("assumed-a1", "a", "1"),
+		makeWorkload("assumed-a2", "a", "4"),
+		makeWorkload("assumed-b", "b", "5"),
+	} {
+		if err := cache.AssumeWorkload(wl); err != nil {
+			t.Fatalf("Assuming workload %s: %v", wl.Name, err)
+		}
+	}
+
+	got := cache.ForgetAllAssumed()
+	want := []string{"ns/assumed-a1", "ns/assumed-a2", "ns/assumed-b"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected forgotten workloads (-want,+got):\n%s", diff)
+	}
+	if diff := cmp.Diff(baseline, usage()); diff != "" {
+		t.Errorf("Unexpected usage (-want,+got):\n%s", diff)
+	}
+	if len(cache.assumedWorkloads) != 0 {
+		t.Errorf("Assumed workloads left: %v", cache.assumedWorkloads)
+	}
+	for _, key := range want {
+		if _, _, found := cache.WorkloadInfo(key); found {
+			t.Errorf("Workload %s is still cached", key)
+		}
+	}
+	if _, _, found := cache.WorkloadInfo("ns/admitted-a"); !found {
+		t.Error("Admitted workload ns/admitted-a was forgotten")
+	}
+}
+
+func TestAssumeWorkloadAppliesNoPartialUsage(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	lq := utiltesting.MakeLocalQueue("lq", "ns").ClusterQueue("foo").Obj()
+	assignment := func(name string, flavors map[corev1.ResourceName]kueue.ResourceFlavorReference, cpu string) kueue.PodSetAssignment {
+		return kueue.PodSetAssignment{
+			Name:          name,
+			Flavors:       flavors,
+			ResourceUsage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+			Count:         pointer.Int32(1),
+		}
+	}
+	wl := func(second kueue.PodSetAssignment) *kueue.Workload {
+		return utiltesting.MakeWorkload("wl", "ns").
+			Queue("lq").
+			PodSets(
+				*utiltesting.MakePodSet("first", 1).Request(corev1.ResourceCPU, "2").Obj(),
+				*utiltesting.MakePodSet("second", 1).Request(corev1.ResourceCPU, "3").Obj(),
+			).
+			Admit(utiltesting.MakeAdmission("foo").PodSets(
+				assignment("first", map[corev1.ResourceName]kueue.ResourceFlavorReference{corev1.ResourceCPU: "default"}, "2"),
+				second,
+			).Obj()).
+			Obj()
+	}
+	cases := map[string]struct {
+		wl          *kueue.Workload
+		externalErr error
+		wantError   string
+	}{
+		"second podSet without a flavor": {
+			wl:        wl(assignment("second", map[corev1.ResourceName]kueue.ResourceFlavorReference{}, "3")),
+			wantError: "podSet second has no flavor assigned for cpu",
+		},
+		"external quota rejects the usage": {
+			wl:          wl(assignment("second", map[corev1.ResourceName]kueue.ResourceFlavorReference{corev1.ResourceCPU: "default"}, "3")),
+			externalErr: errors.New("out of budget"),
+			wantError:   "consuming external quota: out of budget",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			external := &fakeExternalQuota{
+				balance: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 10_000}},
+				err:     tc.externalErr,
+			}
+			cache := New(utiltesting.NewFakeClient(), WithExternalQuotaClient(external))
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			if err := cache.AddLocalQueue(lq); err != nil {
+				t.Fatalf("Adding LocalQueue: %v", err)
+			}
+			err := cache.AssumeWorkload(tc.wl)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			cqImpl := cache.clusterQueues["foo"]
+			wantUsage := FlavorResourceQuantities{"default": {corev1.ResourceCPU: 0}}
+			if diff := cmp.Diff(wantUsage, cqImpl.Usage); diff != "" {
+				t.Errorf("Unexpected ClusterQueue usage (-want,+got):\n%s", diff)
+			}
+			qImpl := cqImpl.localQueues[queueKey(lq)]
+			if diff := cmp.Diff(wantUsage, qImpl.usage); diff != "" {
+				t.Errorf("Unexpected LocalQueue usage (-want,+got):\n%s", diff)
+			}
+			if qImpl.admittedWorkloads != 0 {
+				t.Errorf("Got %d admitted workloads in the LocalQueue, want 0", qImpl.admittedWorkloads)
+			}
+			if len(cqImpl.Workloads) != 0 || len(cache.assumedWorkloads) != 0 {
+				t.Errorf("The workload was kept in the cache")
+			}
+		})
 	}
-	return err.Error()
 }
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/util/maps"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+// Clone returns a deep copy of the cache that can be modified without
+// affecting the original, for example to simulate admissions. The clone
+// shares the client and the configuration of the original, but it never
+// reports the global ClusterQueue metrics, and it doesn't report the cache
+// metrics until RegisterMetrics is called on it. The clone has no
+// external quota client, event recorder, nor status and cohort handlers, so
+// that admissions in the clone don't consume external quota or notify about
+// changes that didn't happen.
+func (c *Cache) Clone() *Cache {
+	c.RLock()
+	defer c.RUnlock()
+
+	cc := &Cache{
+		client:            c.client,
+		clusterQueues:     make(map[string]*ClusterQueue, len(c.clusterQueues)),
+		cohorts:           make(map[string]*Cohort, len(c.cohorts)),
+		assumedWorkloads:  maps.Clone(c.assumedWorkloads),
+		resourceFlavors:   make(map[kueue.ResourceFlavorReference]*kueue.ResourceFlavor, len(c.resourceFlavors)),
+		podsReadyTracking: c.podsReadyTracking,
+		resourceAliases:   c.resourceAliases,
+		clock:             c.clock,
+		reservations:      make(map[string]*reservation, len(c.reservations)),
+		reservationsCount: c.reservationsCount,
+		podsReadyTimeout:  c.podsReadyTimeout,
+		adaptiveBorrowing: c.adaptiveBorrowing,
+		statusDebounce:    c.statusDebounce,
+		borrowScopeLabel:  c.borrowScopeLabel,
+		quotaMode:         c.quotaMode,
+
+		inadmissibleReasons:  maps.Clone(c.inadmissibleReasons),
+		admissionTimes:       maps.Clone(c.admissionTimes),
+		preemptors:           maps.Clone(c.preemptors),
+		cohortBorrowCeilings: make(map[string]FlavorResourceQuantities, len(c.cohortBorrowCeilings)),
+	}
+	cc.podsReadyCond.L = &cc.RWMutex
+	cc.activeCond.L = &cc.RWMutex
+	for name, rf := range c.resourceFlavors {
+		cc.resourceFlavors[name] = rf.DeepCopy()
+	}
+	for name, cq := range c.clusterQueues {
+		cc.clusterQueues[name] = cq.clone()
+	}
+	for name, ceiling := range c.cohortBorrowCeilings {
+		cc.cohortBorrowCeilings[name] = copyQuantities(ceiling)
+	}
+	for name, cohort := range c.cohorts {
+		cohortCopy := newCohort(name, cohort.Members.Len())
+		cohortCopy.BorrowCeiling = cc.cohortBorrowCeilings[name]
+		for member := range cohort.Members {
+			memberCopy := cc.clusterQueues[member.Name]
+			cohortCopy.Members.Insert(memberCopy)
+			memberCopy.Cohort = cohortCopy
+		}
+		cc.cohorts[name] = cohortCopy
+	}
+	for id, r := range c.reservations {
+		cc.reservations[id] = &reservation{
+			clusterQueue: r.clusterQueue,
+			usage:        copyQuantities(r.usage),
+			expiration:   r.expiration,
+		}
+	}
+	return cc
+}
+
+// clone returns a deep copy of the ClusterQueue, without its cohort and
+// without metrics reporting.
+func (c *ClusterQueue) clone() *ClusterQueue {
+	cc := &ClusterQueue{
+		Name:              c.Name,
+		ResourceGroups:    copyResourceGroups(c.ResourceGroups),
+		Usage:             copyQuantities(c.Usage),
+		Workloads:         make(map[string]*workload.Info, len(c.Workloads)),
+		WorkloadsNotReady: c.WorkloadsNotReady.Clone(),
+		NamespaceSelector: c.NamespaceSelector,
+		Preemption:        c.Preemption,
+		Status:            c.Status,
+		SelfReserve:       maps.Clone(c.SelfReserve),
+		BorrowingPriority: c.BorrowingPriority,
+		MinWorkloadSize:   maps.Clone(c.MinWorkloadSize),
+		MaxWorkloadSize:   maps.Clone(c.MaxWorkloadSize),
+		AdaptiveBorrowing: c.AdaptiveBorrowing,
+		BorrowScope:       c.BorrowScope,
+		Headroom:          copyQuantities(c.Headroom),
+		localQueues:       make(map[string]*queue, len(c.localQueues)),
+		podsReadyTracking: c.podsReadyTracking,
+		resourceAliases:   c.resourceAliases,
+		quotaMode:         c.quotaMode,
+		pendingWorkloads:  maps.Clone(c.pendingWorkloads),
+		held:              c.held,
+		evictedWorkloads:  c.evictedWorkloads,
+	}
+	if c.MinBorrowingPriority != nil {
+		cc.MinBorrowingPriority = pointer.Int32(*c.MinBorrowingPriority)
+	}
+	if c.MaxAdmittedWorkloads != nil {
+		cc.MaxAdmittedWorkloads = pointer.Int32(*c.MaxAdmittedWorkloads)
+	}
+	if c.ReclaimableCheckPriority != nil {
+		cc.ReclaimableCheckPriority = pointer.Int32(*c.ReclaimableCheckPriority)
+	}
+	if c.NamespaceCaps != nil {
+		cc.NamespaceCaps = make(map[string]FlavorResourceQuantities, len(c.NamespaceCaps))
+		for ns, caps := range c.NamespaceCaps {
+			cc.NamespaceCaps[ns] = copyQuantities(caps)
+		}
+	}
+	cc.UpdateRGByResource()
+	for k, wi := range c.Workloads {
+		cc.Workloads[k] = wi.DeepCopy()
+	}
+	for k, q := range c.localQueues {
+		cc.localQueues[k] = &queue{
+			key:               q.key,
+			admittedWorkloads: q.admittedWorkloads,
+			usage:             copyQuantities(q.usage),
+			usageReleased:     q.usageReleased,
+			defaultPriority:   q.defaultPriority,
+		}
+	}
+	if c.admissionChecks != nil {
+		cc.admissionChecks = make(map[string]map[string]AdmissionCheckState, len(c.admissionChecks))
+		for k, states := range c.admissionChecks {
+			cc.admissionChecks[k] = maps.Clone(states)
+		}
+	}
+	if c.quotaOverrides != nil {
+		cc.quotaOverrides = make(map[kueue.ResourceFlavorReference]map[corev1.ResourceName]*quotaOverride, len(c.quotaOverrides))
+		for fName, overrides := range c.quotaOverrides {
+			cc.quotaOverrides[fName] = make(map[corev1.ResourceName]*quotaOverride, len(overrides))
+			for rName, o := range overrides {
+				oCopy := *o
+				cc.quotaOverrides[fName][rName] = &oCopy
+			}
+		}
+	}
+	return cc
+}
+
+// copyResourceGroups returns a deep copy of the ResourceGroups.
+func copyResourceGroups(rgs []ResourceGroup) []ResourceGroup {
+	rgsCopy := make([]ResourceGroup, len(rgs))
+	for i := range rgs {
+		rg := &rgs[i]
+		rgCopy := &rgsCopy[i]
+		rgCopy.CoveredResources = rg.CoveredResources.Clone()
+		if rg.LabelKeys != nil {
+			rgCopy.LabelKeys = rg.LabelKeys.Clone()
+		}
+		rgCopy.Flavors = make([]FlavorQuotas, len(rg.Flavors))
+		for j := range rg.Flavors {
+			rgCopy.Flavors[j] = FlavorQuotas{
+				Name:      rg.Flavors[j].Name,
+				Resources: make(map[corev1.ResourceName]*ResourceQuota, len(rg.Flavors[j].Resources)),
+				IsDefault: rg.Flavors[j].IsDefault,
+			}
+			for rName, rQuota := range rg.Flavors[j].Resources {
+				rQuotaCopy := *rQuota
+				if rQuota.BorrowingLimit != nil {
+					rQuotaCopy.BorrowingLimit = pointer.Int64(*rQuota.BorrowingLimit)
+				}
+				if rQuota.UsageCap != nil {
+					rQuotaCopy.UsageCap = pointer.Int64(*rQuota.UsageCap)
+				}
+				rgCopy.Flavors[j].Resources[rName] = &rQuotaCopy
+			}
+		}
+	}
+	return rgsCopy
+}
+
+func copyQuantities(q FlavorResourceQuantities) FlavorResourceQuantities {
+	if q == nil {
+		return nil
+	}
+	qCopy := make(FlavorResourceQuantities, len(q))
+	for fName, resQ := range q {
+		qCopy[fName] = maps.Clone(resQ)
+	}
+	return qCopy
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/metrics"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+)
+
+func TestClone(t *testing.T) {
+	cqs := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			Cohort("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			Cohort("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Annotation(DefaultFlavorsAnnotation, "default").
+			Obj(),
+	}
+	admitted := func(name, cqName, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Queue("lq").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cqName).Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	for _, cq := range cqs {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	if err := cache.AddLocalQueue(utiltesting.MakeLocalQueue("lq", "ns").ClusterQueue("a").Obj()); err != nil {
+		t.Fatalf("Adding LocalQueue: %v", err)
+	}
+	if !cache.AddOrUpdateWorkload(admitted("wl1", "a", "2")) {
+		t.Fatal("Failed adding workload")
+	}
+	assumed := admitted("wl2", "b", "3")
+	if err := cache.AssumeWorkload(assumed); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+
+	clone := cache.Clone()
+	if !clone.AddOrUpdateWorkload(admitted("wl3", "a", "4")) {
+		t.Fatal("Failed adding workload to the clone")
+	}
+	if err := clone.ForgetWorkload(assumed); err != nil {
+		t.Fatalf("Forgetting workload in the clone: %v", err)
+	}
+
+	wantOriginal := map[string]int64{"a": 2_000, "b": 3_000}
+	wantClone := map[string]int64{"a": 6_000, "b": 0}
+	for name, want := range wantOriginal {
+		if got := cache.clusterQueues[name].Usage["default"][corev1.ResourceCPU]; got != want {
+			t.Errorf("Original ClusterQueue %s uses %d, want %d", name, got, want)
+		}
+		if got := clone.clusterQueues[name].Usage["default"][corev1.ResourceCPU]; got != wantClone[name] {
+			t.Errorf("Cloned ClusterQueue %s uses %d, want %d", name, got, wantClone[name])
+		}
+	}
+	if diff := cmp.Diff(map[string]string{"ns/wl2": "b"}, cache.assumedWorkloads); diff != "" {
+		t.Errorf("Unexpected assumed workloads in the original (-want,+got):\n%s", diff)
+	}
+	if got := cache.clusterQueues["a"].localQueues["ns/lq"].admittedWorkloads; got != 1 {
+		t.Errorf("Got %d admitted workloads in the original LocalQueue, want 1", got)
+	}
+	if got := clone.clusterQueues["a"].localQueues["ns/lq"].admittedWorkloads; got != 2 {
+		t.Errorf("Got %d admitted workloads in the cloned LocalQueue, want 2", got)
+	}
+	if !clone.clusterQueues["b"].ResourceGroups[0].Flavors[0].IsDefault {
+		t.Error("The default flavor of the cloned ClusterQueue b is not a default flavor")
+	}
+
+	cohort := clone.cohorts["one"]
+	if cohort == cache.cohorts["one"] {
+		t.Fatal("The clone shares the cohort with the original")
+	}
+	for _, name := range []string{"a", "b"} {
+		cq := clone.clusterQueues[name]
+		if !cohort.Members.Has(cq) || cq.Cohort != cohort {
+			t.Errorf("Cloned ClusterQueue %s is not linked to the cloned cohort", name)
+		}
+	}
+}
+
+func TestCloneDoesntShareSideEffects(t *testing.T) {
+	external := &fakeExternalQuota{
+		balance: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 6_000}},
+	}
+	var cohortChanges []string
+	cache := New(utiltesting.NewFakeClient(),
+		WithExternalQuotaClient(external),
+		WithCohortChangeHandler(func(name string, _ bool) {
+			cohortChanges = append(cohortChanges, name)
+		}),
+	)
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+
+	clone := cache.Clone()
+	wl := utiltesting.MakeWorkload("wl", "ns").
+		Request(corev1.ResourceCPU, "4").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+		Obj()
+	if err := clone.AssumeWorkload(wl); err != nil {
+		t.Fatalf("Assuming workload in the clone: %v", err)
+	}
+	if diff := cmp.Diff(int64(6_000), external.balance["default"][corev1.ResourceCPU]); diff != "" {
+		t.Errorf("Unexpected external balance after admitting in the clone (-want,+got):\n%s", diff)
+	}
+	cqInCohort := utiltesting.MakeClusterQueue("bar").Cohort("one").Obj()
+	if err := clone.AddClusterQueue(context.Background(), cqInCohort); err != nil {
+		t.Fatalf("Adding ClusterQueue to the clone: %v", err)
+	}
+	if len(cohortChanges) != 0 {
+		t.Errorf("Cohort handler called for changes in the clone: %v", cohortChanges)
+	}
+}
+
+func TestCloneDoesntReportGlobalMetrics(t *testing.T) {
+	// The name is unique in the package, as the metrics are global.
+	const cqName = "clone-metrics"
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	cq := utiltesting.MakeClusterQueue(cqName).
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	wl := utiltesting.MakeWorkload("wl", "ns").
+		Request(corev1.ResourceCPU, "2").
+		Admit(utiltesting.MakeAdmission(cqName).Assignment(corev1.ResourceCPU, "default", "2").Obj()).
+		Obj()
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatal("Failed adding workload")
+	}
+
+	gauges := func() map[string]float64 {
+		got := map[string]float64{
+			"admitted_active_workloads": testutil.ToFloat64(metrics.AdmittedActiveWorkloads.WithLabelValues(cqName)),
+		}
+		for _, status := range metrics.CQStatuses {
+			got["status_"+string(status)] = testutil.ToFloat64(metrics.ClusterQueueByStatus.WithLabelValues(cqName, string(status)))
+		}
+		return got
+	}
+	want := gauges()
+
+	clone := cache.Clone()
+	other := utiltesting.MakeWorkload("other", "ns").
+		Request(corev1.ResourceCPU, "4").
+		Admit(utiltesting.MakeAdmission(cqName).Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+		Obj()
+	if err := clone.AssumeWorkload(other); err != nil {
+		t.Fatalf("Assuming workload in the clone: %v", err)
+	}
+	if err := clone.DeleteWorkload(wl); err != nil {
+		t.Fatalf("Deleting workload from the clone: %v", err)
+	}
+	clone.TerminateClusterQueue(cqName)
+	if diff := cmp.Diff(want, gauges()); diff != "" {
+		t.Errorf("Mutating the clone changed the global metrics (-want,+got):\n%s", diff)
+	}
+
+	clone.DeleteClusterQueue(cq)
+	if diff := cmp.Diff(want, gauges()); diff != "" {
+		t.Errorf("Deleting the ClusterQueue from the clone changed the global metrics (-want,+got):\n%s", diff)
+	}
+}
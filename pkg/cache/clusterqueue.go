@@ -3,9 +3,15 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -13,11 +19,77 @@ import (
 
 	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
 	"sigs.k8s.io/kueue/pkg/metrics"
+	"sigs.k8s.io/kueue/pkg/util/limitrange"
+	"sigs.k8s.io/kueue/pkg/util/maps"
 	"sigs.k8s.io/kueue/pkg/workload"
 )
 
 var (
-	errQueueAlreadyExists = errors.New("queue already exists")
+	errQueueAlreadyExists    = errors.New("queue already exists")
+	errWorkloadAlreadyExists = errors.New("workload already exists in ClusterQueue")
+
+	// ErrWorkloadTooSmall is returned when a workload requests less of a
+	// resource than the minimum accepted by the ClusterQueue.
+	ErrWorkloadTooSmall = errors.New("workload is smaller than the minimum size of the ClusterQueue")
+	// ErrWorkloadTooLarge is returned when a workload requests more of a
+	// resource than the maximum accepted by the ClusterQueue.
+	ErrWorkloadTooLarge = errors.New("workload is larger than the maximum size of the ClusterQueue")
+)
+
+const (
+	// MinBorrowingPriorityAnnotation is the ClusterQueue annotation holding the
+	// minimum priority a workload needs to use quota borrowed from the cohort.
+	MinBorrowingPriorityAnnotation = "kueue.x-k8s.io/min-borrowing-priority"
+	// BorrowingPriorityAnnotation is the ClusterQueue annotation holding the
+	// priority of the ClusterQueue to borrow from its cohort, relative to the
+	// other members.
+	BorrowingPriorityAnnotation = "kueue.x-k8s.io/borrowing-priority"
+	// RequestPercentagesAnnotation is the Workload annotation holding the
+	// requests expressed as a percentage of the nominal quota of the flavor
+	// assigned to the resource, as a comma separated list of
+	// podSet:resource=percentage entries, e.g. "main:example.com/gpu=50".
+	// The percentage is the usage of the whole podSet.
+	RequestPercentagesAnnotation = "kueue.x-k8s.io/request-percentages"
+	// MinWorkloadSizeAnnotation is the ClusterQueue annotation holding the
+	// minimum total amount of each resource that a workload needs to request
+	// to be admitted, as a comma separated list of resource=quantity entries,
+	// e.g. "cpu=1,memory=1Gi".
+	MinWorkloadSizeAnnotation = "kueue.x-k8s.io/min-workload-size"
+	// MaxWorkloadSizeAnnotation is the ClusterQueue annotation holding the
+	// maximum total amount of each resource that a workload can request to be
+	// admitted, in the same format as MinWorkloadSizeAnnotation.
+	MaxWorkloadSizeAnnotation = "kueue.x-k8s.io/max-workload-size"
+	// GangAnnotation is the Workload annotation that, when set to "true",
+	// makes the workload consume quota only once all its pods are ready, so
+	// that a partially started gang doesn't hold a fraction of the quota.
+	GangAnnotation = "kueue.x-k8s.io/gang"
+	// DefaultFlavorsAnnotation is the ClusterQueue annotation holding a comma
+	// separated list of catch-all flavors. In their resource group, they are
+	// tried after the other flavors and match any podSet, regardless of the
+	// node labels.
+	DefaultFlavorsAnnotation = "kueue.x-k8s.io/default-flavors"
+	// UsageCapsAnnotation is the ClusterQueue annotation holding hard
+	// ceilings on the usage of resources in flavors, regardless of the quota
+	// borrowed from the cohort, as a comma separated list of
+	// flavor:resource=quantity entries, e.g. "a100:nvidia.com/gpu=8".
+	UsageCapsAnnotation = "kueue.x-k8s.io/usage-caps"
+	// MaxAdmittedWorkloadsAnnotation is the ClusterQueue annotation holding
+	// the maximum number of workloads the ClusterQueue can have admitted at
+	// the same time, regardless of its quota.
+	MaxAdmittedWorkloadsAnnotation = "kueue.x-k8s.io/max-admitted-workloads"
+	// DefaultPriorityAnnotation is the LocalQueue annotation holding the
+	// priority of the workloads submitted to the LocalQueue that don't
+	// specify one.
+	DefaultPriorityAnnotation = "kueue.x-k8s.io/default-priority"
+	// ReclaimableCheckPriorityAnnotation is the ClusterQueue annotation
+	// holding the priority below which the quota reserved by the workloads
+	// waiting for their admission checks can be reclaimed by other workloads.
+	ReclaimableCheckPriorityAnnotation = "kueue.x-k8s.io/reclaimable-check-priority"
+	// NamespaceCapsAnnotation is the ClusterQueue annotation holding ceilings
+	// on the usage of the workloads of a namespace, for namespaces sharing
+	// the ClusterQueue, as a comma separated list of
+	// namespace/flavor:resource=quantity entries, e.g. "team-a/default:cpu=10".
+	NamespaceCapsAnnotation = "kueue.x-k8s.io/namespace-caps"
 )
 
 // ClusterQueue is the internal implementation of kueue.ClusterQueue that
@@ -33,18 +105,80 @@ type ClusterQueue struct {
 	NamespaceSelector labels.Selector
 	Preemption        kueue.ClusterQueuePreemption
 	Status            metrics.ClusterQueueStatus
+	// MinBorrowingPriority is the minimum priority a workload needs to borrow
+	// quota from the cohort. When nil, any workload can borrow. As the other
+	// constraints checked in fits, it's advisory and not enforced by the
+	// scheduler.
+	MinBorrowingPriority *int32
+	// SelfReserve is the amount of each resource, in every flavor, that the
+	// ClusterQueue keeps for its own workloads and doesn't lend to the cohort.
+	SelfReserve map[corev1.ResourceName]int64
+	// BorrowingPriority orders the members of the cohort when deciding which
+	// one borrows first. Higher values borrow first.
+	BorrowingPriority int32
+	// MinWorkloadSize and MaxWorkloadSize bound the total amount of each
+	// resource that a workload can request to be admitted.
+	MinWorkloadSize map[corev1.ResourceName]int64
+	MaxWorkloadSize map[corev1.ResourceName]int64
+	// AdaptiveBorrowing limits the quota that the ClusterQueue can borrow to
+	// its share of the quota unused by the other members of the cohort.
+	AdaptiveBorrowing bool
+	// BorrowScope restricts the ClusterQueue to borrow from the members of its
+	// cohort with the same BorrowScope.
+	BorrowScope string
+	// Headroom is the quota of each resource in each flavor that is kept
+	// free for pods not managed by kueue. It's neither available to the
+	// workloads of the ClusterQueue nor lent to the cohort, in the fit checks
+	// of the cache.
+	Headroom FlavorResourceQuantities
+	// MaxAdmittedWorkloads is the maximum number of workloads the ClusterQueue
+	// can admit at the same time. When nil, the number is not limited.
+	MaxAdmittedWorkloads *int32
+	// ReclaimableCheckPriority is the priority below which the quota reserved
+	// by the workloads with pending admission checks is reclaimable. When nil,
+	// that quota is not reclaimable.
+	ReclaimableCheckPriority *int32
+	// NamespaceCaps are the ceilings on the usage of the workloads of each
+	// namespace, keyed by namespace.
+	NamespaceCaps map[string]FlavorResourceQuantities
+	// resourceAliases and quotaMode determine the usage of the workloads, in
+	// newWorkloadInfo.
+	resourceAliases map[corev1.ResourceName]corev1.ResourceName
+	quotaMode       QuotaMode
 
 	// The following fields are not populated in a snapshot.
 
 	// Key is localQueue's key (namespace/name).
 	localQueues       map[string]*queue
 	podsReadyTracking bool
+	metrics           *cacheMetrics
+	reporter          *clusterQueueReporter
+	// pendingWorkloads maps the keys of the workloads waiting for admission
+	// to their localQueues and priorities.
+	pendingWorkloads map[string]pendingWorkload
+	// admissionChecks holds the state of the admission checks of the
+	// admitted workloads that have any, keyed by workload key.
+	admissionChecks map[string]map[string]AdmissionCheckState
+	// held is set when the ClusterQueue is manually kept pending, regardless
+	// of its spec, with Cache.SetClusterQueueStatus.
+	held bool
+	// evictedWorkloads is the number of workloads evicted with
+	// Cache.EvictWorkload.
+	evictedWorkloads int
+	// quotaOverrides holds the temporary nominal quotas set with
+	// Cache.OverrideFlavorQuota, per flavor and resource.
+	quotaOverrides map[kueue.ResourceFlavorReference]map[corev1.ResourceName]*quotaOverride
 }
 
 // Cohort is a set of ClusterQueues that can borrow resources from each other.
 type Cohort struct {
 	Name    string
 	Members sets.Set[*ClusterQueue]
+	// BorrowCeiling is the maximum that the members of the cohort can borrow
+	// in total, per flavor and resource, as set with
+	// Cache.SetCohortBorrowCeiling. Only the fit checks of the cache enforce
+	// it.
+	BorrowCeiling FlavorResourceQuantities
 
 	// These fields are only populated for a snapshot.
 	RequestableResources FlavorResourceQuantities
@@ -64,11 +198,26 @@ type ResourceGroup struct {
 type FlavorQuotas struct {
 	Name      kueue.ResourceFlavorReference
 	Resources map[corev1.ResourceName]*ResourceQuota
+	// IsDefault is whether the flavor is a catch-all flavor of its resource
+	// group, as listed in DefaultFlavorsAnnotation.
+	IsDefault bool
 }
 
 type ResourceQuota struct {
 	Nominal        int64
 	BorrowingLimit *int64
+	// UsageCap is a ceiling on the usage of the resource in the flavor that
+	// can't be exceeded even by borrowing, as set in UsageCapsAnnotation. The
+	// fit checks of the cache enforce it, but not the scheduler.
+	UsageCap *int64
+}
+
+// capUsage returns the ceiling bounded by the UsageCap, if any.
+func (q *ResourceQuota) capUsage(ceiling int64) int64 {
+	if q.UsageCap != nil && *q.UsageCap < ceiling {
+		return *q.UsageCap
+	}
+	return ceiling
 }
 
 type FlavorResourceQuantities map[kueue.ResourceFlavorReference]map[corev1.ResourceName]int64
@@ -77,6 +226,12 @@ type queue struct {
 	key               string
 	admittedWorkloads int
 	usage             FlavorResourceQuantities
+	// usageReleased indicates that the LocalQueue was stopped and the usage
+	// of its workloads is no longer accounted in the ClusterQueue.
+	usageReleased bool
+	// defaultPriority is the priority of the workloads of the LocalQueue
+	// that don't specify one, from DefaultPriorityAnnotation.
+	defaultPriority *int32
 }
 
 func newCohort(name string, size int) *Cohort {
@@ -114,6 +269,12 @@ func (c *ClusterQueue) IsBorrowing() bool {
 	return false
 }
 
+// CanBorrow returns whether a workload with the given priority is allowed to
+// use quota borrowed from the cohort.
+func (c *ClusterQueue) CanBorrow(priority int32) bool {
+	return c.MinBorrowingPriority == nil || priority >= *c.MinBorrowingPriority
+}
+
 func (c *ClusterQueue) Active() bool {
 	return c.Status == active
 }
@@ -124,14 +285,53 @@ var defaultPreemption = kueue.ClusterQueuePreemption{
 }
 
 func (c *ClusterQueue) update(in *kueue.ClusterQueue, resourceFlavors map[kueue.ResourceFlavorReference]*kueue.ResourceFlavor) error {
-	c.updateResourceGroups(in.Spec.ResourceGroups)
+	if err := validateResourceGroups(in.Spec.ResourceGroups); err != nil {
+		return err
+	}
+	// Parse everything before changing the ClusterQueue, so that an invalid
+	// spec or annotation leaves it as it was.
 	nsSelector, err := metav1.LabelSelectorAsSelector(in.Spec.NamespaceSelector)
 	if err != nil {
 		return err
 	}
+	usageCaps, err := parseUsageCaps(in.Annotations[UsageCapsAnnotation])
+	if err != nil {
+		return fmt.Errorf("parsing annotation %s: %w", UsageCapsAnnotation, err)
+	}
+	minBorrowingPriority, err := parseInt32Annotation(in.Annotations, MinBorrowingPriorityAnnotation)
+	if err != nil {
+		return err
+	}
+	borrowingPriority, err := parseInt32Annotation(in.Annotations, BorrowingPriorityAnnotation)
+	if err != nil {
+		return err
+	}
+	maxAdmittedWorkloads, err := parseInt32Annotation(in.Annotations, MaxAdmittedWorkloadsAnnotation)
+	if err != nil {
+		return err
+	}
+	reclaimableCheckPriority, err := parseInt32Annotation(in.Annotations, ReclaimableCheckPriorityAnnotation)
+	if err != nil {
+		return err
+	}
+	namespaceCaps, err := parseNamespaceCaps(in.Annotations[NamespaceCapsAnnotation])
+	if err != nil {
+		return fmt.Errorf("parsing annotation %s: %w", NamespaceCapsAnnotation, err)
+	}
+	minWorkloadSize, err := parseResourceValues(in.Annotations[MinWorkloadSizeAnnotation])
+	if err != nil {
+		return fmt.Errorf("parsing annotation %s: %w", MinWorkloadSizeAnnotation, err)
+	}
+	maxWorkloadSize, err := parseResourceValues(in.Annotations[MaxWorkloadSizeAnnotation])
+	if err != nil {
+		return fmt.Errorf("parsing annotation %s: %w", MaxWorkloadSizeAnnotation, err)
+	}
+
+	c.updateResourceGroups(in.Spec.ResourceGroups, parseDefaultFlavors(in.Annotations[DefaultFlavorsAnnotation]), usageCaps)
 	c.NamespaceSelector = nsSelector
 
-	// Cleanup removed flavors or resources.
+	// Cleanup removed flavors or resources, unless they are still used by
+	// admitted workloads.
 	usedFlavorResources := make(FlavorResourceQuantities)
 	for _, rg := range in.Spec.ResourceGroups {
 		for _, f := range rg.Flavors {
@@ -143,7 +343,24 @@ func (c *ClusterQueue) update(in *kueue.ClusterQueue, resourceFlavors map[kueue.
 			usedFlavorResources[f.Name] = usedResources
 		}
 	}
+	for _, wi := range c.Workloads {
+		for fName, resUsage := range workloadUsage(wi) {
+			for rName := range resUsage {
+				if _, found := usedFlavorResources[fName][rName]; found {
+					continue
+				}
+				if used, found := c.Usage[fName][rName]; found {
+					if usedFlavorResources[fName] == nil {
+						usedFlavorResources[fName] = make(map[corev1.ResourceName]int64)
+					}
+					usedFlavorResources[fName][rName] = used
+				}
+			}
+		}
+	}
 	c.Usage = usedFlavorResources
+	c.clearUsageMetrics()
+	c.reportUsage()
 	c.UpdateWithFlavors(resourceFlavors)
 
 	if in.Spec.Preemption != nil {
@@ -152,10 +369,203 @@ func (c *ClusterQueue) update(in *kueue.ClusterQueue, resourceFlavors map[kueue.
 		c.Preemption = defaultPreemption
 	}
 
+	c.MinBorrowingPriority = minBorrowingPriority
+	c.BorrowingPriority = pointer.Int32Deref(borrowingPriority, 0)
+	c.MaxAdmittedWorkloads = maxAdmittedWorkloads
+	c.ReclaimableCheckPriority = reclaimableCheckPriority
+	c.NamespaceCaps = namespaceCaps
+	c.MinWorkloadSize = minWorkloadSize
+	c.MaxWorkloadSize = maxWorkloadSize
 	return nil
 }
 
-func (c *ClusterQueue) updateResourceGroups(in []kueue.ResourceGroup) {
+// parseInt32Annotation parses the annotation as an int32. It's nil if the
+// annotation is not set.
+func parseInt32Annotation(annotations map[string]string, key string) (*int32, error) {
+	v, found := annotations[key]
+	if !found {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("parsing annotation %s: %w", key, err)
+	}
+	return pointer.Int32(int32(n)), nil
+}
+
+// parseResourceValues parses a comma separated list of resource=quantity
+// entries. An empty string results in nil.
+func parseResourceValues(v string) (map[corev1.ResourceName]int64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	values := make(map[corev1.ResourceName]int64)
+	for _, entry := range strings.Split(v, ",") {
+		name, qStr, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid entry %q", entry)
+		}
+		q, err := resource.ParseQuantity(qStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity for %s: %w", name, err)
+		}
+		rName := corev1.ResourceName(name)
+		values[rName] = workload.ResourceValue(rName, q)
+	}
+	return values, nil
+}
+
+// parseUsageCaps parses a comma separated list of flavor:resource=quantity
+// entries. An empty string results in nil.
+func parseUsageCaps(v string) (FlavorResourceQuantities, error) {
+	if v == "" {
+		return nil, nil
+	}
+	caps := make(FlavorResourceQuantities)
+	for _, entry := range strings.Split(v, ",") {
+		key, qStr, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid entry %q", entry)
+		}
+		fName, rName, found := strings.Cut(key, ":")
+		if !found || fName == "" || rName == "" {
+			return nil, fmt.Errorf("invalid entry %q", entry)
+		}
+		q, err := resource.ParseQuantity(qStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity for %s: %w", key, err)
+		}
+		addQuantity(caps, kueue.ResourceFlavorReference(fName), corev1.ResourceName(rName), workload.ResourceValue(corev1.ResourceName(rName), q))
+	}
+	return caps, nil
+}
+
+// parseNamespaceCaps parses a comma separated list of
+// namespace/flavor:resource=quantity entries. An empty string results in nil.
+func parseNamespaceCaps(v string) (map[string]FlavorResourceQuantities, error) {
+	if v == "" {
+		return nil, nil
+	}
+	caps := make(map[string]FlavorResourceQuantities)
+	for _, entry := range strings.Split(v, ",") {
+		ns, capEntry, found := strings.Cut(strings.TrimSpace(entry), "/")
+		if !found || ns == "" || capEntry == "" {
+			return nil, fmt.Errorf("invalid entry %q", entry)
+		}
+		nsCaps, err := parseUsageCaps(capEntry)
+		if err != nil {
+			return nil, err
+		}
+		if caps[ns] == nil {
+			caps[ns] = make(FlavorResourceQuantities)
+		}
+		for fName, resCaps := range nsCaps {
+			for rName, v := range resCaps {
+				addQuantity(caps[ns], fName, rName, v)
+			}
+		}
+	}
+	return caps, nil
+}
+
+// namespaceUsage returns the usage of the workloads of the namespace
+// admitted in the ClusterQueue.
+func (c *ClusterQueue) namespaceUsage(ns string) FlavorResourceQuantities {
+	usage := make(FlavorResourceQuantities)
+	for _, wi := range c.Workloads {
+		if wi.Obj.Namespace != ns || isGangPending(wi.Obj) {
+			continue
+		}
+		for fName, resUsage := range workloadUsage(wi) {
+			for rName, v := range resUsage {
+				addQuantity(usage, fName, rName, v)
+			}
+		}
+	}
+	return usage
+}
+
+// checkWorkloadSize returns ErrWorkloadTooSmall or ErrWorkloadTooLarge,
+// wrapped with the offending resource, if the total requests of the workload
+// are out of the bounds of the ClusterQueue.
+func (c *ClusterQueue) checkWorkloadSize(wl *workload.Info) error {
+	if len(c.MinWorkloadSize) == 0 && len(c.MaxWorkloadSize) == 0 {
+		return nil
+	}
+	total := make(map[corev1.ResourceName]int64)
+	for _, ps := range wl.TotalRequests {
+		for rName, v := range ps.Requests {
+			total[rName] += v
+		}
+	}
+	for _, rName := range sortedKeys(c.MinWorkloadSize) {
+		if minSize := c.MinWorkloadSize[rName]; total[rName] < minSize {
+			return fmt.Errorf("%w: requests %s of %s, the minimum is %s", ErrWorkloadTooSmall,
+				quantityString(rName, total[rName]), rName, quantityString(rName, minSize))
+		}
+	}
+	for _, rName := range sortedKeys(c.MaxWorkloadSize) {
+		if maxSize := c.MaxWorkloadSize[rName]; total[rName] > maxSize {
+			return fmt.Errorf("%w: requests %s of %s, the maximum is %s", ErrWorkloadTooLarge,
+				quantityString(rName, total[rName]), rName, quantityString(rName, maxSize))
+		}
+	}
+	return nil
+}
+
+func quantityString(rName corev1.ResourceName, v int64) string {
+	q := workload.ResourceQuantity(rName, v)
+	return q.String()
+}
+
+// overQuota describes each resource whose usage exceeds the quota that the
+// ClusterQueue can use, including the flavors and resources removed from its
+// spec that are still used by admitted workloads.
+func (c *ClusterQueue) overQuota() []string {
+	var msgs []string
+	for _, fName := range sortedKeys(c.Usage) {
+		for _, rName := range sortedKeys(c.Usage[fName]) {
+			used := c.Usage[fName][rName]
+			if used == 0 {
+				continue
+			}
+			usedQuantity := workload.ResourceQuantity(rName, used)
+			if c.resourceQuota(fName, rName) == nil {
+				msgs = append(msgs, fmt.Sprintf("%s of %s in flavor %s is used, but the ClusterQueue has no quota for it", usedQuantity.String(), rName, fName))
+				continue
+			}
+			if allowance := c.borrowingAllowance(fName, rName); used > allowance {
+				allowanceQuantity := workload.ResourceQuantity(rName, allowance)
+				msgs = append(msgs, fmt.Sprintf("Usage of %s in flavor %s (%s) exceeds the quota of the ClusterQueue (%s)", rName, fName, usedQuantity.String(), allowanceQuantity.String()))
+			}
+		}
+	}
+	return msgs
+}
+
+// validateResourceGroups verifies that each flavor and each resource belong to
+// a single ResourceGroup, as the cache indexes quotas and usage by them.
+func validateResourceGroups(rgs []kueue.ResourceGroup) error {
+	flavorGroup := make(map[kueue.ResourceFlavorReference]int)
+	resourceGroup := make(map[corev1.ResourceName]int)
+	for i, rg := range rgs {
+		for _, rName := range rg.CoveredResources {
+			if j, found := resourceGroup[rName]; found && j != i {
+				return fmt.Errorf("resource %s is covered by resource groups %d and %d", rName, j, i)
+			}
+			resourceGroup[rName] = i
+		}
+		for _, f := range rg.Flavors {
+			if j, found := flavorGroup[f.Name]; found && j != i {
+				return fmt.Errorf("flavor %s is used in resource groups %d and %d", f.Name, j, i)
+			}
+			flavorGroup[f.Name] = i
+		}
+	}
+	return nil
+}
+
+func (c *ClusterQueue) updateResourceGroups(in []kueue.ResourceGroup, defaults sets.Set[kueue.ResourceFlavorReference], usageCaps FlavorResourceQuantities) {
 	c.ResourceGroups = make([]ResourceGroup, len(in))
 	for i, rgIn := range in {
 		rg := &c.ResourceGroups[i]
@@ -168,6 +578,7 @@ func (c *ClusterQueue) updateResourceGroups(in []kueue.ResourceGroup) {
 			fQuotas := FlavorQuotas{
 				Name:      fIn.Name,
 				Resources: make(map[corev1.ResourceName]*ResourceQuota, len(fIn.Resources)),
+				IsDefault: defaults.Has(fIn.Name),
 			}
 			for _, rIn := range fIn.Resources {
 				rQuota := ResourceQuota{
@@ -176,12 +587,16 @@ func (c *ClusterQueue) updateResourceGroups(in []kueue.ResourceGroup) {
 				if rIn.BorrowingLimit != nil {
 					rQuota.BorrowingLimit = pointer.Int64(workload.ResourceValue(rIn.Name, *rIn.BorrowingLimit))
 				}
+				if usageCap, ok := usageCaps[fIn.Name][rIn.Name]; ok {
+					rQuota.UsageCap = pointer.Int64(usageCap)
+				}
 				fQuotas.Resources[rIn.Name] = &rQuota
 			}
 			rg.Flavors = append(rg.Flavors, fQuotas)
 		}
 	}
 	c.UpdateRGByResource()
+	c.applyQuotaOverrides()
 }
 
 func (c *ClusterQueue) UpdateRGByResource() {
@@ -198,14 +613,14 @@ func (c *ClusterQueue) UpdateRGByResource() {
 // Exported only for testing.
 func (c *ClusterQueue) UpdateWithFlavors(flavors map[kueue.ResourceFlavorReference]*kueue.ResourceFlavor) {
 	status := active
-	if flavorNotFound := c.updateLabelKeys(flavors); flavorNotFound {
+	if flavorNotFound := c.updateLabelKeys(flavors); flavorNotFound || c.held {
 		status = pending
 	}
 
 	if c.Status != terminating {
 		c.Status = status
 	}
-	metrics.ReportClusterQueueStatus(c.Name, c.Status)
+	c.reporter.reportStatus(c.Name, c.Status)
 }
 
 func (c *ClusterQueue) updateLabelKeys(flavors map[kueue.ResourceFlavorReference]*kueue.ResourceFlavor) bool {
@@ -236,20 +651,239 @@ func (c *ClusterQueue) updateLabelKeys(flavors map[kueue.ResourceFlavorReference
 }
 
 func (c *ClusterQueue) addWorkload(w *kueue.Workload) error {
+	return c.addWorkloadInfo(c.newWorkloadInfo(w))
+}
+
+// addWorkloadInfo adds the workload, with its usage already computed by
+// newWorkloadInfo, and applies its usage to the ClusterQueue.
+func (c *ClusterQueue) addWorkloadInfo(wi *workload.Info) error {
+	w := wi.Obj
 	k := workload.Key(w)
 	if _, exist := c.Workloads[k]; exist {
-		return fmt.Errorf("workload already exists in ClusterQueue")
+		return errWorkloadAlreadyExists
 	}
-	wi := workload.NewInfo(w)
 	c.Workloads[k] = wi
+	if states := admissionCheckStates(w); len(states) > 0 {
+		if c.admissionChecks == nil {
+			c.admissionChecks = make(map[string]map[string]AdmissionCheckState)
+		}
+		c.admissionChecks[k] = states
+	}
+	c.trackUnknownFlavors(wi)
 	c.updateWorkloadUsage(wi, 1)
 	if c.podsReadyTracking && !apimeta.IsStatusConditionTrue(w.Status.Conditions, kueue.WorkloadPodsReady) {
 		c.WorkloadsNotReady.Insert(k)
 	}
-	reportAdmittedActiveWorkloads(wi.ClusterQueue, len(c.Workloads))
+	c.reporter.reportAdmittedActiveWorkloads(wi.ClusterQueue, len(c.Workloads))
+	return nil
+}
+
+// validatePodSetAssignments verifies that the admission of the workload assigns
+// a flavor to every resource with quota in the ClusterQueue requested by each
+// of its podSets, so that the usage of the workload is fully accounted.
+func (c *ClusterQueue) validatePodSetAssignments(w *kueue.Workload) error {
+	assignments := make(map[string]*kueue.PodSetAssignment, len(w.Status.Admission.PodSetAssignments))
+	for i := range w.Status.Admission.PodSetAssignments {
+		psa := &w.Status.Admission.PodSetAssignments[i]
+		assignments[psa.Name] = psa
+	}
+	for i := range w.Spec.PodSets {
+		ps := &w.Spec.PodSets[i]
+		requests := limitrange.TotalRequests(&ps.Template.Spec)
+		rNames := make([]corev1.ResourceName, 0, len(requests))
+		for rName, q := range requests {
+			if !q.IsZero() && c.coversResource(rName) {
+				rNames = append(rNames, rName)
+			}
+		}
+		if len(rNames) == 0 {
+			continue
+		}
+		psa, found := assignments[ps.Name]
+		if !found {
+			return fmt.Errorf("podSet %s has no assignment in the admission", ps.Name)
+		}
+		sort.Slice(rNames, func(i, j int) bool { return rNames[i] < rNames[j] })
+		for _, rName := range rNames {
+			if _, found := psa.Flavors[rName]; !found {
+				return fmt.Errorf("podSet %s has no flavor assigned for %s", ps.Name, rName)
+			}
+		}
+	}
+	return nil
+}
+
+// coversResource returns whether the ClusterQueue has quota for the resource,
+// directly or through its alias.
+func (c *ClusterQueue) coversResource(rName corev1.ResourceName) bool {
+	if canonical, found := c.resourceAliases[rName]; found {
+		rName = canonical
+	}
+	_, found := c.RGByResource[rName]
+	return found
+}
+
+// coversRequests returns whether the ClusterQueue covers all the resources
+// requested by the workload.
+func (c *ClusterQueue) coversRequests(wl *workload.Info) bool {
+	for _, ps := range wl.TotalRequests {
+		for rName, v := range ps.Requests {
+			if v > 0 && !c.coversResource(rName) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// newWorkloadInfo returns the workload information, with the limits of the
+// pods counted instead of their requests in QuotaModeLimits, the requests of
+// admitted workloads including the init containers and the pod overhead, the
+// requests for resource aliases counted under their canonical resource names
+// and the requests expressed as percentages resolved against the nominal
+// quota of the assigned flavors.
+func (c *ClusterQueue) newWorkloadInfo(w *kueue.Workload) *workload.Info {
+	wi := workload.NewInfo(w)
+	percentages := requestPercentages(w)
+	if len(c.resourceAliases) == 0 && len(percentages) == 0 && c.quotaMode != QuotaModeLimits && w.Status.Admission == nil {
+		return wi
+	}
+	for i := range wi.TotalRequests {
+		psr := &wi.TotalRequests[i]
+		// The flavors are shared with the workload object.
+		psr.Flavors = maps.Clone(psr.Flavors)
+		if c.quotaMode == QuotaModeLimits {
+			applyLimits(w, psr)
+		} else if w.Status.Admission != nil {
+			applyPodRequests(w, psr)
+		}
+		c.canonicalizeRequests(psr.Requests)
+		for alias, canonical := range c.resourceAliases {
+			if fName, found := psr.Flavors[alias]; found {
+				delete(psr.Flavors, alias)
+				if _, found := psr.Flavors[canonical]; !found {
+					psr.Flavors[canonical] = fName
+				}
+			}
+		}
+		for rName, pct := range percentages[psr.Name] {
+			if canonical, found := c.resourceAliases[rName]; found {
+				rName = canonical
+			}
+			fName, found := psr.Flavors[rName]
+			if !found {
+				continue
+			}
+			if rQuota := c.resourceQuota(fName, rName); rQuota != nil {
+				if psr.Requests == nil {
+					psr.Requests = make(workload.Requests)
+				}
+				psr.Requests[rName] = rQuota.Nominal * pct / 100
+			}
+		}
+	}
+	return wi
+}
+
+// normalizedInfo returns the info of the workload as the ClusterQueue accounts
+// for it, with the resource aliases, request percentages and quota mode of the
+// ClusterQueue applied. All the checks of whether a workload fits go through
+// it, so that they agree with the usage the workload adds once admitted.
+func (c *ClusterQueue) normalizedInfo(wl *workload.Info) *workload.Info {
+	wi := c.newWorkloadInfo(wl.Obj)
+	wi.ClusterQueue = wl.ClusterQueue
+	return wi
+}
+
+// canonicalizeRequests moves the requests for the resource aliases of the
+// ClusterQueue to their canonical resources.
+func (c *ClusterQueue) canonicalizeRequests(requests workload.Requests) {
+	for alias, canonical := range c.resourceAliases {
+		if v, found := requests[alias]; found {
+			delete(requests, alias)
+			requests[canonical] += v
+		}
+	}
+}
+
+// applyLimits replaces the requests of the podSet with the limits of its pod
+// template, scaled to the count of the podSet.
+func applyLimits(w *kueue.Workload, psr *workload.PodSetResources) {
+	ps := podSet(w, psr.Name)
+	if ps == nil {
+		return
+	}
+	if psr.Requests == nil {
+		psr.Requests = make(workload.Requests)
+	}
+	for rName, q := range limitrange.TotalLimits(&ps.Template.Spec) {
+		psr.Requests[rName] = workload.ResourceValue(rName, q) * int64(psr.Count)
+	}
+}
+
+// applyPodRequests raises the requests of the podSet, taken from the
+// admission, to the requests of its pod template scaled to the count of the
+// podSet, for the resources with an assigned flavor. Like in the Kubernetes
+// scheduler, the requests of a pod include the largest requests of its init
+// containers and the pod overhead.
+func applyPodRequests(w *kueue.Workload, psr *workload.PodSetResources) {
+	ps := podSet(w, psr.Name)
+	if ps == nil {
+		return
+	}
+	for rName, q := range limitrange.TotalRequests(&ps.Template.Spec) {
+		if _, assigned := psr.Flavors[rName]; !assigned {
+			continue
+		}
+		if v := workload.ResourceValue(rName, q) * int64(psr.Count); v > psr.Requests[rName] {
+			if psr.Requests == nil {
+				psr.Requests = make(workload.Requests)
+			}
+			psr.Requests[rName] = v
+		}
+	}
+}
+
+// podSet returns the podSet of the workload with the name, or nil if there
+// is none.
+func podSet(w *kueue.Workload, name string) *kueue.PodSet {
+	for i := range w.Spec.PodSets {
+		if w.Spec.PodSets[i].Name == name {
+			return &w.Spec.PodSets[i]
+		}
+	}
 	return nil
 }
 
+// requestPercentages parses the RequestPercentagesAnnotation of the workload,
+// keyed by podSet and resource. Malformed entries are ignored.
+func requestPercentages(w *kueue.Workload) map[string]map[corev1.ResourceName]int64 {
+	v, found := w.Annotations[RequestPercentagesAnnotation]
+	if !found {
+		return nil
+	}
+	percentages := make(map[string]map[corev1.ResourceName]int64)
+	for _, entry := range strings.Split(v, ",") {
+		key, pctStr, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			continue
+		}
+		psName, rName, found := strings.Cut(key, ":")
+		if !found || psName == "" || rName == "" {
+			continue
+		}
+		pct, err := strconv.ParseInt(strings.TrimSuffix(pctStr, "%"), 10, 64)
+		if err != nil || pct < 0 {
+			continue
+		}
+		if percentages[psName] == nil {
+			percentages[psName] = make(map[corev1.ResourceName]int64)
+		}
+		percentages[psName][corev1.ResourceName(rName)] = pct
+	}
+	return percentages
+}
+
 func (c *ClusterQueue) deleteWorkload(w *kueue.Workload) {
 	k := workload.Key(w)
 	wi, exist := c.Workloads[k]
@@ -257,25 +891,142 @@ func (c *ClusterQueue) deleteWorkload(w *kueue.Workload) {
 		return
 	}
 	c.updateWorkloadUsage(wi, -1)
+	if c.pruneUnknownFlavors(wi) {
+		c.clearUsageMetrics()
+		c.reportUsage()
+	}
 	if c.podsReadyTracking && !apimeta.IsStatusConditionTrue(w.Status.Conditions, kueue.WorkloadPodsReady) {
 		c.WorkloadsNotReady.Delete(k)
 	}
 	delete(c.Workloads, k)
-	reportAdmittedActiveWorkloads(wi.ClusterQueue, len(c.Workloads))
+	delete(c.admissionChecks, k)
+	c.reporter.reportAdmittedActiveWorkloads(wi.ClusterQueue, len(c.Workloads))
 }
 
 // updateWorkloadUsage updates the usage of the ClusterQueue for the workload
 // and the number of admitted workloads for local queues.
 func (c *ClusterQueue) updateWorkloadUsage(wi *workload.Info, m int64) {
+	q, ok := c.localQueues[workload.QueueKey(wi.Obj)]
+	if ok && q.usageReleased {
+		q.admittedWorkloads += int(m)
+		return
+	}
 	updateUsage(wi, c.Usage, m)
-	qKey := workload.QueueKey(wi.Obj)
-	if _, ok := c.localQueues[qKey]; ok {
-		updateUsage(wi, c.localQueues[qKey].usage, m)
-		c.localQueues[qKey].admittedWorkloads += int(m)
+	if ok {
+		updateUsage(wi, q.usage, m)
+		q.admittedWorkloads += int(m)
+	}
+	c.reportUsage()
+}
+
+// equalResourceGroups returns whether the resource groups cover the same
+// resources with the same flavors, in the same order, and quotas.
+func equalResourceGroups(a, b []ResourceGroup) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].CoveredResources.Equal(b[i].CoveredResources) || len(a[i].Flavors) != len(b[i].Flavors) {
+			return false
+		}
+		for j := range a[i].Flavors {
+			aFlv, bFlv := &a[i].Flavors[j], &b[i].Flavors[j]
+			if aFlv.Name != bFlv.Name || aFlv.IsDefault != bFlv.IsDefault || len(aFlv.Resources) != len(bFlv.Resources) {
+				return false
+			}
+			for rName, aQuota := range aFlv.Resources {
+				bQuota, found := bFlv.Resources[rName]
+				if !found || aQuota.Nominal != bQuota.Nominal || !equality.Semantic.DeepEqual(aQuota.BorrowingLimit, bQuota.BorrowingLimit) || !equality.Semantic.DeepEqual(aQuota.UsageCap, bQuota.UsageCap) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// trackUnknownFlavors adds usage entries for the flavors assigned to the
+// workload that the ClusterQueue doesn't define for resources it covers, for
+// example, because they were removed from its spec after the workload was
+// admitted. This keeps the usage of the workload accounted for, instead of
+// silently dropping it. Resources not covered by the ClusterQueue are
+// ignored.
+func (c *ClusterQueue) trackUnknownFlavors(wi *workload.Info) {
+	for fName, resUsage := range workloadUsage(wi) {
+		for rName := range resUsage {
+			if _, covered := c.RGByResource[rName]; !covered {
+				continue
+			}
+			if _, found := c.Usage[fName][rName]; found {
+				continue
+			}
+			if c.Usage[fName] == nil {
+				c.Usage[fName] = make(map[corev1.ResourceName]int64)
+			}
+			c.Usage[fName][rName] = 0
+		}
+	}
+}
+
+// pruneUnknownFlavors removes the unused entries added by trackUnknownFlavors
+// for the workload. Returns whether any entry was removed.
+func (c *ClusterQueue) pruneUnknownFlavors(wi *workload.Info) bool {
+	pruned := false
+	for fName, resUsage := range workloadUsage(wi) {
+		for rName := range resUsage {
+			if c.resourceQuota(fName, rName) != nil {
+				continue
+			}
+			if used, found := c.Usage[fName][rName]; found && used == 0 {
+				delete(c.Usage[fName], rName)
+				pruned = true
+			}
+		}
+		if flvUsage, found := c.Usage[fName]; found && len(flvUsage) == 0 {
+			delete(c.Usage, fName)
+		}
+	}
+	return pruned
+}
+
+// recomputeUsage rebuilds the usage of the ClusterQueue and its localQueues
+// from the admitted workloads and the given quota reservations.
+func (c *ClusterQueue) recomputeUsage(reserved []FlavorResourceQuantities) {
+	resetUsage(c.Usage)
+	for _, q := range c.localQueues {
+		resetUsage(q.usage)
+		q.admittedWorkloads = 0
+	}
+	for _, wi := range c.Workloads {
+		q, ok := c.localQueues[workload.QueueKey(wi.Obj)]
+		if ok {
+			q.admittedWorkloads++
+			if q.usageReleased {
+				continue
+			}
+			updateUsage(wi, q.usage, 1)
+		}
+		updateUsage(wi, c.Usage, 1)
+	}
+	for _, usage := range reserved {
+		c.updateReservedUsage(usage, 1)
+	}
+	c.reportUsage()
+}
+
+// resetUsage sets all the quantities to zero, keeping the flavors and resources.
+func resetUsage(usage FlavorResourceQuantities) {
+	for _, resUsage := range usage {
+		for rName := range resUsage {
+			resUsage[rName] = 0
+		}
 	}
 }
 
 func updateUsage(wi *workload.Info, flvUsage FlavorResourceQuantities, m int64) {
+	if isGangPending(wi.Obj) {
+		return
+	}
 	for _, ps := range wi.TotalRequests {
 		for wlRes, wlResFlv := range ps.Flavors {
 			v, wlResExist := ps.Requests[wlRes]
@@ -289,6 +1040,14 @@ func updateUsage(wi *workload.Info, flvUsage FlavorResourceQuantities, m int64)
 	}
 }
 
+// isGangPending returns whether the workload is an admitted gang whose pods
+// are not ready yet, in which case its usage is not accounted.
+func isGangPending(w *kueue.Workload) bool {
+	return w.Annotations[GangAnnotation] == "true" &&
+		workload.IsAdmitted(w) &&
+		!apimeta.IsStatusConditionTrue(w.Status.Conditions, kueue.WorkloadPodsReady)
+}
+
 func (c *ClusterQueue) addLocalQueue(q *kueue.LocalQueue) error {
 	qKey := queueKey(q)
 	if _, ok := c.localQueues[qKey]; ok {
@@ -301,6 +1060,9 @@ func (c *ClusterQueue) addLocalQueue(q *kueue.LocalQueue) error {
 		admittedWorkloads: 0,
 		usage:             make(FlavorResourceQuantities),
 	}
+	if err := qImpl.updateDefaultPriority(q); err != nil {
+		return err
+	}
 	if err := qImpl.resetFlavorsAndResources(c.Usage); err != nil {
 		return err
 	}
@@ -314,9 +1076,54 @@ func (c *ClusterQueue) addLocalQueue(q *kueue.LocalQueue) error {
 	return nil
 }
 
+func (c *ClusterQueue) reconcileLocalQueue(q *kueue.LocalQueue) error {
+	qImpl, ok := c.localQueues[queueKey(q)]
+	if !ok {
+		return errQNotFound
+	}
+	if err := qImpl.resetFlavorsAndResources(c.Usage); err != nil {
+		return err
+	}
+	resetUsage(qImpl.usage)
+	qImpl.admittedWorkloads = 0
+	for _, wl := range c.Workloads {
+		if workloadBelongsToLocalQueue(wl.Obj, q) {
+			if !qImpl.usageReleased {
+				updateUsage(wl, qImpl.usage, 1)
+			}
+			qImpl.admittedWorkloads++
+		}
+	}
+	return nil
+}
+
+// pendingWorkload is a workload waiting for admission in a ClusterQueue.
+type pendingWorkload struct {
+	// localQueue is the key of the localQueue of the workload.
+	localQueue string
+	priority   int32
+	// firstSeen is when the cache first saw the workload pending.
+	firstSeen time.Time
+}
+
 func (c *ClusterQueue) deleteLocalQueue(q *kueue.LocalQueue) {
 	qKey := queueKey(q)
+	if qImpl, ok := c.localQueues[qKey]; ok && qImpl.usageReleased {
+		// The workloads of the queue are accounted in the ClusterQueue again,
+		// as they are removed from it without their LocalQueue.
+		for _, wl := range c.Workloads {
+			if workloadBelongsToLocalQueue(wl.Obj, q) {
+				updateUsage(wl, c.Usage, 1)
+			}
+		}
+		c.reportUsage()
+	}
 	delete(c.localQueues, qKey)
+	for wlKey, pending := range c.pendingWorkloads {
+		if pending.localQueue == qKey {
+			delete(c.pendingWorkloads, wlKey)
+		}
+	}
 }
 
 func (c *ClusterQueue) flavorInUse(flavor string) bool {
@@ -330,6 +1137,38 @@ func (c *ClusterQueue) flavorInUse(flavor string) bool {
 	return false
 }
 
+// stopLocalQueue releases the usage of the workloads of the LocalQueue from
+// the ClusterQueue and zeroes the usage of the LocalQueue.
+func (c *ClusterQueue) stopLocalQueue(q *kueue.LocalQueue) error {
+	qImpl, ok := c.localQueues[queueKey(q)]
+	if !ok {
+		return errQNotFound
+	}
+	if qImpl.usageReleased {
+		return nil
+	}
+	for _, wl := range c.Workloads {
+		if workloadBelongsToLocalQueue(wl.Obj, q) {
+			updateUsage(wl, c.Usage, -1)
+		}
+	}
+	resetUsage(qImpl.usage)
+	qImpl.usageReleased = true
+	c.reportUsage()
+	return nil
+}
+
+// updateDefaultPriority sets the default priority of the queue from the
+// annotation of the LocalQueue.
+func (q *queue) updateDefaultPriority(lq *kueue.LocalQueue) error {
+	p, err := parseInt32Annotation(lq.Annotations, DefaultPriorityAnnotation)
+	if err != nil {
+		return err
+	}
+	q.defaultPriority = p
+	return nil
+}
+
 func (q *queue) resetFlavorsAndResources(cqUsage FlavorResourceQuantities) error {
 	// Clean up removed flavors or resources.
 	usedFlavorResources := make(FlavorResourceQuantities)
@@ -348,7 +1187,3 @@ func (q *queue) resetFlavorsAndResources(cqUsage FlavorResourceQuantities) error
 func workloadBelongsToLocalQueue(wl *kueue.Workload, q *kueue.LocalQueue) bool {
 	return wl.Namespace == q.Namespace && wl.Spec.QueueName == q.Name
 }
-
-func reportAdmittedActiveWorkloads(cqName string, val int) {
-	metrics.AdmittedActiveWorkloads.WithLabelValues(cqName).Set(float64(val))
-}
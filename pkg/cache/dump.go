@@ -0,0 +1,135 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"encoding/json"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+type cacheDump struct {
+	ClusterQueues    []clusterQueueDump    `json:"clusterQueues"`
+	Cohorts          []cohortDump          `json:"cohorts"`
+	AssumedWorkloads []assumedWorkloadDump `json:"assumedWorkloads"`
+}
+
+type clusterQueueDump struct {
+	Name           string                   `json:"name"`
+	Cohort         string                   `json:"cohort,omitempty"`
+	Status         string                   `json:"status"`
+	ResourceGroups []resourceGroupDump      `json:"resourceGroups"`
+	Usage          FlavorResourceQuantities `json:"usage"`
+}
+
+type resourceGroupDump struct {
+	CoveredResources []corev1.ResourceName `json:"coveredResources"`
+	Flavors          []flavorQuotasDump    `json:"flavors"`
+}
+
+type flavorQuotasDump struct {
+	Name      kueue.ResourceFlavorReference             `json:"name"`
+	Resources map[corev1.ResourceName]resourceQuotaDump `json:"resources"`
+}
+
+type resourceQuotaDump struct {
+	Nominal        int64  `json:"nominal"`
+	BorrowingLimit *int64 `json:"borrowingLimit,omitempty"`
+	UsageCap       *int64 `json:"usageCap,omitempty"`
+}
+
+type cohortDump struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+type assumedWorkloadDump struct {
+	Workload     string `json:"workload"`
+	ClusterQueue string `json:"clusterQueue"`
+}
+
+// Dump serializes the ClusterQueues, cohorts and assumed workloads in the
+// cache as JSON, for debugging. The output is deterministic, so that dumps
+// can be compared.
+func (c *Cache) Dump() ([]byte, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	d := cacheDump{
+		ClusterQueues:    make([]clusterQueueDump, 0, len(c.clusterQueues)),
+		Cohorts:          make([]cohortDump, 0, len(c.cohorts)),
+		AssumedWorkloads: make([]assumedWorkloadDump, 0, len(c.assumedWorkloads)),
+	}
+	for _, cq := range c.clusterQueues {
+		d.ClusterQueues = append(d.ClusterQueues, cq.dump())
+	}
+	sort.Slice(d.ClusterQueues, func(i, j int) bool { return d.ClusterQueues[i].Name < d.ClusterQueues[j].Name })
+
+	for name, cohort := range c.cohorts {
+		members := sets.New[string]()
+		for cq := range cohort.Members {
+			members.Insert(cq.Name)
+		}
+		d.Cohorts = append(d.Cohorts, cohortDump{Name: name, Members: sets.List(members)})
+	}
+	sort.Slice(d.Cohorts, func(i, j int) bool { return d.Cohorts[i].Name < d.Cohorts[j].Name })
+
+	for wlKey, cqName := range c.assumedWorkloads {
+		d.AssumedWorkloads = append(d.AssumedWorkloads, assumedWorkloadDump{Workload: wlKey, ClusterQueue: cqName})
+	}
+	sort.Slice(d.AssumedWorkloads, func(i, j int) bool { return d.AssumedWorkloads[i].Workload < d.AssumedWorkloads[j].Workload })
+
+	return json.MarshalIndent(d, "", "  ")
+}
+
+func (c *ClusterQueue) dump() clusterQueueDump {
+	d := clusterQueueDump{
+		Name:           c.Name,
+		Status:         string(c.Status),
+		ResourceGroups: make([]resourceGroupDump, 0, len(c.ResourceGroups)),
+		Usage:          c.Usage,
+	}
+	if c.Cohort != nil {
+		d.Cohort = c.Cohort.Name
+	}
+	for _, rg := range c.ResourceGroups {
+		rgDump := resourceGroupDump{
+			CoveredResources: sets.List(rg.CoveredResources),
+			Flavors:          make([]flavorQuotasDump, 0, len(rg.Flavors)),
+		}
+		for _, flvQuotas := range rg.Flavors {
+			flvDump := flavorQuotasDump{
+				Name:      flvQuotas.Name,
+				Resources: make(map[corev1.ResourceName]resourceQuotaDump, len(flvQuotas.Resources)),
+			}
+			for rName, rQuota := range flvQuotas.Resources {
+				flvDump.Resources[rName] = resourceQuotaDump{
+					Nominal:        rQuota.Nominal,
+					BorrowingLimit: rQuota.BorrowingLimit,
+					UsageCap:       rQuota.UsageCap,
+				}
+			}
+			rgDump.Flavors = append(rgDump.Flavors, flvDump)
+		}
+		d.ResourceGroups = append(d.ResourceGroups, rgDump)
+	}
+	return d
+}
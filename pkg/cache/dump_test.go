@@ -0,0 +1,205 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+)
+
+func TestDump(t *testing.T) {
+	// Same ClusterQueues as the "add" case of TestCacheClusterQueueOperations.
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(
+				*utiltesting.MakeFlavorQuotas("default").
+					Resource(corev1.ResourceCPU, "10", "10").Obj()).
+			Cohort("one").
+			NamespaceSelector(nil).
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(
+				*utiltesting.MakeFlavorQuotas("default").
+					Resource(corev1.ResourceCPU, "15").Obj()).
+			Cohort("one").
+			NamespaceSelector(nil).
+			Obj(),
+		utiltesting.MakeClusterQueue("c").
+			Cohort("two").
+			NamespaceSelector(nil).
+			Obj(),
+		utiltesting.MakeClusterQueue("d").
+			NamespaceSelector(nil).
+			Obj(),
+		utiltesting.MakeClusterQueue("e").
+			ResourceGroup(
+				*utiltesting.MakeFlavorQuotas("nonexistent-flavor").
+					Resource(corev1.ResourceCPU, "15").Obj()).
+			Cohort("two").
+			NamespaceSelector(nil).
+			Obj(),
+	}
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Label("cpuType", "default").Obj())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	if err := cache.AssumeWorkload(utiltesting.MakeWorkload("wl", "ns").
+		Request(corev1.ResourceCPU, "2").
+		Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "default", "2").Obj()).
+		Obj()); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+
+	got, err := cache.Dump()
+	if err != nil {
+		t.Fatalf("Dump() failed: %v", err)
+	}
+	if diff := cmp.Diff(wantDump, string(got)); diff != "" {
+		t.Errorf("Unexpected dump (-want,+got):\n%s", diff)
+	}
+}
+
+const wantDump = `{
+  "clusterQueues": [
+    {
+      "name": "a",
+      "cohort": "one",
+      "status": "active",
+      "resourceGroups": [
+        {
+          "coveredResources": [
+            "cpu"
+          ],
+          "flavors": [
+            {
+              "name": "default",
+              "resources": {
+                "cpu": {
+                  "nominal": 10000,
+                  "borrowingLimit": 10000
+                }
+              }
+            }
+          ]
+        }
+      ],
+      "usage": {
+        "default": {
+          "cpu": 2000
+        }
+      }
+    },
+    {
+      "name": "b",
+      "cohort": "one",
+      "status": "active",
+      "resourceGroups": [
+        {
+          "coveredResources": [
+            "cpu"
+          ],
+          "flavors": [
+            {
+              "name": "default",
+              "resources": {
+                "cpu": {
+                  "nominal": 15000
+                }
+              }
+            }
+          ]
+        }
+      ],
+      "usage": {
+        "default": {
+          "cpu": 0
+        }
+      }
+    },
+    {
+      "name": "c",
+      "cohort": "two",
+      "status": "active",
+      "resourceGroups": [],
+      "usage": {}
+    },
+    {
+      "name": "d",
+      "status": "active",
+      "resourceGroups": [],
+      "usage": {}
+    },
+    {
+      "name": "e",
+      "cohort": "two",
+      "status": "pending",
+      "resourceGroups": [
+        {
+          "coveredResources": [
+            "cpu"
+          ],
+          "flavors": [
+            {
+              "name": "nonexistent-flavor",
+              "resources": {
+                "cpu": {
+                  "nominal": 15000
+                }
+              }
+            }
+          ]
+        }
+      ],
+      "usage": {
+        "nonexistent-flavor": {
+          "cpu": 0
+        }
+      }
+    }
+  ],
+  "cohorts": [
+    {
+      "name": "one",
+      "members": [
+        "a",
+        "b"
+      ]
+    },
+    {
+      "name": "two",
+      "members": [
+        "c",
+        "e"
+      ]
+    }
+  ],
+  "assumedWorkloads": [
+    {
+      "workload": "ns/wl",
+      "clusterQueue": "a"
+    }
+  ]
+}`
@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+// externalQuotaTimeout bounds the calls to the external quota service made
+// by the cache operations, which don't take a context.
+const externalQuotaTimeout = 10 * time.Second
+
+// ExternalQuotaClient is a client of a quota service, external to the
+// cluster, that accounts for the usage of the admitted workloads in addition
+// to their ClusterQueues. The cache never calls it while holding its lock.
+type ExternalQuotaClient interface {
+	// Remaining returns the balance left for the resource in the flavor.
+	Remaining(ctx context.Context, fName kueue.ResourceFlavorReference, rName corev1.ResourceName) (int64, error)
+	// Consume decrements the balance by the usage.
+	Consume(ctx context.Context, usage FlavorResourceQuantities) error
+	// Release increments the balance by the usage.
+	Release(ctx context.Context, usage FlavorResourceQuantities) error
+}
+
+// WithExternalQuotaClient configures the cache to check the balance of an
+// external quota service in CanAdmit, consume it when workloads are assumed
+// and release it when they are forgotten, deleted or evicted.
+func WithExternalQuotaClient(client ExternalQuotaClient) Option {
+	return func(o *options) {
+		o.externalQuota = client
+	}
+}
+
+// CanAdmit returns whether the workload, using the flavors assigned in its
+// admission, fits in the ClusterQueue and, when configured, in the balance
+// of the external quota service. Errors reaching the external quota service
+// make the workload inadmissible.
+func (c *Cache) CanAdmit(ctx context.Context, cqName string, wl *workload.Info) (bool, error) {
+	fits, usage, err := c.fitsWithUsage(cqName, wl)
+	if err != nil || !fits || c.externalQuota == nil {
+		return fits, err
+	}
+	for fName, resUsage := range usage {
+		for rName, val := range resUsage {
+			remaining, err := c.externalQuota.Remaining(ctx, fName, rName)
+			if err != nil {
+				return false, fmt.Errorf("getting the external quota for %s in flavor %s: %w", rName, fName, err)
+			}
+			if val > remaining {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func (c *Cache) fitsWithUsage(cqName string, wl *workload.Info) (bool, FlavorResourceQuantities, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return false, nil, errCqNotFound
+	}
+	wl = cq.normalizedInfo(wl)
+	if err := cq.checkWorkloadSize(wl); err != nil {
+		return false, nil, err
+	}
+	if !cq.fits(wl) {
+		return false, nil, nil
+	}
+	return true, workloadUsage(wl), nil
+}
+
+// externalUsage returns the usage of the workload to account for in the
+// external quota service, or nil if there is nothing to account for. It's
+// meant to be called under the lock, so that the usage can be consumed or
+// released once the lock is released.
+func (c *Cache) externalUsage(wi *workload.Info) FlavorResourceQuantities {
+	if c.externalQuota == nil || wi == nil {
+		return nil
+	}
+	return workloadUsage(wi)
+}
+
+// consumeExternalQuota and releaseExternalQuota must be called without
+// holding the lock.
+func (c *Cache) consumeExternalQuota(usage FlavorResourceQuantities) error {
+	if usage == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), externalQuotaTimeout)
+	defer cancel()
+	if err := c.externalQuota.Consume(ctx, usage); err != nil {
+		return fmt.Errorf("consuming external quota: %w", err)
+	}
+	return nil
+}
+
+func (c *Cache) releaseExternalQuota(usage FlavorResourceQuantities) error {
+	if usage == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), externalQuotaTimeout)
+	defer cancel()
+	if err := c.externalQuota.Release(ctx, usage); err != nil {
+		return fmt.Errorf("releasing external quota: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+type fakeExternalQuota struct {
+	balance FlavorResourceQuantities
+	err     error
+	// cache, if set, is checked not to be locked during the calls.
+	cache       *Cache
+	lockedCalls int
+}
+
+func (f *fakeExternalQuota) checkUnlocked() {
+	if f.cache == nil {
+		return
+	}
+	if !f.cache.TryLock() {
+		f.lockedCalls++
+		return
+	}
+	f.cache.Unlock()
+}
+
+func (f *fakeExternalQuota) Remaining(_ context.Context, fName kueue.ResourceFlavorReference, rName corev1.ResourceName) (int64, error) {
+	f.checkUnlocked()
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.balance[fName][rName], nil
+}
+
+func (f *fakeExternalQuota) Consume(_ context.Context, usage FlavorResourceQuantities) error {
+	return f.update(usage, -1)
+}
+
+func (f *fakeExternalQuota) Release(_ context.Context, usage FlavorResourceQuantities) error {
+	return f.update(usage, 1)
+}
+
+func (f *fakeExternalQuota) update(usage FlavorResourceQuantities, m int64) error {
+	f.checkUnlocked()
+	if f.err != nil {
+		return f.err
+	}
+	for fName, resUsage := range usage {
+		for rName, v := range resUsage {
+			f.balance[fName][rName] += v * m
+		}
+	}
+	return nil
+}
+
+func TestCanAdmitWithExternalQuota(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	first := utiltesting.MakeWorkload("first", "ns").
+		Request(corev1.ResourceCPU, "4").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+		Obj()
+	second := utiltesting.MakeWorkload("second", "ns").
+		Request(corev1.ResourceCPU, "4").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+		Obj()
+
+	external := &fakeExternalQuota{
+		balance: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 6_000}},
+	}
+	cache := New(utiltesting.NewFakeClient(), WithExternalQuotaClient(external))
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+
+	check := func(wl *kueue.Workload, want bool) {
+		t.Helper()
+		got, err := cache.CanAdmit(context.Background(), "foo", workload.NewInfo(wl))
+		if err != nil {
+			t.Fatalf("CanAdmit(%s) failed: %v", wl.Name, err)
+		}
+		if got != want {
+			t.Errorf("CanAdmit(%s) = %t, want %t", wl.Name, got, want)
+		}
+	}
+	checkBalance := func(want int64) {
+		t.Helper()
+		if diff := cmp.Diff(want, external.balance["default"][corev1.ResourceCPU]); diff != "" {
+			t.Errorf("Unexpected external balance (-want,+got):\n%s", diff)
+		}
+	}
+
+	check(first, true)
+	if err := cache.AssumeWorkload(first); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+	checkBalance(2_000)
+
+	// The ClusterQueue has 6 CPUs left, but the external balance only 2.
+	check(second, false)
+
+	if err := cache.DeleteWorkload(first); err != nil {
+		t.Fatalf("Deleting workload: %v", err)
+	}
+	checkBalance(6_000)
+	check(second, true)
+
+	external.err = errors.New("connection refused")
+	got, err := cache.CanAdmit(context.Background(), "foo", workload.NewInfo(second))
+	if err == nil || got {
+		t.Errorf("CanAdmit with unreachable external quota = %t, %v; want false and an error", got, err)
+	}
+	if err := cache.AssumeWorkload(second); err == nil {
+		t.Errorf("AssumeWorkload with unreachable external quota succeeded, want error")
+	}
+	if !cache.ClusterQueueEmpty("foo") {
+		t.Errorf("ClusterQueue holds the workload that failed to consume the external quota")
+	}
+}
+
+func TestExternalQuotaCalledWithoutLock(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	admission := utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "4").Obj()
+	first := utiltesting.MakeWorkload("first", "ns").Request(corev1.ResourceCPU, "4").Admit(admission).Obj()
+	second := utiltesting.MakeWorkload("second", "ns").Request(corev1.ResourceCPU, "4").Admit(admission).Obj()
+	third := utiltesting.MakeWorkload("third", "ns").Request(corev1.ResourceCPU, "4").Admit(admission).Obj()
+
+	external := &fakeExternalQuota{
+		balance: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 20_000}},
+	}
+	cache := New(utiltesting.NewFakeClient(), WithExternalQuotaClient(external))
+	external.cache = cache
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+
+	if _, err := cache.CanAdmit(context.Background(), "foo", workload.NewInfo(first)); err != nil {
+		t.Fatalf("CanAdmit: %v", err)
+	}
+	if err := cache.AssumeWorkload(first); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+	if err := cache.AssumeWorkload(second); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+	if err := cache.AssumeWithPreemption(workload.NewInfo(third), []string{workload.Key(second)}); err != nil {
+		t.Fatalf("Assuming workload with preemption: %v", err)
+	}
+	if err := cache.ForgetWorkload(first); err != nil {
+		t.Fatalf("Forgetting workload: %v", err)
+	}
+	if _, err := cache.DrainClusterQueue("foo"); err != nil {
+		t.Fatalf("Draining ClusterQueue: %v", err)
+	}
+
+	if external.lockedCalls != 0 {
+		t.Errorf("The external quota service was called %d times while holding the cache lock", external.lockedCalls)
+	}
+	if diff := cmp.Diff(int64(20_000), external.balance["default"][corev1.ResourceCPU]); diff != "" {
+		t.Errorf("Unexpected external balance (-want,+got):\n%s", diff)
+	}
+}
@@ -0,0 +1,321 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+// MemberShare describes the share of the cohort quota used by one of its
+// ClusterQueues.
+type MemberShare struct {
+	ClusterQueue string
+	Resources    []ResourceShare
+}
+
+// ResourceShare is the share of a resource in a flavor used by a member of the
+// cohort. Borrowed is the usage above the nominal quota. Lent is the part of
+// the unused nominal quota that is borrowed by the other members; the
+// quota borrowed in the cohort is attributed to the lenders in proportion to
+// their unused nominal quota.
+type ResourceShare struct {
+	Flavor   kueue.ResourceFlavorReference
+	Resource corev1.ResourceName
+	Nominal  int64
+	Usage    int64
+	Borrowed int64
+	Lent     int64
+}
+
+// AdmissionFairnessStats returns the share of each member of the cohort,
+// sorted by ClusterQueue name.
+func (c *Cache) AdmissionFairnessStats(cohortName string) ([]MemberShare, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cohort, ok := c.cohorts[cohortName]
+	if !ok {
+		return nil, errCohortNotFound
+	}
+	members := make([]*ClusterQueue, 0, cohort.Members.Len())
+	for cq := range cohort.Members {
+		members = append(members, cq)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+
+	// Total borrowed and unused nominal quota in the cohort, per flavor and resource.
+	borrowed := make(FlavorResourceQuantities)
+	unused := make(FlavorResourceQuantities)
+	shares := make([]MemberShare, len(members))
+	for i, cq := range members {
+		shares[i].ClusterQueue = cq.Name
+		for _, rg := range cq.ResourceGroups {
+			for _, flvQuotas := range rg.Flavors {
+				rNames := make([]corev1.ResourceName, 0, len(flvQuotas.Resources))
+				for rName := range flvQuotas.Resources {
+					rNames = append(rNames, rName)
+				}
+				sort.Slice(rNames, func(i, j int) bool { return rNames[i] < rNames[j] })
+				for _, rName := range rNames {
+					share := ResourceShare{
+						Flavor:   flvQuotas.Name,
+						Resource: rName,
+						Nominal:  flvQuotas.Resources[rName].Nominal,
+						Usage:    cq.Usage[flvQuotas.Name][rName],
+					}
+					if share.Usage > share.Nominal {
+						share.Borrowed = share.Usage - share.Nominal
+						addQuantity(borrowed, share.Flavor, rName, share.Borrowed)
+					} else {
+						addQuantity(unused, share.Flavor, rName, share.Nominal-share.Usage)
+					}
+					shares[i].Resources = append(shares[i].Resources, share)
+				}
+			}
+		}
+	}
+
+	for i := range shares {
+		for j := range shares[i].Resources {
+			share := &shares[i].Resources[j]
+			totalUnused := unused[share.Flavor][share.Resource]
+			if share.Borrowed > 0 || totalUnused == 0 {
+				continue
+			}
+			totalBorrowed := borrowed[share.Flavor][share.Resource]
+			if totalBorrowed > totalUnused {
+				totalBorrowed = totalUnused
+			}
+			share.Lent = totalBorrowed * (share.Nominal - share.Usage) / totalUnused
+		}
+	}
+	return shares, nil
+}
+
+// DominantResourceShare returns the share, in per mille, of the cohort quota
+// that the ClusterQueue uses for its dominant resource: the flavor and
+// resource in which its usage is the largest fraction of the nominal quota
+// of the active members of the cohort. It's 0 for a ClusterQueue without a
+// cohort.
+func (c *Cache) DominantResourceShare(cqName string) (int64, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return 0, errCqNotFound
+	}
+	if cq.Cohort == nil {
+		return 0, nil
+	}
+	return dominantResourceShare(cq.Usage, cohortCapacity(cq.Cohort)), nil
+}
+
+// CohortCapacity returns the quota that the active members of the cohort can
+// lend to each other, per flavor and resource. ClusterQueues don't have
+// lending limits, so it's the sum of their nominal quotas. It's the
+// denominator of the shares computed by DominantResourceShare.
+func (c *Cache) CohortCapacity(cohortName string) (FlavorResourceQuantities, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cohort, ok := c.cohorts[cohortName]
+	if !ok {
+		return nil, errCohortNotFound
+	}
+	return cohortCapacity(cohort), nil
+}
+
+// RebalanceAction is a preemption suggested to make the dominant resource
+// shares of the members of a cohort more equal.
+type RebalanceAction struct {
+	ClusterQueue string
+	// Workload is the key of the workload to preempt.
+	Workload string
+	// Improvement is the reduction, in per mille, of the difference between
+	// the dominant resource share of the ClusterQueue and the lowest share
+	// among the members with pending workloads.
+	Improvement int64
+}
+
+// Rebalance suggests preemptions that move the dominant resource shares of
+// the members of the cohort towards equality, in favor of the members with
+// pending workloads. Each action preempts a workload from the member with
+// the largest share and is the one that most reduces the difference with
+// the lowest share among the members with pending workloads, assuming that
+// the previous actions were applied. The result is advisory; the cache is
+// not modified.
+func (c *Cache) Rebalance(cohortName string) ([]RebalanceAction, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cohort, ok := c.cohorts[cohortName]
+	if !ok {
+		return nil, errCohortNotFound
+	}
+	capacity := cohortCapacity(cohort)
+	usage := make(map[*ClusterQueue]FlavorResourceQuantities, cohort.Members.Len())
+	candidates := make(map[*ClusterQueue][]*workload.Info, cohort.Members.Len())
+	var needy []*ClusterQueue
+	for cq := range cohort.Members {
+		if !cq.Active() {
+			continue
+		}
+		usage[cq] = copyQuantities(cq.Usage)
+		for _, wi := range cq.Workloads {
+			if isGangPending(wi.Obj) {
+				continue
+			}
+			candidates[cq] = append(candidates[cq], wi)
+		}
+		sort.Slice(candidates[cq], func(i, j int) bool {
+			return workload.Key(candidates[cq][i].Obj) < workload.Key(candidates[cq][j].Obj)
+		})
+		if len(cq.pendingWorkloads) > 0 {
+			needy = append(needy, cq)
+		}
+	}
+	if len(needy) == 0 {
+		return nil, nil
+	}
+
+	var actions []RebalanceAction
+	for {
+		under := minShareMember(needy, usage, capacity)
+		underShare := dominantResourceShare(usage[under], capacity)
+		over := maxShareMember(usage, capacity, under)
+		if over == nil {
+			break
+		}
+		gap := dominantResourceShare(usage[over], capacity) - underShare
+		if gap <= 0 {
+			break
+		}
+		best, bestImprovement := -1, int64(0)
+		for i, wi := range candidates[over] {
+			after := copyQuantities(usage[over])
+			for fName, resUsage := range workloadUsage(wi) {
+				for rName, v := range resUsage {
+					addQuantity(after, fName, rName, -v)
+				}
+			}
+			newGap := dominantResourceShare(after, capacity) - underShare
+			if newGap < 0 {
+				newGap = -newGap
+			}
+			if improvement := gap - newGap; improvement > bestImprovement {
+				best, bestImprovement = i, improvement
+			}
+		}
+		if best < 0 {
+			break
+		}
+		wi := candidates[over][best]
+		for fName, resUsage := range workloadUsage(wi) {
+			for rName, v := range resUsage {
+				addQuantity(usage[over], fName, rName, -v)
+			}
+		}
+		candidates[over] = append(candidates[over][:best], candidates[over][best+1:]...)
+		actions = append(actions, RebalanceAction{
+			ClusterQueue: over.Name,
+			Workload:     workload.Key(wi.Obj),
+			Improvement:  bestImprovement,
+		})
+	}
+	return actions, nil
+}
+
+// minShareMember returns the member with the lowest dominant resource share,
+// breaking ties by name.
+func minShareMember(members []*ClusterQueue, usage map[*ClusterQueue]FlavorResourceQuantities, capacity FlavorResourceQuantities) *ClusterQueue {
+	var lowest *ClusterQueue
+	var lowestShare int64
+	for _, cq := range members {
+		share := dominantResourceShare(usage[cq], capacity)
+		if lowest == nil || share < lowestShare || (share == lowestShare && cq.Name < lowest.Name) {
+			lowest, lowestShare = cq, share
+		}
+	}
+	return lowest
+}
+
+// maxShareMember returns the member, other than the excluded one, with the
+// highest dominant resource share, breaking ties by name.
+func maxShareMember(usage map[*ClusterQueue]FlavorResourceQuantities, capacity FlavorResourceQuantities, exclude *ClusterQueue) *ClusterQueue {
+	var highest *ClusterQueue
+	var highestShare int64
+	for cq, cqUsage := range usage {
+		if cq == exclude {
+			continue
+		}
+		share := dominantResourceShare(cqUsage, capacity)
+		if highest == nil || share > highestShare || (share == highestShare && cq.Name < highest.Name) {
+			highest, highestShare = cq, share
+		}
+	}
+	return highest
+}
+
+// cohortCapacity returns the nominal quota of the active members of the
+// cohort, per flavor and resource.
+func cohortCapacity(cohort *Cohort) FlavorResourceQuantities {
+	capacity := make(FlavorResourceQuantities)
+	for cq := range cohort.Members {
+		if !cq.Active() {
+			continue
+		}
+		for _, rg := range cq.ResourceGroups {
+			for _, flvQuotas := range rg.Flavors {
+				for rName, rQuota := range flvQuotas.Resources {
+					addQuantity(capacity, flvQuotas.Name, rName, rQuota.Nominal)
+				}
+			}
+		}
+	}
+	return capacity
+}
+
+// dominantResourceShare returns the largest fraction of the capacity, in per
+// mille, among the flavors and resources in the usage.
+func dominantResourceShare(usage, capacity FlavorResourceQuantities) int64 {
+	var share int64
+	for fName, resUsage := range usage {
+		for rName, v := range resUsage {
+			c := capacity[fName][rName]
+			if c == 0 || v <= 0 {
+				continue
+			}
+			if s := v * 1000 / c; s > share {
+				share = s
+			}
+		}
+	}
+	return share
+}
+
+func addQuantity(q FlavorResourceQuantities, fName kueue.ResourceFlavorReference, rName corev1.ResourceName, v int64) {
+	if q[fName] == nil {
+		q[fName] = make(map[corev1.ResourceName]int64)
+	}
+	q[fName][rName] += v
+}
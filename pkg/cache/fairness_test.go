@@ -0,0 +1,334 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+)
+
+func TestAdmissionFairnessStats(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("foo").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "10").Obj()).
+			ResourceGroup(
+				*utiltesting.MakeFlavorQuotas("model_a").Resource("example.com/gpu", "5", "5").Obj(),
+				*utiltesting.MakeFlavorQuotas("model_b").Resource("example.com/gpu", "5").Obj(),
+			).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("lender-a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("lender-b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "5").Obj()).
+			Cohort("one").
+			Obj(),
+	}
+	workloads := []*kueue.Workload{
+		utiltesting.MakeWorkload("one", "").
+			Request(corev1.ResourceCPU, "8").
+			Request("example.com/gpu", "5").
+			Admit(utiltesting.MakeAdmission("foo").
+				Assignment(corev1.ResourceCPU, "default", "8000m").
+				Assignment("example.com/gpu", "model_a", "5").
+				Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("two", "").
+			Request(corev1.ResourceCPU, "5").
+			Request("example.com/gpu", "6").
+			Admit(utiltesting.MakeAdmission("foo").
+				Assignment(corev1.ResourceCPU, "default", "5000m").
+				Assignment("example.com/gpu", "model_b", "6").
+				Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("three", "").
+			Request(corev1.ResourceCPU, "4").
+			Admit(utiltesting.MakeAdmission("lender-a").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+			Obj(),
+	}
+
+	cache := New(utiltesting.NewFakeClient())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	for _, wl := range workloads {
+		cache.AddOrUpdateWorkload(wl)
+	}
+
+	got, err := cache.AdmissionFairnessStats("one")
+	if err != nil {
+		t.Fatalf("AdmissionFairnessStats failed: %v", err)
+	}
+	// foo borrows 3 CPUs, lent by lender-a and lender-b in proportion to
+	// their 6 and 5 unused CPUs.
+	want := []MemberShare{
+		{
+			ClusterQueue: "foo",
+			Resources: []ResourceShare{
+				{Flavor: "default", Resource: corev1.ResourceCPU, Nominal: 10_000, Usage: 13_000, Borrowed: 3_000},
+				{Flavor: "model_a", Resource: "example.com/gpu", Nominal: 5, Usage: 5},
+				{Flavor: "model_b", Resource: "example.com/gpu", Nominal: 5, Usage: 6, Borrowed: 1},
+			},
+		},
+		{
+			ClusterQueue: "lender-a",
+			Resources: []ResourceShare{
+				{Flavor: "default", Resource: corev1.ResourceCPU, Nominal: 10_000, Usage: 4_000, Lent: 1_636},
+			},
+		},
+		{
+			ClusterQueue: "lender-b",
+			Resources: []ResourceShare{
+				{Flavor: "default", Resource: corev1.ResourceCPU, Nominal: 5_000, Lent: 1_363},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected shares (-want,+got):\n%s", diff)
+	}
+
+	if _, err := cache.AdmissionFairnessStats("two"); err != errCohortNotFound {
+		t.Errorf("AdmissionFairnessStats for unknown cohort returned error %v, want %v", err, errCohortNotFound)
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+	}
+	admitted := func(name, cq, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Queue(cq+"-lq").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	workloads := []*kueue.Workload{
+		admitted("a1", "a", "4"),
+		admitted("a2", "a", "6"),
+		admitted("a3", "a", "6"),
+		admitted("b1", "b", "2"),
+	}
+
+	cases := map[string]struct {
+		cohort    string
+		pending   []*kueue.Workload
+		want      []RebalanceAction
+		wantError string
+	}{
+		"over-share queue preempted for the queue with pending workloads": {
+			cohort:  "one",
+			pending: []*kueue.Workload{utiltesting.MakeWorkload("b2", "ns").Queue("b-lq").Obj()},
+			want: []RebalanceAction{
+				{ClusterQueue: "a", Workload: "ns/a2", Improvement: 300},
+				{ClusterQueue: "a", Workload: "ns/a3", Improvement: 300},
+			},
+		},
+		"no pending workloads": {
+			cohort: "one",
+		},
+		"pending workloads in the over-share queue": {
+			cohort:  "one",
+			pending: []*kueue.Workload{utiltesting.MakeWorkload("a4", "ns").Queue("a-lq").Obj()},
+		},
+		"unknown cohort": {
+			cohort:    "two",
+			wantError: errCohortNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+				if err := cache.AddLocalQueue(utiltesting.MakeLocalQueue(cq.Name+"-lq", "ns").ClusterQueue(cq.Name).Obj()); err != nil {
+					t.Fatalf("Adding LocalQueue: %v", err)
+				}
+			}
+			for _, wl := range workloads {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", wl.Name)
+				}
+			}
+			for _, wl := range tc.pending {
+				if !cache.AddOrUpdatePendingWorkload(wl) {
+					t.Fatalf("Pending workload %s was not added", wl.Name)
+				}
+			}
+			got, err := cache.Rebalance(tc.cohort)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected actions (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDominantResourceShare(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10").
+				Resource(corev1.ResourceMemory, "30Gi").
+				Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("standalone").Obj(),
+	}
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	wl := utiltesting.MakeWorkload("wl", "ns").
+		Request(corev1.ResourceCPU, "5").
+		Request(corev1.ResourceMemory, "20Gi").
+		Admit(utiltesting.MakeAdmission("a").
+			Assignment(corev1.ResourceCPU, "default", "5").
+			Assignment(corev1.ResourceMemory, "default", "20Gi").
+			Obj()).
+		Obj()
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatal("Failed adding workload")
+	}
+
+	cases := map[string]struct {
+		cq        string
+		want      int64
+		wantError string
+	}{
+		"memory is dominant": {
+			cq:   "a",
+			want: 500,
+		},
+		"no usage": {
+			cq: "b",
+		},
+		"without cohort": {
+			cq: "standalone",
+		},
+		"unknown clusterQueue": {
+			cq:        "nonexistent",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := cache.DominantResourceShare(tc.cq)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if got != tc.want {
+				t.Errorf("DominantResourceShare() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCohortCapacity(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(
+				*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "10").Obj(),
+				*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "5").Obj(),
+			).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("on-demand").
+				Resource(corev1.ResourceCPU, "15", "5").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("inactive").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("missing").Resource(corev1.ResourceCPU, "100").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("standalone").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("on-demand").Obj())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("spot").Obj())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+
+	cases := map[string]struct {
+		cohort    string
+		want      FlavorResourceQuantities
+		wantError string
+	}{
+		"sum of the nominal quotas of the active members": {
+			cohort: "one",
+			want: FlavorResourceQuantities{
+				"on-demand": {corev1.ResourceCPU: 25_000, corev1.ResourceMemory: 10 * utiltesting.Gi},
+				"spot":      {corev1.ResourceCPU: 5_000},
+			},
+		},
+		"unknown cohort": {
+			cohort:    "two",
+			wantError: errCohortNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := cache.CohortCapacity(tc.cohort)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected capacity (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,745 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"math"
+	"math/big"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/util/limitrange"
+	"sigs.k8s.io/kueue/pkg/util/priority"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+// CanFit returns whether the workload, using the flavors assigned in its
+// admission, fits in the ClusterQueue given the current usage of the
+// ClusterQueue and its cohort. The cache is not modified.
+// If the workload is out of the size bounds of the ClusterQueue, it returns
+// an error wrapping ErrWorkloadTooSmall or ErrWorkloadTooLarge.
+// The check is advisory: the scheduler doesn't call it and enforces only a
+// subset of its constraints, see fits.
+func (c *Cache) CanFit(cqName string, wl *workload.Info) (bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return false, errCqNotFound
+	}
+	wl = cq.normalizedInfo(wl)
+	if err := cq.checkWorkloadSize(wl); err != nil {
+		return false, err
+	}
+	return cq.fits(wl), nil
+}
+
+// FitFirst returns the first ClusterQueue, in the given order, in which the
+// workload fits as reported by CanFit. It allows evaluating a list of
+// fallback ClusterQueues when the primary one is full. ClusterQueues whose
+// size bounds reject the workload are skipped. The cache is not modified.
+// It returns an error if any of the ClusterQueues is unknown.
+func (c *Cache) FitFirst(cqNames []string, wl *workload.Info) (string, bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	for _, name := range cqNames {
+		if _, ok := c.clusterQueues[name]; !ok {
+			return "", false, errCqNotFound
+		}
+	}
+	for _, name := range cqNames {
+		cq := c.clusterQueues[name]
+		wi := cq.normalizedInfo(wl)
+		if err := cq.checkWorkloadSize(wi); err != nil {
+			continue
+		}
+		if cq.fits(wi) {
+			return name, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// UsageDelta returns the usage that the workload would add, per flavor and
+// resource, according to the flavors assigned in its admission. The resource
+// aliases and request percentages of the ClusterQueue of the admission are
+// applied if it's known. A workload without admission adds no usage. The
+// cache is not modified.
+func (c *Cache) UsageDelta(wl *workload.Info) FlavorResourceQuantities {
+	if wl.Obj.Status.Admission == nil {
+		return make(FlavorResourceQuantities)
+	}
+	c.RLock()
+	defer c.RUnlock()
+
+	if cq, ok := c.clusterQueues[string(wl.Obj.Status.Admission.ClusterQueue)]; ok {
+		return workloadUsage(cq.newWorkloadInfo(wl.Obj))
+	}
+	return workloadUsage(wl)
+}
+
+// NamespaceUsage returns the usage of the workloads of the namespace admitted
+// in the ClusterQueue, which is bounded by the NamespaceCapsAnnotation.
+func (c *Cache) NamespaceUsage(cqName, namespace string) (FlavorResourceQuantities, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	return cq.namespaceUsage(namespace), nil
+}
+
+// AtConcurrencyLimit returns whether the ClusterQueue has as many admitted
+// workloads, including the assumed ones, as its MaxAdmittedWorkloads, so it
+// can't admit more regardless of its quota.
+func (c *Cache) AtConcurrencyLimit(cqName string) (bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return false, errCqNotFound
+	}
+	return cq.atConcurrencyLimit(), nil
+}
+
+func (c *ClusterQueue) atConcurrencyLimit() bool {
+	return c.MaxAdmittedWorkloads != nil && len(c.Workloads) >= int(*c.MaxAdmittedWorkloads)
+}
+
+// fits returns whether the workload usage can be added to the ClusterQueue
+// without exceeding its nominal quota, its borrowing limits or the unused
+// quota in the cohort.
+//
+// Only the cache calls it, in CanFit, FitFirst, CanAdmit, CanAdmitGang and
+// AssumeWithPreemption, while WorkloadFitsReason and TraceAdmission mirror
+// its checks. The scheduler assigns
+// flavors in the flavorassigner, which only checks the nominal quota, the
+// borrowing limits and the cohort usage of the snapshot. The headroom, usage
+// and namespace caps, MaxAdmittedWorkloads, MinBorrowingPriority, SelfReserve,
+// AdaptiveBorrowing, BorrowScope and the cohort BorrowCeiling are therefore
+// advisory: they don't prevent the scheduler from admitting a workload.
+func (c *ClusterQueue) fits(wl *workload.Info) bool {
+	if !c.Active() || c.atConcurrencyLimit() {
+		return false
+	}
+	canBorrow := c.CanBorrow(priority.Priority(wl.Obj))
+	nsCaps := c.NamespaceCaps[wl.Obj.Namespace]
+	var nsUsage FlavorResourceQuantities
+	if len(nsCaps) > 0 {
+		nsUsage = c.namespaceUsage(wl.Obj.Namespace)
+	}
+	for fName, resUsage := range workloadUsage(wl) {
+		for rName, val := range resUsage {
+			rQuota := c.resourceQuota(fName, rName)
+			if rQuota == nil {
+				return false
+			}
+			if nsCap, found := nsCaps[fName][rName]; found && nsUsage[fName][rName]+val > nsCap {
+				return false
+			}
+			used := c.usedWithHeadroom(fName, rName)
+			ceiling := rQuota.capUsage(rQuota.Nominal)
+			if canBorrow {
+				ceiling = c.borrowingAllowance(fName, rName)
+			}
+			if used+val > ceiling {
+				return false
+			}
+			if c.Cohort != nil && val > c.cohortAvailable(fName, rName) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// FitReasonType identifies why a workload doesn't fit in a ClusterQueue.
+type FitReasonType string
+
+const (
+	// FitClusterQueueInactive means that the ClusterQueue can't admit workloads.
+	FitClusterQueueInactive FitReasonType = "ClusterQueueInactive"
+	// FitFlavorNotCovered means that the ClusterQueue has no quota for the
+	// resource in the assigned flavor.
+	FitFlavorNotCovered FitReasonType = "FlavorNotCovered"
+	// FitNominalExhausted means that the request exceeds the unused nominal
+	// quota and the ClusterQueue can't borrow.
+	FitNominalExhausted FitReasonType = "NominalQuotaExhausted"
+	// FitBorrowingLimitReached means that the request exceeds what the
+	// ClusterQueue can use under its borrowing limit.
+	FitBorrowingLimitReached FitReasonType = "BorrowingLimitReached"
+	// FitCohortExhausted means that the cohort doesn't have enough unused
+	// quota for the request.
+	FitCohortExhausted FitReasonType = "CohortExhausted"
+	// FitUsageCapReached means that the request exceeds the usage cap of the
+	// resource in the flavor.
+	FitUsageCapReached FitReasonType = "UsageCapReached"
+	// FitConcurrencyLimitReached means that the ClusterQueue already has the
+	// maximum number of admitted workloads.
+	FitConcurrencyLimitReached FitReasonType = "ConcurrencyLimitReached"
+	// FitNamespaceCapReached means that the request exceeds the cap of the
+	// resource in the flavor for the namespace of the workload.
+	FitNamespaceCapReached FitReasonType = "NamespaceCapReached"
+)
+
+// FitReason describes the first flavor and resource, in alphabetical order,
+// that prevent a workload from fitting in a ClusterQueue. Flavor and Resource
+// are empty when the ClusterQueue is inactive or at its concurrency limit.
+type FitReason struct {
+	Type     FitReasonType
+	Flavor   kueue.ResourceFlavorReference
+	Resource corev1.ResourceName
+}
+
+// WorkloadFitsReason returns why the workload, using the flavors assigned in
+// its admission, doesn't fit in the ClusterQueue, or nil if it fits. It
+// checks the same conditions as CanFit.
+func (c *Cache) WorkloadFitsReason(cqName string, wl *workload.Info) (*FitReason, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	wl = cq.normalizedInfo(wl)
+	if err := cq.checkWorkloadSize(wl); err != nil {
+		return nil, err
+	}
+	return cq.fitReason(wl), nil
+}
+
+func (c *ClusterQueue) fitReason(wl *workload.Info) *FitReason {
+	if !c.Active() {
+		return &FitReason{Type: FitClusterQueueInactive}
+	}
+	if c.atConcurrencyLimit() {
+		return &FitReason{Type: FitConcurrencyLimitReached}
+	}
+	canBorrow := c.Cohort != nil && c.CanBorrow(priority.Priority(wl.Obj))
+	nsCaps := c.NamespaceCaps[wl.Obj.Namespace]
+	var nsUsage FlavorResourceQuantities
+	if len(nsCaps) > 0 {
+		nsUsage = c.namespaceUsage(wl.Obj.Namespace)
+	}
+	usage := workloadUsage(wl)
+	for _, fName := range sortedKeys(usage) {
+		for _, rName := range sortedKeys(usage[fName]) {
+			reason := &FitReason{Flavor: fName, Resource: rName}
+			val := usage[fName][rName]
+			rQuota := c.resourceQuota(fName, rName)
+			if rQuota == nil {
+				reason.Type = FitFlavorNotCovered
+				return reason
+			}
+			used := c.usedWithHeadroom(fName, rName)
+			if rQuota.UsageCap != nil && used+val > *rQuota.UsageCap {
+				reason.Type = FitUsageCapReached
+				return reason
+			}
+			if nsCap, found := nsCaps[fName][rName]; found && nsUsage[fName][rName]+val > nsCap {
+				reason.Type = FitNamespaceCapReached
+				return reason
+			}
+			if used+val > rQuota.Nominal {
+				if !canBorrow {
+					reason.Type = FitNominalExhausted
+					return reason
+				}
+				if used+val > c.borrowingAllowance(fName, rName) {
+					reason.Type = FitBorrowingLimitReached
+					return reason
+				}
+			}
+			if c.Cohort != nil && val > c.cohortAvailable(fName, rName) {
+				reason.Type = FitCohortExhausted
+				return reason
+			}
+		}
+	}
+	return nil
+}
+
+// CanAdmitGang returns whether all the parts of a gang, keyed by the name of
+// the ClusterQueue they target, fit in their ClusterQueues at the same time.
+// The parts are evaluated in order of ClusterQueue name against a snapshot of
+// the cache, so that parts in the same cohort account for each other's
+// usage. When the gang doesn't fit, the returned map holds the reason for
+// each ClusterQueue that rejects its part.
+func (c *Cache) CanAdmitGang(parts map[string]*kueue.Workload) (bool, map[string]string, error) {
+	snap := c.Snapshot()
+	cqNames := make([]string, 0, len(parts))
+	for cqName := range parts {
+		if _, ok := snap.ClusterQueues[cqName]; !ok && !snap.InactiveClusterQueueSets.Has(cqName) {
+			return false, nil, errCqNotFound
+		}
+		cqNames = append(cqNames, cqName)
+	}
+	sort.Strings(cqNames)
+
+	reasons := make(map[string]string)
+	for _, cqName := range cqNames {
+		cq, ok := snap.ClusterQueues[cqName]
+		if !ok {
+			reasons[cqName] = "ClusterQueue is inactive"
+			continue
+		}
+		wi := cq.newWorkloadInfo(parts[cqName])
+		wi.ClusterQueue = cqName
+		if err := cq.checkWorkloadSize(wi); err != nil {
+			reasons[cqName] = err.Error()
+			continue
+		}
+		if !cq.fits(wi) {
+			reasons[cqName] = "insufficient quota in the ClusterQueue or its cohort"
+			continue
+		}
+		snap.AddWorkload(wi)
+	}
+	if len(reasons) > 0 {
+		return false, reasons, nil
+	}
+	return true, nil, nil
+}
+
+// MaxAdmissiblePods returns how many pods of the PodSet fit in the unused
+// quota of the ClusterQueue, including the quota it can borrow from its
+// cohort, capped at the PodSet count. It also returns how many of those pods
+// would use each flavor. Within a ResourceGroup, the pods are placed in the
+// flavors in order, so that the pods that don't fit in a flavor go to the
+// next one. The resource aliases and quota mode of the ClusterQueue apply to
+// the pod requests.
+func (c *Cache) MaxAdmissiblePods(cqName string, ps *kueue.PodSet) (int32, map[kueue.ResourceFlavorReference]int32, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return 0, nil, errCqNotFound
+	}
+	if !cq.Active() {
+		return 0, nil, nil
+	}
+	podQuantities := limitrange.TotalRequests(&ps.Template.Spec)
+	if cq.quotaMode == QuotaModeLimits {
+		podQuantities = limitrange.TotalLimits(&ps.Template.Spec)
+	}
+	podRequests := make(workload.Requests)
+	for rName, q := range podQuantities {
+		if v := workload.ResourceValue(rName, q); v > 0 {
+			podRequests[rName] = v
+		}
+	}
+	cq.canonicalizeRequests(podRequests)
+
+	for rName := range podRequests {
+		if cq.RGByResource[rName] == nil {
+			return 0, nil, nil
+		}
+	}
+	maxPods := int64(ps.Count)
+	flavorPods := make([][]int64, len(cq.ResourceGroups))
+	for i := range cq.ResourceGroups {
+		rg := &cq.ResourceGroups[i]
+		flavorPods[i] = make([]int64, len(rg.Flavors))
+		var rgPods int64
+		for j, flvQuotas := range rg.Flavors {
+			pods := cq.podsFittingInFlavor(flvQuotas.Name, rg.CoveredResources, podRequests)
+			if pods > maxPods-rgPods {
+				pods = maxPods - rgPods
+			}
+			flavorPods[i][j] = pods
+			rgPods += pods
+		}
+		if rgPods < maxPods {
+			maxPods = rgPods
+		}
+	}
+
+	breakdown := make(map[kueue.ResourceFlavorReference]int32)
+	for i := range cq.ResourceGroups {
+		if !groupUsed(&cq.ResourceGroups[i], podRequests) {
+			continue
+		}
+		remaining := maxPods
+		for j, flvQuotas := range cq.ResourceGroups[i].Flavors {
+			pods := flavorPods[i][j]
+			if pods > remaining {
+				pods = remaining
+			}
+			if pods > 0 {
+				breakdown[flvQuotas.Name] = int32(pods)
+			}
+			remaining -= pods
+		}
+	}
+	return int32(maxPods), breakdown, nil
+}
+
+// groupUsed returns whether the pods request any of the resources covered by
+// the ResourceGroup.
+func groupUsed(rg *ResourceGroup, podRequests workload.Requests) bool {
+	for rName := range podRequests {
+		if rg.CoveredResources.Has(rName) {
+			return true
+		}
+	}
+	return false
+}
+
+// podsFittingInFlavor returns how many pods with the given requests fit in the
+// available quota of the flavor, considering only the resources in the group.
+func (c *ClusterQueue) podsFittingInFlavor(fName kueue.ResourceFlavorReference, resources sets.Set[corev1.ResourceName], podRequests workload.Requests) int64 {
+	pods := int64(math.MaxInt64)
+	for rName, v := range podRequests {
+		if !resources.Has(rName) {
+			continue
+		}
+		if fits := c.available(fName, rName) / v; fits < pods {
+			pods = fits
+		}
+	}
+	return pods
+}
+
+// available returns how much of the resource in the flavor the ClusterQueue
+// can use right now, including what it can borrow from the cohort.
+func (c *ClusterQueue) available(fName kueue.ResourceFlavorReference, rName corev1.ResourceName) int64 {
+	if c.resourceQuota(fName, rName) == nil {
+		return 0
+	}
+	available := c.borrowingAllowance(fName, rName) - c.usedWithHeadroom(fName, rName)
+	if c.Cohort != nil {
+		if cohortAvailable := c.cohortAvailable(fName, rName); cohortAvailable < available {
+			available = cohortAvailable
+		}
+	}
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// borrowingAllowance returns the maximum usage of the resource in the flavor
+// that the ClusterQueue can reach, borrowing from its cohort, bounded by its
+// usage cap. It's math.MaxInt64 if the borrowing is unlimited.
+func (c *ClusterQueue) borrowingAllowance(fName kueue.ResourceFlavorReference, rName corev1.ResourceName) int64 {
+	rQuota := c.resourceQuota(fName, rName)
+	if rQuota == nil {
+		return 0
+	}
+	if c.Cohort == nil {
+		return rQuota.capUsage(rQuota.Nominal)
+	}
+	allowance := int64(math.MaxInt64)
+	if rQuota.BorrowingLimit != nil {
+		allowance = rQuota.Nominal + *rQuota.BorrowingLimit
+	}
+	if c.AdaptiveBorrowing {
+		if shared := rQuota.Nominal + c.borrowingShare(fName, rName); shared < allowance {
+			allowance = shared
+		}
+	}
+	if ceiling, found := c.Cohort.BorrowCeiling[fName][rName]; found {
+		if limit := rQuota.Nominal + ceiling - c.Cohort.borrowedByOthers(c, fName, rName); limit < allowance {
+			allowance = limit
+		}
+	}
+	return rQuota.capUsage(allowance)
+}
+
+// borrowedByOthers returns how much of the resource in the flavor the active
+// members of the cohort, other than the given ClusterQueue, are borrowing.
+func (c *Cohort) borrowedByOthers(cq *ClusterQueue, fName kueue.ResourceFlavorReference, rName corev1.ResourceName) int64 {
+	var borrowed int64
+	for member := range c.Members {
+		if member == cq || !member.Active() {
+			continue
+		}
+		rQuota := member.resourceQuota(fName, rName)
+		if rQuota == nil {
+			continue
+		}
+		if over := member.Usage[fName][rName] - rQuota.Nominal; over > 0 {
+			borrowed += over
+		}
+	}
+	return borrowed
+}
+
+// borrowingShare returns the part of the quota that the other active members
+// of the cohort don't use that the ClusterQueue can borrow, when it's split
+// evenly among the members that can borrow the resource in the flavor.
+func (c *ClusterQueue) borrowingShare(fName kueue.ResourceFlavorReference, rName corev1.ResourceName) int64 {
+	var unused int64
+	borrowers := int64(1)
+	for member := range c.Cohort.Members {
+		if member == c || !member.Active() || member.BorrowScope != c.BorrowScope {
+			continue
+		}
+		rQuota := member.resourceQuota(fName, rName)
+		if rQuota == nil {
+			continue
+		}
+		if free := rQuota.Nominal - member.Usage[fName][rName]; free > 0 {
+			unused += free
+		}
+		if rQuota.BorrowingLimit == nil || *rQuota.BorrowingLimit > 0 {
+			borrowers++
+		}
+	}
+	return unused / borrowers
+}
+
+// cohortAvailable returns the unused quota in the cohort that the ClusterQueue
+// can use, excluding the headroom that other members reserve for themselves.
+// Only the members in the borrow scope of the ClusterQueue are considered.
+func (c *ClusterQueue) cohortAvailable(fName kueue.ResourceFlavorReference, rName corev1.ResourceName) int64 {
+	available := c.Cohort.requestable(fName, rName, c.BorrowScope) - c.Cohort.usage(fName, rName, c.BorrowScope)
+	for member := range c.Cohort.Members {
+		if !member.Active() || member.BorrowScope != c.BorrowScope {
+			continue
+		}
+		available -= member.Headroom[fName][rName]
+		if member != c {
+			available -= member.reservedHeadroom(fName, rName)
+		}
+	}
+	return available
+}
+
+// AvailableToBorrow returns how much more of the resource in the flavor the
+// ClusterQueue can borrow from its cohort right now, bounded by its borrowing
+// limit and by the quota that the other members can lend. It's 0 for a
+// ClusterQueue without a cohort.
+func (c *Cache) AvailableToBorrow(cqName string, flavor string, resource corev1.ResourceName) (int64, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return 0, errCqNotFound
+	}
+	return cq.availableToBorrow(kueue.ResourceFlavorReference(flavor), resource), nil
+}
+
+// availableToBorrow returns how much more of the resource in the flavor the
+// ClusterQueue can borrow from its cohort, bounded by its borrowing limit
+// and by the quota that the other members can lend.
+func (c *ClusterQueue) availableToBorrow(fName kueue.ResourceFlavorReference, rName corev1.ResourceName) int64 {
+	rQuota := c.resourceQuota(fName, rName)
+	if c.Cohort == nil || rQuota == nil {
+		return 0
+	}
+	used := c.usedWithHeadroom(fName, rName)
+	unusedNominal := rQuota.Nominal - used
+	if unusedNominal < 0 {
+		unusedNominal = 0
+	}
+	available := c.cohortAvailable(fName, rName) - unusedNominal
+	borrowingFrom := rQuota.Nominal
+	if used > borrowingFrom {
+		borrowingFrom = used
+	}
+	if left := c.borrowingAllowance(fName, rName) - borrowingFrom; left < available {
+		available = left
+	}
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// CohortLentOut returns, per flavor and resource, how much of the nominal
+// quota of the ClusterQueue is being used by other members of its cohort.
+// The quota borrowed by the cohort is attributed to the lenders in proportion
+// to their unused nominal quota. It's 0 for a ClusterQueue without a cohort.
+func (c *Cache) CohortLentOut(cqName string) (FlavorResourceQuantities, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	lent := make(FlavorResourceQuantities)
+	for _, rg := range cq.ResourceGroups {
+		for _, flvQuotas := range rg.Flavors {
+			for rName := range flvQuotas.Resources {
+				addQuantity(lent, flvQuotas.Name, rName, cq.lentOut(flvQuotas.Name, rName))
+			}
+		}
+	}
+	return lent, nil
+}
+
+// lentOut returns how much of the nominal quota for the resource in the
+// flavor is used by the other members of the cohort.
+func (c *ClusterQueue) lentOut(fName kueue.ResourceFlavorReference, rName corev1.ResourceName) int64 {
+	if c.Cohort == nil {
+		return 0
+	}
+	unused := func(cq *ClusterQueue) int64 {
+		rQuota := cq.resourceQuota(fName, rName)
+		if rQuota == nil {
+			return 0
+		}
+		if v := rQuota.Nominal - cq.Usage[fName][rName]; v > 0 {
+			return v
+		}
+		return 0
+	}
+	ownUnused := unused(c)
+	if ownUnused == 0 {
+		return 0
+	}
+	var borrowed, totalUnused int64
+	for member := range c.Cohort.Members {
+		if !member.Active() {
+			continue
+		}
+		totalUnused += unused(member)
+		var nominal int64
+		if rQuota := member.resourceQuota(fName, rName); rQuota != nil {
+			nominal = rQuota.Nominal
+		}
+		if v := member.Usage[fName][rName] - nominal; v > 0 {
+			borrowed += v
+		}
+	}
+	if borrowed > totalUnused {
+		borrowed = totalUnused
+	}
+	// The product overflows int64 for memory quotas in the order of Gi, but
+	// the result is at most borrowed.
+	share := new(big.Int).Mul(big.NewInt(borrowed), big.NewInt(ownUnused))
+	return share.Quo(share, big.NewInt(totalUnused)).Int64()
+}
+
+// usedWithHeadroom returns the usage of the resource in the flavor, including
+// the headroom kept free for pods not managed by kueue.
+func (c *ClusterQueue) usedWithHeadroom(fName kueue.ResourceFlavorReference, rName corev1.ResourceName) int64 {
+	return c.Usage[fName][rName] + c.Headroom[fName][rName]
+}
+
+// reservedHeadroom returns the part of the quota that the ClusterQueue
+// reserves for itself and that its workloads are not using yet.
+func (c *ClusterQueue) reservedHeadroom(fName kueue.ResourceFlavorReference, rName corev1.ResourceName) int64 {
+	reserve, ok := c.SelfReserve[rName]
+	if !ok {
+		return 0
+	}
+	rQuota := c.resourceQuota(fName, rName)
+	if rQuota == nil {
+		return 0
+	}
+	if reserve > rQuota.Nominal {
+		reserve = rQuota.Nominal
+	}
+	if headroom := reserve - c.Usage[fName][rName]; headroom > 0 {
+		return headroom
+	}
+	return 0
+}
+
+// resourceQuota returns the quota for the resource in the flavor, or nil if
+// the ClusterQueue doesn't define one.
+func (c *ClusterQueue) resourceQuota(fName kueue.ResourceFlavorReference, rName corev1.ResourceName) *ResourceQuota {
+	rg := c.RGByResource[rName]
+	if rg == nil {
+		return nil
+	}
+	for i := range rg.Flavors {
+		if rg.Flavors[i].Name == fName {
+			return rg.Flavors[i].Resources[rName]
+		}
+	}
+	return nil
+}
+
+// requestable returns the nominal quota for the resource in the flavor
+// provided by the active members of the cohort in the borrow scope.
+func (c *Cohort) requestable(fName kueue.ResourceFlavorReference, rName corev1.ResourceName, scope string) int64 {
+	var total int64
+	for cq := range c.Members {
+		if !cq.Active() || cq.BorrowScope != scope {
+			continue
+		}
+		if rQuota := cq.resourceQuota(fName, rName); rQuota != nil {
+			total += rQuota.Nominal
+		}
+	}
+	return total
+}
+
+// usage returns the usage of the resource in the flavor by the members of the
+// cohort in the borrow scope.
+func (c *Cohort) usage(fName kueue.ResourceFlavorReference, rName corev1.ResourceName, scope string) int64 {
+	var total int64
+	for cq := range c.Members {
+		if cq.BorrowScope != scope {
+			continue
+		}
+		total += cq.Usage[fName][rName]
+	}
+	return total
+}
+
+// workloadUsage returns the quota used by the workload, per flavor and
+// resource, according to the flavors assigned to its podsets.
+func workloadUsage(wl *workload.Info) FlavorResourceQuantities {
+	usage := make(FlavorResourceQuantities)
+	for _, ps := range wl.TotalRequests {
+		for rName, fName := range ps.Flavors {
+			v, ok := ps.Requests[rName]
+			if !ok {
+				continue
+			}
+			if usage[fName] == nil {
+				usage[fName] = make(map[corev1.ResourceName]int64)
+			}
+			usage[fName][rName] += v
+		}
+	}
+	return usage
+}
+
+func equalUsage(a, b FlavorResourceQuantities) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for fName, aRes := range a {
+		bRes, ok := b[fName]
+		if !ok || len(aRes) != len(bRes) {
+			return false
+		}
+		for rName, v := range aRes {
+			if bv, ok := bRes[rName]; !ok || bv != v {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,1641 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+func TestCanFit(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("limited").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "5").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("unlimited").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "100").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("standalone").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("priority-limited").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Annotation(MinBorrowingPriorityAnnotation, "100").
+			Obj(),
+		utiltesting.MakeClusterQueue("bounded").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Annotation(MinWorkloadSizeAnnotation, "cpu=2").
+			Annotation(MaxWorkloadSizeAnnotation, "cpu=6").
+			Obj(),
+	}
+	admitted := []*kueue.Workload{
+		utiltesting.MakeWorkload("lender-wl", "").
+			Request(corev1.ResourceCPU, "115").
+			Admit(utiltesting.MakeAdmission("lender").Assignment(corev1.ResourceCPU, "default", "115").Obj()).
+			Obj(),
+	}
+	cases := map[string]struct {
+		cq        string
+		wl        *kueue.Workload
+		admitted  []*kueue.Workload
+		want      bool
+		wantError string
+	}{
+		"fits in nominal quota": {
+			cq: "limited",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Request(corev1.ResourceCPU, "8").
+				Admit(utiltesting.MakeAdmission("limited").Assignment(corev1.ResourceCPU, "default", "8").Obj()).
+				Obj(),
+			want: true,
+		},
+		"fits under the borrowing limit": {
+			cq: "limited",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Request(corev1.ResourceCPU, "14").
+				Admit(utiltesting.MakeAdmission("limited").Assignment(corev1.ResourceCPU, "default", "14").Obj()).
+				Obj(),
+			want: true,
+		},
+		"rejected by the borrowing limit": {
+			cq: "limited",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Request(corev1.ResourceCPU, "16").
+				Admit(utiltesting.MakeAdmission("limited").Assignment(corev1.ResourceCPU, "default", "16").Obj()).
+				Obj(),
+		},
+		"borrows without limit": {
+			cq: "unlimited",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Request(corev1.ResourceCPU, "50").
+				Admit(utiltesting.MakeAdmission("unlimited").Assignment(corev1.ResourceCPU, "default", "50").Obj()).
+				Obj(),
+			want: true,
+		},
+		"rejected by cohort exhaustion": {
+			cq: "unlimited",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Request(corev1.ResourceCPU, "30").
+				Admit(utiltesting.MakeAdmission("unlimited").Assignment(corev1.ResourceCPU, "default", "30").Obj()).
+				Obj(),
+			admitted: admitted,
+		},
+		"without cohort, rejected over nominal": {
+			cq: "standalone",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Request(corev1.ResourceCPU, "11").
+				Admit(utiltesting.MakeAdmission("standalone").Assignment(corev1.ResourceCPU, "default", "11").Obj()).
+				Obj(),
+		},
+		"low priority workload can't borrow": {
+			cq: "priority-limited",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Priority(10).
+				Request(corev1.ResourceCPU, "12").
+				Admit(utiltesting.MakeAdmission("priority-limited").Assignment(corev1.ResourceCPU, "default", "12").Obj()).
+				Obj(),
+		},
+		"high priority workload can borrow": {
+			cq: "priority-limited",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Priority(100).
+				Request(corev1.ResourceCPU, "12").
+				Admit(utiltesting.MakeAdmission("priority-limited").Assignment(corev1.ResourceCPU, "default", "12").Obj()).
+				Obj(),
+			want: true,
+		},
+		"flavor not in the clusterQueue": {
+			cq: "limited",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Request(corev1.ResourceCPU, "1").
+				Admit(utiltesting.MakeAdmission("limited").Assignment(corev1.ResourceCPU, "spot", "1").Obj()).
+				Obj(),
+		},
+		"within the size bounds": {
+			cq: "bounded",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Request(corev1.ResourceCPU, "4").
+				Admit(utiltesting.MakeAdmission("bounded").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+				Obj(),
+			want: true,
+		},
+		"too large for the clusterQueue": {
+			cq: "bounded",
+			wl: utiltesting.MakeWorkload("wl", "").
+				PodSets(*utiltesting.MakePodSet("main", 2).Request(corev1.ResourceCPU, "4").Obj()).
+				Admit(utiltesting.MakeAdmission("bounded").Assignment(corev1.ResourceCPU, "default", "8").AssignmentPodCount(2).Obj()).
+				Obj(),
+			wantError: "workload is larger than the maximum size of the ClusterQueue: requests 8 of cpu, the maximum is 6",
+		},
+		"too small for the clusterQueue": {
+			cq: "bounded",
+			wl: utiltesting.MakeWorkload("wl", "").
+				Request(corev1.ResourceCPU, "500m").
+				Admit(utiltesting.MakeAdmission("bounded").Assignment(corev1.ResourceCPU, "default", "500m").Obj()).
+				Obj(),
+			wantError: "workload is smaller than the minimum size of the ClusterQueue: requests 500m of cpu, the minimum is 2",
+		},
+		"unknown clusterQueue": {
+			cq:        "nonexistent",
+			wl:        utiltesting.MakeWorkload("wl", "").Obj(),
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			for _, wl := range tc.admitted {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", workload.Key(wl))
+				}
+			}
+			got, err := cache.CanFit(tc.cq, workload.NewInfo(tc.wl))
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if got != tc.want {
+				t.Errorf("CanFit() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFitFirst(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("primary").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("fallback").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("bounded").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Annotation(MaxWorkloadSizeAnnotation, "cpu=2").
+			Obj(),
+	}
+	primaryFull := utiltesting.MakeWorkload("primary-wl", "").
+		Request(corev1.ResourceCPU, "8").
+		Admit(utiltesting.MakeAdmission("primary").Assignment(corev1.ResourceCPU, "default", "8").Obj()).
+		Obj()
+	fallbackFull := utiltesting.MakeWorkload("fallback-wl", "").
+		Request(corev1.ResourceCPU, "8").
+		Admit(utiltesting.MakeAdmission("fallback").Assignment(corev1.ResourceCPU, "default", "8").Obj()).
+		Obj()
+	wl := utiltesting.MakeWorkload("wl", "").
+		Request(corev1.ResourceCPU, "4").
+		Admit(utiltesting.MakeAdmission("primary").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+		Obj()
+	cases := map[string]struct {
+		cqs       []string
+		admitted  []*kueue.Workload
+		wantCQ    string
+		wantFits  bool
+		wantError string
+	}{
+		"fits in the primary": {
+			cqs:      []string{"primary", "fallback"},
+			wantCQ:   "primary",
+			wantFits: true,
+		},
+		"primary is full, the fallback admits": {
+			cqs:      []string{"primary", "fallback"},
+			admitted: []*kueue.Workload{primaryFull},
+			wantCQ:   "fallback",
+			wantFits: true,
+		},
+		"all queues are full": {
+			cqs:      []string{"primary", "fallback"},
+			admitted: []*kueue.Workload{primaryFull, fallbackFull},
+		},
+		"queue rejecting the size is skipped": {
+			cqs:      []string{"bounded", "fallback"},
+			wantCQ:   "fallback",
+			wantFits: true,
+		},
+		"no queues": {},
+		"unknown clusterQueue": {
+			cqs:       []string{"primary", "nonexistent"},
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			for _, w := range tc.admitted {
+				if !cache.AddOrUpdateWorkload(w) {
+					t.Fatalf("Workload %s was not added", workload.Key(w))
+				}
+			}
+			gotCQ, gotFits, err := cache.FitFirst(tc.cqs, workload.NewInfo(wl))
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if gotCQ != tc.wantCQ || gotFits != tc.wantFits {
+				t.Errorf("FitFirst() = (%q, %t), want (%q, %t)", gotCQ, gotFits, tc.wantCQ, tc.wantFits)
+			}
+		})
+	}
+}
+
+func TestWorkloadFitsReason(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("limited").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "5").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("unlimited").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "100").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("standalone").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("inactive").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("nonexistent-flavor").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	lenderWl := utiltesting.MakeWorkload("lender-wl", "").
+		Request(corev1.ResourceCPU, "115").
+		Admit(utiltesting.MakeAdmission("lender").Assignment(corev1.ResourceCPU, "default", "115").Obj()).
+		Obj()
+	requesting := func(cq string, flavor kueue.ResourceFlavorReference, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload("wl", "").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, flavor, cpu).Obj()).
+			Obj()
+	}
+	cases := map[string]struct {
+		cq        string
+		wl        *kueue.Workload
+		admitted  []*kueue.Workload
+		want      *FitReason
+		wantError string
+	}{
+		"fits": {
+			cq: "limited",
+			wl: requesting("limited", "default", "14"),
+		},
+		"inactive clusterQueue": {
+			cq:   "inactive",
+			wl:   requesting("inactive", "nonexistent-flavor", "1"),
+			want: &FitReason{Type: FitClusterQueueInactive},
+		},
+		"flavor not covered": {
+			cq:   "limited",
+			wl:   requesting("limited", "spot", "1"),
+			want: &FitReason{Type: FitFlavorNotCovered, Flavor: "spot", Resource: corev1.ResourceCPU},
+		},
+		"nominal quota exhausted": {
+			cq:   "standalone",
+			wl:   requesting("standalone", "default", "11"),
+			want: &FitReason{Type: FitNominalExhausted, Flavor: "default", Resource: corev1.ResourceCPU},
+		},
+		"borrowing limit reached": {
+			cq:   "limited",
+			wl:   requesting("limited", "default", "16"),
+			want: &FitReason{Type: FitBorrowingLimitReached, Flavor: "default", Resource: corev1.ResourceCPU},
+		},
+		"cohort exhausted": {
+			cq:       "unlimited",
+			wl:       requesting("unlimited", "default", "30"),
+			admitted: []*kueue.Workload{lenderWl},
+			want:     &FitReason{Type: FitCohortExhausted, Flavor: "default", Resource: corev1.ResourceCPU},
+		},
+		"unknown clusterQueue": {
+			cq:        "nonexistent",
+			wl:        utiltesting.MakeWorkload("wl", "").Obj(),
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			for _, wl := range tc.admitted {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", workload.Key(wl))
+				}
+			}
+			wi := workload.NewInfo(tc.wl)
+			got, err := cache.WorkloadFitsReason(tc.cq, wi)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected reason (-want,+got):\n%s", diff)
+			}
+			if err == nil {
+				fits, _ := cache.CanFit(tc.cq, wi)
+				if fits != (got == nil) {
+					t.Errorf("CanFit() = %t, inconsistent with reason %v", fits, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBorrowingAllowance(t *testing.T) {
+	cases := map[string]struct {
+		cq   *kueue.ClusterQueue
+		want int64
+	}{
+		"with borrowing limit": {
+			cq: utiltesting.MakeClusterQueue("cq").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "5").Obj()).
+				Cohort("one").
+				Obj(),
+			want: 15_000,
+		},
+		"without borrowing limit": {
+			cq: utiltesting.MakeClusterQueue("cq").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+				Cohort("one").
+				Obj(),
+			want: math.MaxInt64,
+		},
+		"without cohort": {
+			cq: utiltesting.MakeClusterQueue("cq").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "5").Obj()).
+				Obj(),
+			want: 10_000,
+		},
+		"resource not defined": {
+			cq:   utiltesting.MakeClusterQueue("cq").Cohort("one").Obj(),
+			want: 0,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			if err := cache.AddClusterQueue(context.Background(), tc.cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			got := cache.clusterQueues["cq"].borrowingAllowance("default", corev1.ResourceCPU)
+			if got != tc.want {
+				t.Errorf("borrowingAllowance() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveBorrowing(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "0").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "0").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "0").Obj()).
+			Cohort("one").
+			Obj(),
+	}
+	wl := func(name, cq, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	cases := map[string]struct {
+		adaptive bool
+		admitted []*kueue.Workload
+		cq       string
+		wl       *kueue.Workload
+		want     bool
+	}{
+		"static borrows all the unused quota": {
+			cq:   "a",
+			wl:   wl("wl", "a", "10"),
+			want: true,
+		},
+		"adaptive borrows up to half of the unused quota": {
+			adaptive: true,
+			cq:       "a",
+			wl:       wl("wl", "a", "5"),
+			want:     true,
+		},
+		"adaptive rejects more than half of the unused quota": {
+			adaptive: true,
+			cq:       "a",
+			wl:       wl("wl", "a", "6"),
+		},
+		"adaptive leaves half for the other queue": {
+			adaptive: true,
+			admitted: []*kueue.Workload{wl("a-wl", "a", "5")},
+			cq:       "b",
+			wl:       wl("wl", "b", "5"),
+			want:     true,
+		},
+		"adaptive share shrinks with the lender usage": {
+			adaptive: true,
+			admitted: []*kueue.Workload{wl("lender-wl", "lender", "4")},
+			cq:       "a",
+			wl:       wl("wl", "a", "4"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient(), WithAdaptiveBorrowing(tc.adaptive))
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			for _, w := range tc.admitted {
+				if !cache.AddOrUpdateWorkload(w) {
+					t.Fatalf("Workload %s was not added", w.Name)
+				}
+			}
+			got, err := cache.CanFit(tc.cq, workload.NewInfo(tc.wl))
+			if err != nil {
+				t.Fatalf("CanFit failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("CanFit() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAvailableToBorrow(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("limited").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "5").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("unlimited").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "20").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("standalone").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	admitted := func(cq, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(cq+"-wl", "").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	cases := map[string]struct {
+		cq        string
+		flavor    string
+		admitted  []*kueue.Workload
+		want      int64
+		wantError string
+	}{
+		"bounded by the borrowing limit": {
+			cq:     "limited",
+			flavor: "default",
+			want:   5_000,
+		},
+		"bounded by the remaining borrowing limit": {
+			cq:       "limited",
+			flavor:   "default",
+			admitted: []*kueue.Workload{admitted("limited", "13")},
+			want:     2_000,
+		},
+		"bounded by the quota lendable by the cohort": {
+			cq:     "unlimited",
+			flavor: "default",
+			want:   30_000,
+		},
+		"unused nominal quota is not borrowed": {
+			cq:       "unlimited",
+			flavor:   "default",
+			admitted: []*kueue.Workload{admitted("lender", "18"), admitted("limited", "15")},
+			want:     0,
+		},
+		"bounded by the cohort usage": {
+			cq:       "unlimited",
+			flavor:   "default",
+			admitted: []*kueue.Workload{admitted("lender", "15"), admitted("limited", "12"), admitted("unlimited", "10")},
+			want:     3_000,
+		},
+		"without cohort": {
+			cq:     "standalone",
+			flavor: "default",
+			want:   0,
+		},
+		"flavor without quota": {
+			cq:     "unlimited",
+			flavor: "spot",
+			want:   0,
+		},
+		"unknown clusterQueue": {
+			cq:        "nonexistent",
+			flavor:    "default",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			for _, wl := range tc.admitted {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", wl.Name)
+				}
+			}
+			got, err := cache.AvailableToBorrow(tc.cq, tc.flavor, corev1.ResourceCPU)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if got != tc.want {
+				t.Errorf("AvailableToBorrow() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCohortBorrowCeiling(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "30").Obj()).
+			Cohort("one").
+			Obj(),
+	}
+	wl := func(name, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	admitted := func(cq, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(cq+"-wl", "").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	ceiling := FlavorResourceQuantities{"default": {corev1.ResourceCPU: 8_000}}
+	cases := map[string]struct {
+		ceiling          FlavorResourceQuantities
+		setBeforeCohort  bool
+		admitted         []*kueue.Workload
+		wantAvailable    int64
+		wantFits         *kueue.Workload
+		wantDoesntFit    *kueue.Workload
+		wantRejectReason FitReasonType
+	}{
+		"without ceiling": {
+			wantAvailable: 40_000,
+			wantFits:      wl("fits", "50"),
+			wantDoesntFit: wl("too-big", "51"),
+		},
+		"ceiling without other borrowers": {
+			ceiling:          ceiling,
+			wantAvailable:    8_000,
+			wantFits:         wl("fits", "18"),
+			wantDoesntFit:    wl("too-big", "19"),
+			wantRejectReason: FitBorrowingLimitReached,
+		},
+		"ceiling set before the cohort exists": {
+			ceiling:          ceiling,
+			setBeforeCohort:  true,
+			wantAvailable:    8_000,
+			wantFits:         wl("fits", "18"),
+			wantDoesntFit:    wl("too-big", "19"),
+			wantRejectReason: FitBorrowingLimitReached,
+		},
+		"combined borrowing capped by the ceiling": {
+			ceiling:          ceiling,
+			admitted:         []*kueue.Workload{admitted("b", "15")},
+			wantAvailable:    3_000,
+			wantFits:         wl("fits", "13"),
+			wantDoesntFit:    wl("too-big", "14"),
+			wantRejectReason: FitBorrowingLimitReached,
+		},
+		"ceiling used up by another member": {
+			ceiling:          ceiling,
+			admitted:         []*kueue.Workload{admitted("b", "18")},
+			wantAvailable:    0,
+			wantFits:         wl("fits", "10"),
+			wantDoesntFit:    wl("too-big", "11"),
+			wantRejectReason: FitBorrowingLimitReached,
+		},
+		"own borrowing counts towards the ceiling": {
+			ceiling:          ceiling,
+			admitted:         []*kueue.Workload{admitted("a", "15"), admitted("b", "12")},
+			wantAvailable:    1_000,
+			wantFits:         wl("fits", "1"),
+			wantDoesntFit:    wl("too-big", "2"),
+			wantRejectReason: FitBorrowingLimitReached,
+		},
+		"ceiling on another resource": {
+			ceiling:       FlavorResourceQuantities{"default": {corev1.ResourceMemory: 0}},
+			admitted:      []*kueue.Workload{admitted("b", "15")},
+			wantAvailable: 25_000,
+			wantFits:      wl("fits", "35"),
+			wantDoesntFit: wl("too-big", "36"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			if tc.setBeforeCohort {
+				cache.SetCohortBorrowCeiling("one", tc.ceiling)
+			}
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			if !tc.setBeforeCohort {
+				cache.SetCohortBorrowCeiling("one", tc.ceiling)
+			}
+			for _, wl := range tc.admitted {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", wl.Name)
+				}
+			}
+			got, err := cache.AvailableToBorrow("a", "default", corev1.ResourceCPU)
+			if err != nil {
+				t.Fatalf("AvailableToBorrow(): %v", err)
+			}
+			if got != tc.wantAvailable {
+				t.Errorf("AvailableToBorrow() = %d, want %d", got, tc.wantAvailable)
+			}
+			if fits, err := cache.CanFit("a", workload.NewInfo(tc.wantFits)); err != nil || !fits {
+				t.Errorf("CanFit(%s) = %t, %v, want true", tc.wantFits.Name, fits, err)
+			}
+			if fits, err := cache.CanFit("a", workload.NewInfo(tc.wantDoesntFit)); err != nil || fits {
+				t.Errorf("CanFit(%s) = %t, %v, want false", tc.wantDoesntFit.Name, fits, err)
+			}
+			if tc.wantRejectReason != "" {
+				reason := cache.clusterQueues["a"].fitReason(workload.NewInfo(tc.wantDoesntFit))
+				if reason == nil || reason.Type != tc.wantRejectReason {
+					t.Errorf("fitReason(%s) = %v, want %s", tc.wantDoesntFit.Name, reason, tc.wantRejectReason)
+				}
+			}
+			snap := cache.Snapshot()
+			if got := snap.ClusterQueues["a"].availableToBorrow("default", corev1.ResourceCPU); got != tc.wantAvailable {
+				t.Errorf("availableToBorrow() in snapshot = %d, want %d", got, tc.wantAvailable)
+			}
+		})
+	}
+}
+
+func TestCohortLentOut(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("small-lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "4").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("borrower").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "2").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("standalone").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	admitted := func(cq, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(cq+"-wl", "").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	cases := map[string]struct {
+		cq        string
+		admitted  []*kueue.Workload
+		want      FlavorResourceQuantities
+		wantError string
+	}{
+		"nothing borrowed": {
+			cq:   "lender",
+			want: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 0}},
+		},
+		"lent out in proportion to the unused quota": {
+			cq:       "lender",
+			admitted: []*kueue.Workload{admitted("lender", "2"), admitted("small-lender", "2"), admitted("borrower", "7")},
+			want:     FlavorResourceQuantities{"default": {corev1.ResourceCPU: 4_000}},
+		},
+		"smaller lender": {
+			cq:       "small-lender",
+			admitted: []*kueue.Workload{admitted("lender", "2"), admitted("small-lender", "2"), admitted("borrower", "7")},
+			want:     FlavorResourceQuantities{"default": {corev1.ResourceCPU: 1_000}},
+		},
+		"borrower doesn't lend": {
+			cq:       "borrower",
+			admitted: []*kueue.Workload{admitted("lender", "2"), admitted("small-lender", "2"), admitted("borrower", "7")},
+			want:     FlavorResourceQuantities{"default": {corev1.ResourceCPU: 0}},
+		},
+		"all the unused quota is lent out": {
+			cq:       "lender",
+			admitted: []*kueue.Workload{admitted("lender", "4"), admitted("small-lender", "4"), admitted("borrower", "8")},
+			want:     FlavorResourceQuantities{"default": {corev1.ResourceCPU: 6_000}},
+		},
+		"without cohort": {
+			cq:       "standalone",
+			admitted: []*kueue.Workload{admitted("standalone", "2")},
+			want:     FlavorResourceQuantities{"default": {corev1.ResourceCPU: 0}},
+		},
+		"unknown clusterQueue": {
+			cq:        "nonexistent",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			for _, wl := range tc.admitted {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", wl.Name)
+				}
+			}
+			got, err := cache.CohortLentOut(tc.cq)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected lent out quota (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCohortLentOutLargeQuotas(t *testing.T) {
+	member := func(name, memory string) *kueue.ClusterQueue {
+		return utiltesting.MakeClusterQueue(name).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceMemory, memory).Obj()).
+			Cohort("one").
+			Obj()
+	}
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	for _, cq := range []*kueue.ClusterQueue{member("lender", "200Gi"), member("other-lender", "200Gi"), member("borrower", "100Gi")} {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	wl := utiltesting.MakeWorkload("borrower-wl", "").
+		Request(corev1.ResourceMemory, "300Gi").
+		Admit(utiltesting.MakeAdmission("borrower").Assignment(corev1.ResourceMemory, "default", "300Gi").Obj()).
+		Obj()
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatalf("Workload %s was not added", wl.Name)
+	}
+	// The borrowed 200Gi are lent in halves by the lenders.
+	got, err := cache.CohortLentOut("lender")
+	if err != nil {
+		t.Fatalf("CohortLentOut(): %v", err)
+	}
+	want := FlavorResourceQuantities{"default": {corev1.ResourceMemory: 100 * utiltesting.Gi}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected lent out quota (-want,+got):\n%s", diff)
+	}
+}
+
+func TestCohortBorrowScope(t *testing.T) {
+	member := func(name, region, nominal string) *kueue.ClusterQueue {
+		return utiltesting.MakeClusterQueue(name).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, nominal).Obj()).
+			Cohort("one").
+			Label("region", region).
+			Obj()
+	}
+	clusterQueues := []*kueue.ClusterQueue{
+		member("borrower", "east", "0"),
+		member("east-lender", "east", "10"),
+		member("west-lender", "west", "20"),
+	}
+	wl := func(cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload("wl", "").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission("borrower").Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	cases := map[string]struct {
+		opts             []Option
+		wantAvailable    int64
+		wantFitsInRegion bool
+		wantFitsAcross   bool
+	}{
+		"without scope": {
+			wantAvailable:    30_000,
+			wantFitsInRegion: true,
+			wantFitsAcross:   true,
+		},
+		"scoped to the region": {
+			opts:             []Option{WithCohortBorrowScope("region")},
+			wantAvailable:    10_000,
+			wantFitsInRegion: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient(), tc.opts...)
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			available, err := cache.AvailableToBorrow("borrower", "default", corev1.ResourceCPU)
+			if err != nil {
+				t.Fatalf("AvailableToBorrow failed: %v", err)
+			}
+			if available != tc.wantAvailable {
+				t.Errorf("AvailableToBorrow() = %d, want %d", available, tc.wantAvailable)
+			}
+			fits, err := cache.CanFit("borrower", workload.NewInfo(wl("10")))
+			if err != nil {
+				t.Fatalf("CanFit failed: %v", err)
+			}
+			if fits != tc.wantFitsInRegion {
+				t.Errorf("CanFit() with the quota of the region = %t, want %t", fits, tc.wantFitsInRegion)
+			}
+			fits, err = cache.CanFit("borrower", workload.NewInfo(wl("25")))
+			if err != nil {
+				t.Fatalf("CanFit failed: %v", err)
+			}
+			if fits != tc.wantFitsAcross {
+				t.Errorf("CanFit() with the quota of both regions = %t, want %t", fits, tc.wantFitsAcross)
+			}
+		})
+	}
+}
+
+func TestSelfReserve(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("borrower").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "5").Obj()).
+			Cohort("one").
+			Obj(),
+	}
+	borrowerWl := utiltesting.MakeWorkload("wl", "").
+		Request(corev1.ResourceCPU, "12").
+		Admit(utiltesting.MakeAdmission("borrower").Assignment(corev1.ResourceCPU, "default", "12").Obj()).
+		Obj()
+	cases := map[string]struct {
+		reserve             map[corev1.ResourceName]int64
+		lenderUsage         string
+		wantAvailableBorrow int64
+		wantFit             bool
+	}{
+		"no reserve": {
+			wantAvailableBorrow: 10_000,
+			wantFit:             true,
+		},
+		"reserve part of the nominal quota": {
+			reserve:             map[corev1.ResourceName]int64{corev1.ResourceCPU: 4_000},
+			wantAvailableBorrow: 6_000,
+		},
+		"reserve partially used by the lender": {
+			reserve:             map[corev1.ResourceName]int64{corev1.ResourceCPU: 4_000},
+			lenderUsage:         "2",
+			wantAvailableBorrow: 6_000,
+		},
+		"lender usage beyond the reserve": {
+			reserve:             map[corev1.ResourceName]int64{corev1.ResourceCPU: 4_000},
+			lenderUsage:         "6",
+			wantAvailableBorrow: 4_000,
+		},
+		"reserve bigger than the nominal quota": {
+			reserve:             map[corev1.ResourceName]int64{corev1.ResourceCPU: 20_000},
+			wantAvailableBorrow: 0,
+		},
+		"reserve for another resource": {
+			reserve:             map[corev1.ResourceName]int64{corev1.ResourceMemory: 4_000},
+			wantAvailableBorrow: 10_000,
+			wantFit:             true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			if err := cache.SetSelfReserve("lender", tc.reserve); err != nil {
+				t.Fatalf("Setting self reserve: %v", err)
+			}
+			if tc.lenderUsage != "" {
+				wl := utiltesting.MakeWorkload("lender-wl", "").
+					Request(corev1.ResourceCPU, tc.lenderUsage).
+					Admit(utiltesting.MakeAdmission("lender").Assignment(corev1.ResourceCPU, "default", tc.lenderUsage).Obj()).
+					Obj()
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", workload.Key(wl))
+				}
+			}
+			got := cache.clusterQueues["borrower"].availableToBorrow("default", corev1.ResourceCPU)
+			if got != tc.wantAvailableBorrow {
+				t.Errorf("availableToBorrow() = %d, want %d", got, tc.wantAvailableBorrow)
+			}
+			if tc.lenderUsage == "" {
+				fit, err := cache.CanFit("borrower", workload.NewInfo(borrowerWl))
+				if err != nil {
+					t.Fatalf("CanFit: %v", err)
+				}
+				if fit != tc.wantFit {
+					t.Errorf("CanFit() = %t, want %t", fit, tc.wantFit)
+				}
+			}
+		})
+	}
+}
+
+func TestHeadroom(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("borrower").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("standalone").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	wl := func(cq, cpu string) *workload.Info {
+		return workload.NewInfo(utiltesting.MakeWorkload("wl", "").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj())
+	}
+	type setting struct {
+		cq     string
+		amount int64
+	}
+	cases := map[string]struct {
+		headroom        []setting
+		cq              string
+		wl              *workload.Info
+		wantFit         bool
+		wantToBorrow    int64
+		wantSetErrorMsg string
+	}{
+		"no headroom": {
+			cq:           "borrower",
+			wl:           wl("borrower", "20"),
+			wantFit:      true,
+			wantToBorrow: 10_000,
+		},
+		"headroom of the lender isn't lent": {
+			headroom:     []setting{{"lender", 4_000}},
+			cq:           "borrower",
+			wl:           wl("borrower", "16"),
+			wantFit:      true,
+			wantToBorrow: 6_000,
+		},
+		"headroom of the lender reduces the admissible size": {
+			headroom:     []setting{{"lender", 4_000}},
+			cq:           "borrower",
+			wl:           wl("borrower", "17"),
+			wantToBorrow: 6_000,
+		},
+		"own headroom reduces the admissible size": {
+			headroom:     []setting{{"borrower", 3_000}},
+			cq:           "borrower",
+			wl:           wl("borrower", "18"),
+			wantToBorrow: 10_000,
+		},
+		"without cohort, fits beside the headroom": {
+			headroom: []setting{{"standalone", 3_000}},
+			cq:       "standalone",
+			wl:       wl("standalone", "7"),
+			wantFit:  true,
+		},
+		"without cohort, doesn't fit beside the headroom": {
+			headroom: []setting{{"standalone", 3_000}},
+			cq:       "standalone",
+			wl:       wl("standalone", "8"),
+		},
+		"headroom removed": {
+			headroom:     []setting{{"lender", 4_000}, {"lender", 0}},
+			cq:           "borrower",
+			wl:           wl("borrower", "20"),
+			wantFit:      true,
+			wantToBorrow: 10_000,
+		},
+		"unknown clusterQueue": {
+			headroom:        []setting{{"nonexistent", 1_000}},
+			cq:              "borrower",
+			wl:              wl("borrower", "20"),
+			wantFit:         true,
+			wantToBorrow:    10_000,
+			wantSetErrorMsg: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			for _, h := range tc.headroom {
+				err := cache.SetHeadroom(h.cq, "default", corev1.ResourceCPU, h.amount)
+				if diff := cmp.Diff(tc.wantSetErrorMsg, messageOrEmpty(err)); diff != "" {
+					t.Errorf("Unexpected error setting the headroom (-want,+got):\n%s", diff)
+				}
+			}
+			gotFit, err := cache.CanFit(tc.cq, tc.wl)
+			if err != nil {
+				t.Fatalf("CanFit() failed: %v", err)
+			}
+			if gotFit != tc.wantFit {
+				t.Errorf("CanFit() = %t, want %t", gotFit, tc.wantFit)
+			}
+			gotToBorrow, err := cache.AvailableToBorrow(tc.cq, "default", corev1.ResourceCPU)
+			if err != nil {
+				t.Fatalf("AvailableToBorrow() failed: %v", err)
+			}
+			if gotToBorrow != tc.wantToBorrow {
+				t.Errorf("AvailableToBorrow() = %d, want %d", gotToBorrow, tc.wantToBorrow)
+			}
+		})
+	}
+}
+
+func TestUsageCap(t *testing.T) {
+	lender := utiltesting.MakeClusterQueue("lender").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "20").Obj()).
+		Cohort("one").
+		Obj()
+	wl := func(cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload("wl", "").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission("borrower").Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	cases := map[string]struct {
+		usageCaps           string
+		cohort              string
+		wl                  *kueue.Workload
+		wantFit             bool
+		wantReason          *FitReason
+		wantAvailableBorrow int64
+		wantError           string
+	}{
+		"borrowing without a cap": {
+			cohort:              "one",
+			wl:                  wl("14"),
+			wantFit:             true,
+			wantAvailableBorrow: 20_000,
+		},
+		"cap blocks a workload fitting by borrowing": {
+			usageCaps: "default:cpu=12",
+			cohort:    "one",
+			wl:        wl("14"),
+			wantReason: &FitReason{
+				Type:     FitUsageCapReached,
+				Flavor:   "default",
+				Resource: corev1.ResourceCPU,
+			},
+			wantAvailableBorrow: 2_000,
+		},
+		"borrowing up to the cap": {
+			usageCaps:           "default:cpu=12",
+			cohort:              "one",
+			wl:                  wl("12"),
+			wantFit:             true,
+			wantAvailableBorrow: 2_000,
+		},
+		"cap under the nominal quota": {
+			usageCaps: "default:cpu=6",
+			wl:        wl("8"),
+			wantReason: &FitReason{
+				Type:     FitUsageCapReached,
+				Flavor:   "default",
+				Resource: corev1.ResourceCPU,
+			},
+		},
+		"cap for another flavor": {
+			usageCaps:           "spot:cpu=1",
+			cohort:              "one",
+			wl:                  wl("14"),
+			wantFit:             true,
+			wantAvailableBorrow: 20_000,
+		},
+		"invalid annotation": {
+			usageCaps: "cpu=12",
+			wantError: `parsing annotation kueue.x-k8s.io/usage-caps: invalid entry "cpu=12"`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			if err := cache.AddClusterQueue(context.Background(), lender); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			borrower := utiltesting.MakeClusterQueue("borrower").
+				ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+				Cohort(tc.cohort).
+				Annotation(UsageCapsAnnotation, tc.usageCaps).
+				Obj()
+			err := cache.AddClusterQueue(context.Background(), borrower)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Fatalf("Unexpected error adding the ClusterQueue (-want,+got):\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+			wi := workload.NewInfo(tc.wl)
+			fits, err := cache.CanFit("borrower", wi)
+			if err != nil {
+				t.Fatalf("CanFit failed: %v", err)
+			}
+			if fits != tc.wantFit {
+				t.Errorf("CanFit() = %t, want %t", fits, tc.wantFit)
+			}
+			reason, err := cache.WorkloadFitsReason("borrower", wi)
+			if err != nil {
+				t.Fatalf("WorkloadFitsReason failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantReason, reason); diff != "" {
+				t.Errorf("Unexpected reason (-want,+got):\n%s", diff)
+			}
+			available, err := cache.AvailableToBorrow("borrower", "default", corev1.ResourceCPU)
+			if err != nil {
+				t.Fatalf("AvailableToBorrow failed: %v", err)
+			}
+			if available != tc.wantAvailableBorrow {
+				t.Errorf("AvailableToBorrow() = %d, want %d", available, tc.wantAvailableBorrow)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Annotation(MaxAdmittedWorkloadsAnnotation, "2").
+		Obj()
+	wl := func(name string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Request(corev1.ResourceCPU, "1").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+			Obj()
+	}
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	check := func(wantLimit bool) {
+		t.Helper()
+		atLimit, err := cache.AtConcurrencyLimit("foo")
+		if err != nil {
+			t.Fatalf("AtConcurrencyLimit failed: %v", err)
+		}
+		if atLimit != wantLimit {
+			t.Errorf("AtConcurrencyLimit() = %t, want %t", atLimit, wantLimit)
+		}
+		fits, err := cache.CanFit("foo", workload.NewInfo(wl("third")))
+		if err != nil {
+			t.Fatalf("CanFit failed: %v", err)
+		}
+		if fits == wantLimit {
+			t.Errorf("CanFit() = %t, want %t", fits, !wantLimit)
+		}
+	}
+
+	first := wl("first")
+	if !cache.AddOrUpdateWorkload(first) {
+		t.Fatal("Workload first was not added")
+	}
+	check(false)
+	if err := cache.AssumeWorkload(wl("second")); err != nil {
+		t.Fatalf("Assuming workload second: %v", err)
+	}
+	check(true)
+
+	reason, err := cache.WorkloadFitsReason("foo", workload.NewInfo(wl("third")))
+	if err != nil {
+		t.Fatalf("WorkloadFitsReason failed: %v", err)
+	}
+	if diff := cmp.Diff(&FitReason{Type: FitConcurrencyLimitReached}, reason); diff != "" {
+		t.Errorf("Unexpected reason (-want,+got):\n%s", diff)
+	}
+	err = cache.AssumeWorkload(wl("third"))
+	if diff := cmp.Diff(errConcurrencyLimitReached.Error(), messageOrEmpty(err)); diff != "" {
+		t.Errorf("Unexpected error assuming workload third (-want,+got):\n%s", diff)
+	}
+	if used := cache.clusterQueues["foo"].Usage["default"][corev1.ResourceCPU]; used != 2_000 {
+		t.Errorf("Got usage %d, want 2000", used)
+	}
+
+	if err := cache.DeleteWorkload(first); err != nil {
+		t.Fatalf("Deleting workload first: %v", err)
+	}
+	check(false)
+
+	if _, err := cache.AtConcurrencyLimit("bar"); !errors.Is(err, errCqNotFound) {
+		t.Errorf("AtConcurrencyLimit() for an unknown ClusterQueue returned %v, want %v", err, errCqNotFound)
+	}
+}
+
+func TestNamespaceCaps(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Annotation(NamespaceCapsAnnotation, "team-a/default:cpu=4").
+		Obj()
+	wl := func(name, ns, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, ns).
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	for _, w := range []*kueue.Workload{wl("a1", "team-a", "3"), wl("b1", "team-b", "3")} {
+		if !cache.AddOrUpdateWorkload(w) {
+			t.Fatalf("Workload %s was not added", w.Name)
+		}
+	}
+
+	for ns, want := range map[string]FlavorResourceQuantities{
+		"team-a": {"default": {corev1.ResourceCPU: 3_000}},
+		"team-b": {"default": {corev1.ResourceCPU: 3_000}},
+		"team-c": {},
+	} {
+		got, err := cache.NamespaceUsage("foo", ns)
+		if err != nil {
+			t.Fatalf("NamespaceUsage failed: %v", err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Unexpected usage of namespace %s (-want,+got):\n%s", ns, diff)
+		}
+	}
+
+	cases := map[string]struct {
+		wl         *kueue.Workload
+		wantReason *FitReason
+	}{
+		"within the cap of the namespace": {
+			wl: wl("a2", "team-a", "1"),
+		},
+		"over the cap of the namespace": {
+			wl:         wl("a2", "team-a", "2"),
+			wantReason: &FitReason{Type: FitNamespaceCapReached, Flavor: "default", Resource: corev1.ResourceCPU},
+		},
+		"namespace without a cap": {
+			wl: wl("b2", "team-b", "4"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			wi := workload.NewInfo(tc.wl)
+			fits, err := cache.CanFit("foo", wi)
+			if err != nil {
+				t.Fatalf("CanFit failed: %v", err)
+			}
+			if want := tc.wantReason == nil; fits != want {
+				t.Errorf("CanFit() = %t, want %t", fits, want)
+			}
+			reason, err := cache.WorkloadFitsReason("foo", wi)
+			if err != nil {
+				t.Fatalf("WorkloadFitsReason failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantReason, reason); diff != "" {
+				t.Errorf("Unexpected reason (-want,+got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := cache.NamespaceUsage("bar", "team-a"); !errors.Is(err, errCqNotFound) {
+		t.Errorf("NamespaceUsage() for an unknown ClusterQueue returned %v, want %v", err, errCqNotFound)
+	}
+}
+
+func TestCanAdmitGang(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("model_a").Resource("example.com/gpu", "4").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("inactive").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("nonexistent-flavor").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	part := func(cq, flavor, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload("gang-"+cq, "ns").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, kueue.ResourceFlavorReference(flavor), cpu).Obj()).
+			Obj()
+	}
+	gpuPart := func(cq, gpus string) *kueue.Workload {
+		return utiltesting.MakeWorkload("gang-"+cq, "ns").
+			Request("nvidia.com/gpu", gpus).
+			Admit(utiltesting.MakeAdmission(cq).Assignment("nvidia.com/gpu", "model_a", gpus).Obj()).
+			Obj()
+	}
+	cases := map[string]struct {
+		parts       map[string]*kueue.Workload
+		want        bool
+		wantReasons map[string]string
+		wantError   string
+	}{
+		"all parts fit": {
+			parts: map[string]*kueue.Workload{
+				"a": part("a", "default", "4"),
+				"b": part("b", "default", "4"),
+			},
+			want: true,
+		},
+		"one part overflows": {
+			parts: map[string]*kueue.Workload{
+				"a": part("a", "default", "4"),
+				"b": part("b", "default", "25"),
+			},
+			wantReasons: map[string]string{
+				"b": "insufficient quota in the ClusterQueue or its cohort",
+			},
+		},
+		"parts fit alone but not together in the cohort": {
+			parts: map[string]*kueue.Workload{
+				"a": part("a", "default", "12"),
+				"b": part("b", "default", "9"),
+			},
+			wantReasons: map[string]string{
+				"b": "insufficient quota in the ClusterQueue or its cohort",
+			},
+		},
+		"part using a resource alias": {
+			parts: map[string]*kueue.Workload{
+				"a": gpuPart("a", "3"),
+				"b": part("b", "default", "4"),
+			},
+			want: true,
+		},
+		"part using a resource alias overflows": {
+			parts: map[string]*kueue.Workload{
+				"a": gpuPart("a", "5"),
+				"b": part("b", "default", "4"),
+			},
+			wantReasons: map[string]string{
+				"a": "insufficient quota in the ClusterQueue or its cohort",
+			},
+		},
+		"inactive clusterQueue": {
+			parts: map[string]*kueue.Workload{
+				"a":        part("a", "default", "4"),
+				"inactive": part("inactive", "nonexistent-flavor", "4"),
+			},
+			wantReasons: map[string]string{
+				"inactive": "ClusterQueue is inactive",
+			},
+		},
+		"unknown clusterQueue": {
+			parts: map[string]*kueue.Workload{
+				"a":   part("a", "default", "4"),
+				"foo": part("foo", "default", "4"),
+			},
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient(), WithResourceAliases(map[corev1.ResourceName]corev1.ResourceName{
+				"nvidia.com/gpu": "example.com/gpu",
+			}))
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("model_a").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			got, gotReasons, err := cache.CanAdmitGang(tc.parts)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if got != tc.want {
+				t.Errorf("CanAdmitGang() = %t, want %t", got, tc.want)
+			}
+			if diff := cmp.Diff(tc.wantReasons, gotReasons); diff != "" {
+				t.Errorf("Unexpected reasons (-want,+got):\n%s", diff)
+			}
+			for cqName := range tc.parts {
+				if !cache.ClusterQueueEmpty(cqName) {
+					t.Errorf("ClusterQueue %s was modified", cqName)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxAdmissiblePods(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("foo").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "4").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("borrower").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "4", "2").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("lender").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("gpu").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10").
+				Obj()).
+			ResourceGroup(
+				*utiltesting.MakeFlavorQuotas("model_a").Resource("example.com/gpu", "6").Obj(),
+				*utiltesting.MakeFlavorQuotas("model_b").Resource("example.com/gpu", "4").Obj(),
+			).
+			Obj(),
+	}
+	cases := map[string]struct {
+		cq            string
+		ps            *kueue.PodSet
+		want          int32
+		wantBreakdown map[kueue.ResourceFlavorReference]int32
+		wantError     string
+	}{
+		"only 4 pods fit by cpu": {
+			cq: "foo",
+			ps: utiltesting.MakePodSet("workers", 10).
+				Request(corev1.ResourceCPU, "1").
+				Request(corev1.ResourceMemory, "1Gi").
+				Obj(),
+			want:          4,
+			wantBreakdown: map[kueue.ResourceFlavorReference]int32{"default": 4},
+		},
+		"all pods fit": {
+			cq: "foo",
+			ps: utiltesting.MakePodSet("workers", 3).
+				Request(corev1.ResourceCPU, "1").
+				Obj(),
+			want:          3,
+			wantBreakdown: map[kueue.ResourceFlavorReference]int32{"default": 3},
+		},
+		"including the quota that can be borrowed": {
+			cq: "borrower",
+			ps: utiltesting.MakePodSet("workers", 10).
+				Request(corev1.ResourceCPU, "1").
+				Obj(),
+			want:          6,
+			wantBreakdown: map[kueue.ResourceFlavorReference]int32{"default": 6},
+		},
+		"pods spanning the gpu flavors": {
+			cq: "gpu",
+			ps: utiltesting.MakePodSet("workers", 10).
+				Request(corev1.ResourceCPU, "1").
+				Request("example.com/gpu", "2").
+				Obj(),
+			want:          5,
+			wantBreakdown: map[kueue.ResourceFlavorReference]int32{"default": 5, "model_a": 3, "model_b": 2},
+		},
+		"pods fitting before the last gpu flavor is full": {
+			cq: "gpu",
+			ps: utiltesting.MakePodSet("workers", 4).
+				Request("example.com/gpu", "2").
+				Obj(),
+			want:          4,
+			wantBreakdown: map[kueue.ResourceFlavorReference]int32{"model_a": 3, "model_b": 1},
+		},
+		"resource not covered": {
+			cq: "foo",
+			ps: utiltesting.MakePodSet("workers", 10).
+				Request("example.com/gpu", "1").
+				Obj(),
+			want: 0,
+		},
+		"unknown clusterQueue": {
+			cq:        "bar",
+			ps:        utiltesting.MakePodSet("workers", 10).Obj(),
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("model_a").Obj())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("model_b").Obj())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			got, breakdown, err := cache.MaxAdmissiblePods(tc.cq, tc.ps)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if got != tc.want {
+				t.Errorf("MaxAdmissiblePods() = %d, want %d", got, tc.want)
+			}
+			if diff := cmp.Diff(tc.wantBreakdown, breakdown, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Unexpected flavor breakdown (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+// parseDefaultFlavors parses the comma separated list of flavor names of
+// DefaultFlavorsAnnotation.
+func parseDefaultFlavors(v string) sets.Set[kueue.ResourceFlavorReference] {
+	defaults := sets.New[kueue.ResourceFlavorReference]()
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			defaults.Insert(kueue.ResourceFlavorReference(name))
+		}
+	}
+	return defaults
+}
+
+// OrderedFlavors returns the flavors of the resource group in the order they
+// should be tried: the order listed in the spec, with the default flavors
+// last.
+func (rg *ResourceGroup) OrderedFlavors() []FlavorQuotas {
+	defaults := 0
+	for i := range rg.Flavors {
+		if rg.Flavors[i].IsDefault {
+			defaults++
+		}
+	}
+	if defaults == 0 {
+		return rg.Flavors
+	}
+	ordered := make([]FlavorQuotas, 0, len(rg.Flavors))
+	for _, isDefault := range []bool{false, true} {
+		for i := range rg.Flavors {
+			if rg.Flavors[i].IsDefault == isDefault {
+				ordered = append(ordered, rg.Flavors[i])
+			}
+		}
+	}
+	return ordered
+}
+
+// FlavorMatchesPodSet returns whether the node labels of the flavor in the
+// ClusterQueue satisfy the node selector and the required node affinity of
+// the podSet, which are hard constraints, and a score for the preferred node
+// affinity of the podSet, which is a soft constraint: the sum of the weights
+// of the preferred terms that the node labels satisfy. Only the label keys of
+// the flavors in the same resource group are considered. Default flavors
+// match any podSet. When the flavor doesn't match, the reason explains why,
+// including when the ClusterQueue or the flavor are unknown.
+func (c *Cache) FlavorMatchesPodSet(cqName, flavor string, ps *kueue.PodSet) (matches bool, score int, reason string) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return false, 0, errCqNotFound.Error()
+	}
+	fName := kueue.ResourceFlavorReference(flavor)
+	for i := range cq.ResourceGroups {
+		rg := &cq.ResourceGroups[i]
+		for _, flvQuotas := range rg.Flavors {
+			if flvQuotas.Name != fName {
+				continue
+			}
+			node := &corev1.Node{}
+			if rf, ok := c.resourceFlavors[fName]; ok {
+				node.Labels = rf.Spec.NodeLabels
+			} else if !flvQuotas.IsDefault {
+				return false, 0, fmt.Sprintf("ResourceFlavor %s doesn't exist", fName)
+			}
+			if !flvQuotas.IsDefault {
+				match, err := FlavorSelector(&ps.Template.Spec, rg.LabelKeys).Match(node)
+				if err != nil {
+					return false, 0, err.Error()
+				}
+				if !match {
+					return false, 0, fmt.Sprintf("flavor %s doesn't match the node selector or the required node affinity", fName)
+				}
+			}
+			return true, preferredAffinityScore(&ps.Template.Spec, rg.LabelKeys, node), ""
+		}
+	}
+	return false, 0, fmt.Sprintf("flavor %s is not in the ClusterQueue", fName)
+}
+
+// preferredAffinityScore returns the sum of the weights of the preferred node
+// affinity terms of the pod spec that the node satisfies. Like in
+// FlavorSelector, the terms are limited to the allowed label keys, and the
+// terms left empty are ignored.
+func preferredAffinityScore(spec *corev1.PodSpec, allowedKeys sets.Set[string], node *corev1.Node) int {
+	affinity := spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil {
+		return 0
+	}
+	var terms []corev1.PreferredSchedulingTerm
+	for _, t := range affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		var expCopy []corev1.NodeSelectorRequirement
+		for _, e := range t.Preference.MatchExpressions {
+			if allowedKeys.Has(e.Key) {
+				expCopy = append(expCopy, e)
+			}
+		}
+		if len(expCopy) == 0 {
+			continue
+		}
+		terms = append(terms, corev1.PreferredSchedulingTerm{
+			Weight:     t.Weight,
+			Preference: corev1.NodeSelectorTerm{MatchExpressions: expCopy},
+		})
+	}
+	preferred, err := nodeaffinity.NewPreferredSchedulingTerms(terms)
+	if err != nil {
+		return 0
+	}
+	return int(preferred.Score(node))
+}
+
+// FlavorSelector returns the node affinity required by the pod spec, limited
+// to the label keys of the flavors of a resource group, to match it against
+// the node labels of the flavors.
+func FlavorSelector(spec *corev1.PodSpec, allowedKeys sets.Set[string]) nodeaffinity.RequiredNodeAffinity {
+	// This function generally replicates the implementation of kube-scheduler's NodeAffintiy
+	// Filter plugin as of v1.24.
+	var specCopy corev1.PodSpec
+
+	// Remove affinity constraints with irrelevant keys.
+	if len(spec.NodeSelector) != 0 {
+		specCopy.NodeSelector = map[string]string{}
+		for k, v := range spec.NodeSelector {
+			if allowedKeys.Has(k) {
+				specCopy.NodeSelector[k] = v
+			}
+		}
+	}
+
+	affinity := spec.Affinity
+	if affinity != nil && affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		var termsCopy []corev1.NodeSelectorTerm
+		for _, t := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			var expCopy []corev1.NodeSelectorRequirement
+			for _, e := range t.MatchExpressions {
+				if allowedKeys.Has(e.Key) {
+					expCopy = append(expCopy, e)
+				}
+			}
+			// If a term becomes empty, it means node affinity matches any flavor since those terms are ORed,
+			// and so matching gets reduced to spec.NodeSelector
+			if len(expCopy) == 0 {
+				termsCopy = nil
+				break
+			}
+			termsCopy = append(termsCopy, corev1.NodeSelectorTerm{MatchExpressions: expCopy})
+		}
+		if len(termsCopy) != 0 {
+			specCopy.Affinity = &corev1.Affinity{
+				NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: termsCopy,
+					},
+				},
+			}
+		}
+	}
+	return nodeaffinity.GetRequiredNodeAffinity(&corev1.Pod{Spec: specCopy})
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+)
+
+func TestFlavorMatchesPodSet(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("one").
+				Resource(corev1.ResourceCPU, "10").
+				Obj(),
+			*utiltesting.MakeFlavorQuotas("two").
+				Resource(corev1.ResourceCPU, "10").
+				Obj(),
+			*utiltesting.MakeFlavorQuotas("any").
+				Resource(corev1.ResourceCPU, "10").
+				Obj(),
+		).
+		Annotation(DefaultFlavorsAnnotation, "any").
+		Obj()
+	flavors := []*kueue.ResourceFlavor{
+		utiltesting.MakeResourceFlavor("one").Label("type", "one").Label("zone", "a").Obj(),
+		utiltesting.MakeResourceFlavor("two").Label("type", "two").Label("zone", "b").Obj(),
+		utiltesting.MakeResourceFlavor("any").Obj(),
+	}
+	podSet := func(nodeSelector map[string]string) *kueue.PodSet {
+		return utiltesting.MakePodSet("main", 1).
+			Request(corev1.ResourceCPU, "1").
+			NodeSelector(nodeSelector).
+			Obj()
+	}
+	preference := func(key, value string, weight int32) corev1.PreferredSchedulingTerm {
+		return corev1.PreferredSchedulingTerm{
+			Weight: weight,
+			Preference: corev1.NodeSelectorTerm{
+				MatchExpressions: []corev1.NodeSelectorRequirement{
+					{Key: key, Operator: corev1.NodeSelectorOpIn, Values: []string{value}},
+				},
+			},
+		}
+	}
+	withPreferences := func(ps *kueue.PodSet, terms ...corev1.PreferredSchedulingTerm) *kueue.PodSet {
+		ps.Template.Spec.Affinity = &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: terms,
+			},
+		}
+		return ps
+	}
+	cases := map[string]struct {
+		cq         string
+		flavor     string
+		podSet     *kueue.PodSet
+		wantMatch  bool
+		wantScore  int
+		wantReason string
+	}{
+		"specific flavor matches": {
+			cq:        "foo",
+			flavor:    "two",
+			podSet:    podSet(map[string]string{"type": "two"}),
+			wantMatch: true,
+		},
+		"specific flavor doesn't match": {
+			cq:         "foo",
+			flavor:     "one",
+			podSet:     podSet(map[string]string{"type": "two"}),
+			wantReason: "flavor one doesn't match the node selector or the required node affinity",
+		},
+		"label keys of other resource groups are ignored": {
+			cq:        "foo",
+			flavor:    "one",
+			podSet:    podSet(map[string]string{"type": "one", "region": "a"}),
+			wantMatch: true,
+		},
+		"default flavor matches when the specific flavors don't": {
+			cq:        "foo",
+			flavor:    "any",
+			podSet:    podSet(map[string]string{"type": "three"}),
+			wantMatch: true,
+		},
+		"preferred affinity not satisfied still matches": {
+			cq:        "foo",
+			flavor:    "one",
+			podSet:    withPreferences(podSet(nil), preference("type", "two", 10)),
+			wantMatch: true,
+		},
+		"preferred affinity adds the weights of the satisfied terms": {
+			cq:     "foo",
+			flavor: "two",
+			podSet: withPreferences(podSet(nil),
+				preference("type", "two", 10),
+				preference("zone", "b", 5),
+				preference("zone", "a", 1),
+				preference("region", "a", 20)),
+			wantMatch: true,
+			wantScore: 15,
+		},
+		"required mismatch with a satisfied preference": {
+			cq:         "foo",
+			flavor:     "one",
+			podSet:     withPreferences(podSet(map[string]string{"type": "two"}), preference("zone", "a", 10)),
+			wantReason: "flavor one doesn't match the node selector or the required node affinity",
+		},
+		"flavor not in the clusterQueue": {
+			cq:         "foo",
+			flavor:     "three",
+			podSet:     podSet(nil),
+			wantReason: "flavor three is not in the ClusterQueue",
+		},
+		"unknown clusterQueue": {
+			cq:         "bar",
+			flavor:     "one",
+			podSet:     podSet(nil),
+			wantReason: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			for _, rf := range flavors {
+				cache.AddOrUpdateResourceFlavor(rf)
+			}
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			match, score, reason := cache.FlavorMatchesPodSet(tc.cq, tc.flavor, tc.podSet)
+			if match != tc.wantMatch || score != tc.wantScore {
+				t.Errorf("FlavorMatchesPodSet() = %t, %d, want %t, %d", match, score, tc.wantMatch, tc.wantScore)
+			}
+			if diff := cmp.Diff(tc.wantReason, reason); diff != "" {
+				t.Errorf("Unexpected reason (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/util/maps"
+)
+
+// WorkloadInspection is a copy of what the cache knows about a workload
+// that uses quota in a ClusterQueue.
+type WorkloadInspection struct {
+	ClusterQueue string
+	// PodSetFlavors holds the flavor assigned to each resource, per podSet.
+	PodSetFlavors map[string]map[corev1.ResourceName]kueue.ResourceFlavorReference
+	// Usage is the quota that the workload uses, per flavor and resource.
+	Usage FlavorResourceQuantities
+	// Assumed is true when the workload is assumed by the scheduler but its
+	// admission is not observed yet.
+	Assumed bool
+}
+
+// InspectWorkload returns the ClusterQueue, the assigned flavors and the
+// quota usage of the admitted or assumed workload with the given key.
+func (c *Cache) InspectWorkload(key string) (*WorkloadInspection, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	for _, cq := range c.clusterQueues {
+		wi, ok := cq.Workloads[key]
+		if !ok {
+			continue
+		}
+		inspection := &WorkloadInspection{
+			ClusterQueue:  cq.Name,
+			PodSetFlavors: make(map[string]map[corev1.ResourceName]kueue.ResourceFlavorReference, len(wi.TotalRequests)),
+			Usage:         workloadUsage(wi),
+		}
+		for _, ps := range wi.TotalRequests {
+			inspection.PodSetFlavors[ps.Name] = maps.Clone(ps.Flavors)
+		}
+		_, inspection.Assumed = c.assumedWorkloads[key]
+		return inspection, nil
+	}
+	return nil, ErrWorkloadNotFound
+}
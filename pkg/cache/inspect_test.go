@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+)
+
+func TestInspectWorkload(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("cq").
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "10").Obj(),
+			*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "10").Obj(),
+		).
+		Obj()
+	admitted := utiltesting.MakeWorkload("admitted", "ns").
+		PodSets(
+			*utiltesting.MakePodSet("driver", 1).Request(corev1.ResourceCPU, "1").Obj(),
+			*utiltesting.MakePodSet("workers", 3).Request(corev1.ResourceCPU, "2").Obj(),
+		).
+		Admit(&kueue.Admission{
+			ClusterQueue: "cq",
+			PodSetAssignments: []kueue.PodSetAssignment{
+				{
+					Name:          "driver",
+					Flavors:       map[corev1.ResourceName]kueue.ResourceFlavorReference{corev1.ResourceCPU: "on-demand"},
+					ResourceUsage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+				},
+				{
+					Name:          "workers",
+					Flavors:       map[corev1.ResourceName]kueue.ResourceFlavorReference{corev1.ResourceCPU: "spot"},
+					ResourceUsage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("6")},
+				},
+			},
+		}).
+		Obj()
+	assumed := utiltesting.MakeWorkload("assumed", "ns").
+		Request(corev1.ResourceCPU, "3").
+		Admit(utiltesting.MakeAdmission("cq").Assignment(corev1.ResourceCPU, "spot", "3").Obj()).
+		Obj()
+
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if !cache.AddOrUpdateWorkload(admitted) {
+		t.Fatal("Failed adding workload")
+	}
+	if err := cache.AssumeWorkload(assumed); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+
+	cases := map[string]struct {
+		key       string
+		want      *WorkloadInspection
+		wantError string
+	}{
+		"admitted workload": {
+			key: "ns/admitted",
+			want: &WorkloadInspection{
+				ClusterQueue: "cq",
+				PodSetFlavors: map[string]map[corev1.ResourceName]kueue.ResourceFlavorReference{
+					"driver":  {corev1.ResourceCPU: "on-demand"},
+					"workers": {corev1.ResourceCPU: "spot"},
+				},
+				Usage: FlavorResourceQuantities{
+					"on-demand": {corev1.ResourceCPU: 1_000},
+					"spot":      {corev1.ResourceCPU: 6_000},
+				},
+			},
+		},
+		"assumed workload": {
+			key: "ns/assumed",
+			want: &WorkloadInspection{
+				ClusterQueue: "cq",
+				PodSetFlavors: map[string]map[corev1.ResourceName]kueue.ResourceFlavorReference{
+					"main": {corev1.ResourceCPU: "spot"},
+				},
+				Usage: FlavorResourceQuantities{
+					"spot": {corev1.ResourceCPU: 3_000},
+				},
+				Assumed: true,
+			},
+		},
+		"unknown workload": {
+			key:       "ns/unknown",
+			wantError: ErrWorkloadNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := cache.InspectWorkload(tc.key)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected inspection (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
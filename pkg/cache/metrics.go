@@ -0,0 +1,253 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/constants"
+	"sigs.k8s.io/kueue/pkg/metrics"
+)
+
+// clusterQueueReporter reports the status and admitted workloads of the
+// ClusterQueues in the global metrics of the metrics package. A nil reporter
+// reports nothing, which is the case for clones and snapshots, so that
+// simulations don't overwrite the series of the real ClusterQueues.
+type clusterQueueReporter struct{}
+
+func (r *clusterQueueReporter) reportStatus(cqName string, status metrics.ClusterQueueStatus) {
+	if r == nil {
+		return
+	}
+	metrics.ReportClusterQueueStatus(cqName, status)
+}
+
+func (r *clusterQueueReporter) reportAdmittedActiveWorkloads(cqName string, val int) {
+	if r == nil {
+		return
+	}
+	metrics.AdmittedActiveWorkloads.WithLabelValues(cqName).Set(float64(val))
+}
+
+func (r *clusterQueueReporter) clear(cqName string) {
+	if r == nil {
+		return
+	}
+	metrics.ClearCacheMetrics(cqName)
+}
+
+// cacheMetrics holds the metrics reported by a Cache registered with
+// RegisterMetrics.
+type cacheMetrics struct {
+	resourceUsage    *prometheus.GaugeVec
+	assumedWorkloads prometheus.Gauge
+	timeToAdmit      *prometheus.HistogramVec
+}
+
+func newCacheMetrics() *cacheMetrics {
+	return &cacheMetrics{
+		resourceUsage: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Subsystem: constants.KueueName,
+				Name:      "cache_resource_usage",
+				Help:      "The usage of a resource in a flavor by the workloads admitted in the cache, per 'cluster_queue', 'flavor' and 'resource'",
+			}, []string{"cluster_queue", "flavor", "resource"},
+		),
+		assumedWorkloads: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Subsystem: constants.KueueName,
+				Name:      "cache_assumed_workloads",
+				Help:      "The number of workloads assumed in the cache",
+			},
+		),
+		timeToAdmit: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Subsystem: constants.KueueName,
+				Name:      "cache_time_to_admit_seconds",
+				Help:      "The time between a workload first being seen pending in the cache and being admitted, per 'cluster_queue'",
+				Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+			}, []string{"cluster_queue"},
+		),
+	}
+}
+
+// RegisterMetrics registers the cache metrics in the registry and starts
+// reporting the current state of the cache.
+func (c *Cache) RegisterMetrics(registry prometheus.Registerer) error {
+	m := newCacheMetrics()
+	if err := registry.Register(m.resourceUsage); err != nil {
+		return err
+	}
+	if err := registry.Register(m.assumedWorkloads); err != nil {
+		registry.Unregister(m.resourceUsage)
+		return err
+	}
+	if err := registry.Register(m.timeToAdmit); err != nil {
+		registry.Unregister(m.resourceUsage)
+		registry.Unregister(m.assumedWorkloads)
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.metrics = m
+	for _, cq := range c.clusterQueues {
+		cq.metrics = m
+		cq.reportUsage()
+	}
+	c.reportAssumedWorkloads()
+	return nil
+}
+
+func (c *Cache) reportAssumedWorkloads() {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.assumedWorkloads.Set(float64(len(c.assumedWorkloads)))
+}
+
+// reportTimeToAdmit reports the time since the pending workload was first
+// seen as the time it took to admit it in the ClusterQueue.
+func (c *Cache) reportTimeToAdmit(cqName string, pending pendingWorkload) {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.timeToAdmit.WithLabelValues(cqName).Observe(c.clock.Since(pending.firstSeen).Seconds())
+}
+
+// reportUsage reports the usage of the ClusterQueue, if the cache metrics
+// are registered.
+func (c *ClusterQueue) reportUsage() {
+	if c.metrics == nil {
+		return
+	}
+	for fName, resUsage := range c.Usage {
+		for rName, v := range resUsage {
+			c.metrics.resourceUsage.WithLabelValues(c.Name, string(fName), string(rName)).Set(float64(v))
+		}
+	}
+}
+
+// clearUsageMetrics removes the usage series of the ClusterQueue.
+func (c *ClusterQueue) clearUsageMetrics() {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.resourceUsage.DeletePartialMatch(prometheus.Labels{"cluster_queue": c.Name})
+}
+
+// openMetricsLabels are the labels of the series written by WriteOpenMetrics.
+var openMetricsLabels = []string{"cluster_queue", "cohort", "flavor", "resource"}
+
+// openMetricsEscaper escapes the label values in the OpenMetrics text format.
+var openMetricsEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// WriteOpenMetrics writes the usage and nominal quota of each resource in each
+// flavor of the ClusterQueues, and the share of the cohort capacity that they
+// use, in the OpenMetrics text format. Unlike RegisterMetrics, it doesn't
+// need a registry, so that the state of the cache can be served for
+// federation without global collectors. Like in CohortCapacity, the cohort
+// capacity only includes the nominal quota of the active members, and the
+// share isn't written when the capacity is zero or the ClusterQueue doesn't
+// belong to a cohort.
+func (c *Cache) WriteOpenMetrics(w io.Writer) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	cqs := make([]*ClusterQueue, 0, len(c.clusterQueues))
+	for _, cq := range c.clusterQueues {
+		cqs = append(cqs, cq)
+	}
+	sort.Slice(cqs, func(i, j int) bool { return cqs[i].Name < cqs[j].Name })
+	capacities := make(map[*Cohort]FlavorResourceQuantities)
+	for _, cq := range cqs {
+		if cq.Cohort != nil && capacities[cq.Cohort] == nil {
+			capacities[cq.Cohort] = cohortCapacity(cq.Cohort)
+		}
+	}
+
+	var buf bytes.Buffer
+	prefix := constants.KueueName + "_cache_cluster_queue_"
+	writeOpenMetricsHeader(&buf, prefix+"usage", "The usage of a resource in a flavor by the workloads admitted in the ClusterQueue")
+	for _, cq := range cqs {
+		for _, fName := range sortedKeys(cq.Usage) {
+			for _, rName := range sortedKeys(cq.Usage[fName]) {
+				writeOpenMetricsSample(&buf, prefix+"usage", cq, fName, rName, strconv.FormatInt(cq.Usage[fName][rName], 10))
+			}
+		}
+	}
+	writeOpenMetricsHeader(&buf, prefix+"nominal_quota", "The nominal quota of a resource in a flavor of the ClusterQueue")
+	for _, cq := range cqs {
+		for _, rg := range cq.ResourceGroups {
+			for _, flvQuotas := range rg.Flavors {
+				for _, rName := range sortedKeys(flvQuotas.Resources) {
+					writeOpenMetricsSample(&buf, prefix+"nominal_quota", cq, flvQuotas.Name, rName, strconv.FormatInt(flvQuotas.Resources[rName].Nominal, 10))
+				}
+			}
+		}
+	}
+	writeOpenMetricsHeader(&buf, prefix+"cohort_share", "The ratio between the usage of a resource in a flavor by the ClusterQueue and the capacity of its cohort")
+	for _, cq := range cqs {
+		if cq.Cohort == nil {
+			continue
+		}
+		capacity := capacities[cq.Cohort]
+		for _, fName := range sortedKeys(cq.Usage) {
+			for _, rName := range sortedKeys(cq.Usage[fName]) {
+				if capacity[fName][rName] == 0 {
+					continue
+				}
+				share := float64(cq.Usage[fName][rName]) / float64(capacity[fName][rName])
+				writeOpenMetricsSample(&buf, prefix+"cohort_share", cq, fName, rName, strconv.FormatFloat(share, 'g', -1, 64))
+			}
+		}
+	}
+	buf.WriteString("# EOF\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeOpenMetricsHeader(buf *bytes.Buffer, name, help string) {
+	fmt.Fprintf(buf, "# TYPE %s gauge\n# HELP %s %s\n", name, name, help)
+}
+
+func writeOpenMetricsSample(buf *bytes.Buffer, name string, cq *ClusterQueue, fName kueue.ResourceFlavorReference, rName corev1.ResourceName, value string) {
+	var cohort string
+	if cq.Cohort != nil {
+		cohort = cq.Cohort.Name
+	}
+	values := []string{cq.Name, cohort, string(fName), string(rName)}
+	buf.WriteString(name)
+	buf.WriteByte('{')
+	for i, label := range openMetricsLabels {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, "%s=\"%s\"", label, openMetricsEscaper.Replace(values[i]))
+	}
+	fmt.Fprintf(buf, "} %s\n", value)
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	testingclock "k8s.io/utils/clock/testing"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+)
+
+func TestCacheMetrics(t *testing.T) {
+	const (
+		usageHeader = `
+# HELP kueue_cache_resource_usage The usage of a resource in a flavor by the workloads admitted in the cache, per 'cluster_queue', 'flavor' and 'resource'
+# TYPE kueue_cache_resource_usage gauge
+`
+		assumedHeader = `
+# HELP kueue_cache_assumed_workloads The number of workloads assumed in the cache
+# TYPE kueue_cache_assumed_workloads gauge
+`
+	)
+	cqs := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("foo").
+			ResourceGroup(
+				*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "10").Obj(),
+				*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "10").Obj(),
+			).
+			Obj(),
+		utiltesting.MakeClusterQueue("bar").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	admitted := utiltesting.MakeWorkload("a", "ns").
+		Request(corev1.ResourceCPU, "2").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "on-demand", "2").Obj()).
+		Obj()
+	assumed := utiltesting.MakeWorkload("b", "ns").
+		Request(corev1.ResourceCPU, "3").
+		Admit(utiltesting.MakeAdmission("bar").Assignment(corev1.ResourceCPU, "spot", "3").Obj()).
+		Obj()
+
+	cases := map[string]struct {
+		operation func(*Cache) error
+		want      string
+	}{
+		"workloads added": {
+			operation: func(c *Cache) error {
+				c.AddOrUpdateWorkload(admitted)
+				return c.AssumeWorkload(assumed)
+			},
+			want: usageHeader + `
+kueue_cache_resource_usage{cluster_queue="bar",flavor="spot",resource="cpu"} 3000
+kueue_cache_resource_usage{cluster_queue="foo",flavor="on-demand",resource="cpu"} 2000
+kueue_cache_resource_usage{cluster_queue="foo",flavor="spot",resource="cpu"} 0
+` + assumedHeader + `
+kueue_cache_assumed_workloads 1
+`,
+		},
+		"workloads deleted": {
+			operation: func(c *Cache) error {
+				c.AddOrUpdateWorkload(admitted)
+				if err := c.AssumeWorkload(assumed); err != nil {
+					return err
+				}
+				if err := c.ForgetWorkload(assumed); err != nil {
+					return err
+				}
+				return c.DeleteWorkload(admitted)
+			},
+			want: usageHeader + `
+kueue_cache_resource_usage{cluster_queue="bar",flavor="spot",resource="cpu"} 0
+kueue_cache_resource_usage{cluster_queue="foo",flavor="on-demand",resource="cpu"} 0
+kueue_cache_resource_usage{cluster_queue="foo",flavor="spot",resource="cpu"} 0
+` + assumedHeader + `
+kueue_cache_assumed_workloads 0
+`,
+		},
+		"clusterQueue deleted": {
+			operation: func(c *Cache) error {
+				c.AddOrUpdateWorkload(admitted)
+				c.DeleteClusterQueue(cqs[0])
+				return nil
+			},
+			want: usageHeader + `
+kueue_cache_resource_usage{cluster_queue="bar",flavor="spot",resource="cpu"} 0
+` + assumedHeader + `
+kueue_cache_assumed_workloads 0
+`,
+		},
+		"flavor removed from clusterQueue": {
+			operation: func(c *Cache) error {
+				cq := utiltesting.MakeClusterQueue("foo").
+					ResourceGroup(*utiltesting.MakeFlavorQuotas("on-demand").Resource(corev1.ResourceCPU, "10").Obj()).
+					Obj()
+				_, err := c.UpdateClusterQueue(cq)
+				return err
+			},
+			want: usageHeader + `
+kueue_cache_resource_usage{cluster_queue="bar",flavor="spot",resource="cpu"} 0
+kueue_cache_resource_usage{cluster_queue="foo",flavor="on-demand",resource="cpu"} 0
+` + assumedHeader + `
+kueue_cache_assumed_workloads 0
+`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			registry := prometheus.NewRegistry()
+			if err := cache.RegisterMetrics(registry); err != nil {
+				t.Fatalf("Registering metrics: %v", err)
+			}
+			for _, cq := range cqs {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			if err := tc.operation(cache); err != nil {
+				t.Fatalf("Running operation: %v", err)
+			}
+			if err := testutil.GatherAndCompare(registry, strings.NewReader(tc.want)); err != nil {
+				t.Errorf("Unexpected metrics: %v", err)
+			}
+		})
+	}
+}
+
+func TestTimeToAdmitMetric(t *testing.T) {
+	const want = `
+# HELP kueue_cache_time_to_admit_seconds The time between a workload first being seen pending in the cache and being admitted, per 'cluster_queue'
+# TYPE kueue_cache_time_to_admit_seconds histogram
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="1"} 0
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="2"} 0
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="4"} 0
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="8"} 0
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="16"} 0
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="32"} 1
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="64"} 1
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="128"} 1
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="256"} 1
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="512"} 1
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="1024"} 1
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="2048"} 1
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="4096"} 1
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="8192"} 1
+kueue_cache_time_to_admit_seconds_bucket{cluster_queue="foo",le="+Inf"} 1
+kueue_cache_time_to_admit_seconds_sum{cluster_queue="foo"} 30
+kueue_cache_time_to_admit_seconds_count{cluster_queue="foo"} 1
+`
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	lq := utiltesting.MakeLocalQueue("lq", "ns").ClusterQueue("foo").Obj()
+	pending := utiltesting.MakeWorkload("a", "ns").
+		Queue("lq").
+		Request(corev1.ResourceCPU, "2").
+		Obj()
+	never := utiltesting.MakeWorkload("b", "ns").
+		Queue("lq").
+		Request(corev1.ResourceCPU, "2").
+		Obj()
+
+	cache := New(utiltesting.NewFakeClient())
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	cache.clock = fakeClock
+	registry := prometheus.NewRegistry()
+	if err := cache.RegisterMetrics(registry); err != nil {
+		t.Fatalf("Registering metrics: %v", err)
+	}
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if err := cache.AddLocalQueue(lq); err != nil {
+		t.Fatalf("Adding LocalQueue: %v", err)
+	}
+	if !cache.AddOrUpdatePendingWorkload(pending) {
+		t.Fatalf("Workload %s was not added as pending", pending.Name)
+	}
+	if !cache.AddOrUpdatePendingWorkload(never) {
+		t.Fatalf("Workload %s was not added as pending", never.Name)
+	}
+
+	// Updates of the pending workload keep the time it was first seen.
+	fakeClock.Step(10 * time.Second)
+	if !cache.AddOrUpdatePendingWorkload(pending) {
+		t.Fatalf("Workload %s was not updated as pending", pending.Name)
+	}
+
+	fakeClock.Step(20 * time.Second)
+	admitted := utiltesting.MakeWorkload("a", "ns").
+		Queue("lq").
+		Request(corev1.ResourceCPU, "2").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "2").Obj()).
+		Obj()
+	if err := cache.AssumeWorkload(admitted); err != nil {
+		t.Fatalf("Assuming workload: %v", err)
+	}
+	// Admitting the assumed workload doesn't record the time again.
+	if !cache.AddOrUpdateWorkload(admitted) {
+		t.Fatalf("Workload %s was not added", admitted.Name)
+	}
+
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "kueue_cache_time_to_admit_seconds"); err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			Cohort("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			Cohort("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("c").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "5").Obj()).
+			Obj(),
+	}
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	wl := utiltesting.MakeWorkload("a-wl", "ns").
+		Request(corev1.ResourceCPU, "5").
+		Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "default", "5").Obj()).
+		Obj()
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatalf("Workload %s was not added", wl.Name)
+	}
+
+	var out strings.Builder
+	if err := cache.WriteOpenMetrics(&out); err != nil {
+		t.Fatalf("WriteOpenMetrics failed: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"# TYPE kueue_cache_cluster_queue_usage gauge\n",
+		`kueue_cache_cluster_queue_usage{cluster_queue="a",cohort="one",flavor="default",resource="cpu"} 5000` + "\n",
+		`kueue_cache_cluster_queue_usage{cluster_queue="b",cohort="one",flavor="default",resource="cpu"} 0` + "\n",
+		"# TYPE kueue_cache_cluster_queue_nominal_quota gauge\n",
+		`kueue_cache_cluster_queue_nominal_quota{cluster_queue="a",cohort="one",flavor="default",resource="cpu"} 10000` + "\n",
+		`kueue_cache_cluster_queue_nominal_quota{cluster_queue="c",cohort="",flavor="default",resource="cpu"} 5000` + "\n",
+		"# TYPE kueue_cache_cluster_queue_cohort_share gauge\n",
+		`kueue_cache_cluster_queue_cohort_share{cluster_queue="a",cohort="one",flavor="default",resource="cpu"} 0.25` + "\n",
+		`kueue_cache_cluster_queue_cohort_share{cluster_queue="b",cohort="one",flavor="default",resource="cpu"} 0` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Output doesn't contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `kueue_cache_cluster_queue_cohort_share{cluster_queue="c"`) {
+		t.Errorf("Output contains the cohort share of a ClusterQueue without cohort:\n%s", got)
+	}
+	if !strings.HasSuffix(got, "# EOF\n") {
+		t.Errorf("Output doesn't end with the EOF marker:\n%s", got)
+	}
+}
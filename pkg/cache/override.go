@@ -0,0 +1,151 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+)
+
+// quotaOverride is a temporary nominal quota that replaces the one in the
+// ClusterQueue spec.
+type quotaOverride struct {
+	nominal int64
+	// specNominal is the nominal quota in the spec, restored when the
+	// override expires.
+	specNominal int64
+	expiration  time.Time
+}
+
+// OverrideFlavorQuota replaces the nominal quota of the resource in the flavor
+// of the ClusterQueue, for example to absorb a burst, until the ttl passes.
+// The override applies to the fit checks and to the borrowed quota reported
+// by Usage, and it's kept if the ClusterQueue is updated. Overriding the same
+// resource again replaces the previous override and its ttl.
+// The overrides are reverted by CleanUpOnContext.
+func (c *Cache) OverrideFlavorQuota(cqName, flavorName string, resource corev1.ResourceName, nominal int64, ttl time.Duration) error {
+	c.Lock()
+	defer c.Unlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return errCqNotFound
+	}
+	fName := kueue.ResourceFlavorReference(flavorName)
+	if cq.resourceQuota(fName, resource) == nil {
+		return fmt.Errorf("flavor %s doesn't provide quota for %s in the ClusterQueue", fName, resource)
+	}
+	// The ResourceGroups are shared with the snapshots, so they are replaced
+	// instead of modified.
+	cq.ResourceGroups = copyResourceGroups(cq.ResourceGroups)
+	cq.UpdateRGByResource()
+	rQuota := cq.resourceQuota(fName, resource)
+	if cq.quotaOverrides == nil {
+		cq.quotaOverrides = make(map[kueue.ResourceFlavorReference]map[corev1.ResourceName]*quotaOverride)
+	}
+	if cq.quotaOverrides[fName] == nil {
+		cq.quotaOverrides[fName] = make(map[corev1.ResourceName]*quotaOverride)
+	}
+	o, ok := cq.quotaOverrides[fName][resource]
+	if !ok {
+		o = &quotaOverride{specNominal: rQuota.Nominal}
+		cq.quotaOverrides[fName][resource] = o
+	}
+	o.nominal = nominal
+	o.expiration = c.clock.Now().Add(ttl)
+	rQuota.Nominal = nominal
+	return nil
+}
+
+// expireQuotaOverrides restores the nominal quotas of the overrides past
+// their ttl.
+func (c *Cache) expireQuotaOverrides() {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.clock.Now()
+	for _, cq := range c.clusterQueues {
+		cq.expireQuotaOverrides(now)
+	}
+}
+
+func (c *ClusterQueue) expireQuotaOverrides(now time.Time) {
+	copied := false
+	for fName, overrides := range c.quotaOverrides {
+		for rName, o := range overrides {
+			if now.Before(o.expiration) {
+				continue
+			}
+			if !copied {
+				c.ResourceGroups = copyResourceGroups(c.ResourceGroups)
+				c.UpdateRGByResource()
+				copied = true
+			}
+			if rQuota := c.resourceQuota(fName, rName); rQuota != nil {
+				rQuota.Nominal = o.specNominal
+			}
+			delete(overrides, rName)
+		}
+		if len(overrides) == 0 {
+			delete(c.quotaOverrides, fName)
+		}
+	}
+}
+
+// applyQuotaOverrides replaces the nominal quotas, just built from the spec,
+// with the active overrides. The overrides for resources that are no longer
+// in the spec are dropped.
+func (c *ClusterQueue) applyQuotaOverrides() {
+	for fName, overrides := range c.quotaOverrides {
+		for rName, o := range overrides {
+			rQuota := c.resourceQuota(fName, rName)
+			if rQuota == nil {
+				delete(overrides, rName)
+				continue
+			}
+			o.specNominal = rQuota.Nominal
+			rQuota.Nominal = o.nominal
+		}
+		if len(overrides) == 0 {
+			delete(c.quotaOverrides, fName)
+		}
+	}
+}
+
+// specResourceGroups returns the resource groups of the ClusterQueue with the
+// nominal quotas of the spec in place of the active overrides.
+func (c *ClusterQueue) specResourceGroups() []ResourceGroup {
+	if len(c.quotaOverrides) == 0 {
+		return c.ResourceGroups
+	}
+	rgs := copyResourceGroups(c.ResourceGroups)
+	for i := range rgs {
+		for j := range rgs[i].Flavors {
+			flvQuotas := &rgs[i].Flavors[j]
+			for rName, o := range c.quotaOverrides[flvQuotas.Name] {
+				if rQuota, found := flvQuotas.Resources[rName]; found {
+					rQuota.Nominal = o.specNominal
+				}
+			}
+		}
+	}
+	return rgs
+}
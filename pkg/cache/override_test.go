@@ -0,0 +1,106 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	testingclock "k8s.io/utils/clock/testing"
+
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+func TestOverrideFlavorQuota(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	wl := workload.NewInfo(utiltesting.MakeWorkload("wl", "ns").
+		Request(corev1.ResourceCPU, "15").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "15").Obj()).
+		Obj())
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	cache := New(utiltesting.NewFakeClient())
+	cache.clock = fakeClock
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	checkFits := func(want bool) {
+		t.Helper()
+		got, err := cache.CanFit("foo", wl)
+		if err != nil {
+			t.Fatalf("CanFit failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("CanFit() = %t, want %t", got, want)
+		}
+	}
+
+	if err := cache.OverrideFlavorQuota("bar", "default", corev1.ResourceCPU, 20_000, time.Minute); err == nil {
+		t.Error("Overriding the quota of an unknown ClusterQueue succeeded")
+	}
+	if err := cache.OverrideFlavorQuota("foo", "spot", corev1.ResourceCPU, 20_000, time.Minute); err == nil {
+		t.Error("Overriding the quota of a flavor without quota succeeded")
+	}
+	checkFits(false)
+
+	snap := cache.Snapshot()
+	if err := cache.OverrideFlavorQuota("foo", "default", corev1.ResourceCPU, 20_000, time.Minute); err != nil {
+		t.Fatalf("Overriding the quota: %v", err)
+	}
+	checkFits(true)
+	if got := snap.ClusterQueues["foo"].resourceQuota("default", corev1.ResourceCPU).Nominal; got != 10_000 {
+		t.Errorf("The override changed the nominal quota in a previous snapshot to %d", got)
+	}
+
+	// The override is kept when the ClusterQueue is updated.
+	if _, err := cache.UpdateClusterQueue(cq); err != nil {
+		t.Fatalf("Updating ClusterQueue: %v", err)
+	}
+	checkFits(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cache.CleanUpOnContext(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	if err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return fakeClock.HasWaiters(), nil
+	}); err != nil {
+		t.Fatalf("Waiting for the cleanup ticker: %v", err)
+	}
+	fakeClock.Step(time.Minute)
+	if err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		fits, err := cache.CanFit("foo", wl)
+		return !fits, err
+	}); err != nil {
+		t.Fatalf("Waiting for the override to expire: %v", err)
+	}
+	if got := cache.clusterQueues["foo"].resourceQuota("default", corev1.ResourceCPU).Nominal; got != 10_000 {
+		t.Errorf("Got nominal quota %d after the override expired, want 10000", got)
+	}
+}
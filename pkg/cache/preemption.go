@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+var errNoFitAfterPreemption = errors.New("workload doesn't fit in the ClusterQueue after removing the victims")
+
+// RecordPreemption records that the preempted workload was evicted to admit
+// the preemptor, both identified by their keys, replacing any previous
+// preemptor of the workload. The record is cleared when either workload is
+// deleted from the cache.
+func (c *Cache) RecordPreemption(preemptor, preempted string) {
+	c.Lock()
+	defer c.Unlock()
+	if c.preemptors == nil {
+		c.preemptors = make(map[string]string)
+	}
+	c.preemptors[preempted] = preemptor
+}
+
+// PreemptedBy returns the key of the workload that preempted the workload
+// with the given key, and whether there is one.
+func (c *Cache) PreemptedBy(wlKey string) (string, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	preemptor, ok := c.preemptors[wlKey]
+	return preemptor, ok
+}
+
+// clearPreemptions removes the preemptions where the workload is the
+// preemptor or the preempted one.
+func (c *Cache) clearPreemptions(wlKey string) {
+	delete(c.preemptors, wlKey)
+	for preempted, preemptor := range c.preemptors {
+		if preemptor == wlKey {
+			delete(c.preemptors, preempted)
+		}
+	}
+}
+
+// AssumeWithPreemption removes the victims, identified by their keys, from
+// the cache and assumes the workload in the ClusterQueue of its admission, as
+// a single operation. The victims can be admitted or assumed workloads in any
+// ClusterQueue, and they are recorded as preempted by the workload. If the
+// workload still doesn't fit, or any other step fails, the cache is left
+// unchanged.
+//
+// The external quota, if any, is consumed after a first check, without
+// holding the lock, and released again if the workload can't be assumed
+// anymore once the lock is taken back.
+func (c *Cache) AssumeWithPreemption(wl *workload.Info, victims []string) error {
+	wi, _, err := c.assumeWithPreemption(wl.Obj, victims, nil)
+	if err != nil {
+		return err
+	}
+	usage := c.externalUsage(wi)
+	if err := c.consumeExternalQuota(usage); err != nil {
+		return err
+	}
+	_, released, err := c.assumeWithPreemption(wl.Obj, victims, wi)
+	if err != nil {
+		// Best effort, the workload is not assumed anyway.
+		_ = c.releaseExternalQuota(usage)
+		return err
+	}
+	for _, vUsage := range released {
+		// Best effort, the victims are removed anyway.
+		_ = c.releaseExternalQuota(vUsage)
+	}
+	return nil
+}
+
+// assumeWithPreemption checks that the workload fits in its ClusterQueue once
+// the victims are removed. If wi is nil, the cache is left unchanged and the
+// info of the workload in the ClusterQueue is returned. Otherwise, wi is
+// assumed, the victims are removed and the usages to release in the external
+// quota service for them are returned.
+func (c *Cache) assumeWithPreemption(w *kueue.Workload, victims []string, wi *workload.Info) (*workload.Info, []FlavorResourceQuantities, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !workload.IsAdmitted(w) {
+		return nil, nil, errWorkloadNotAdmitted
+	}
+	k := workload.Key(w)
+	if assumedCq, assumed := c.assumedWorkloads[k]; assumed {
+		return nil, nil, fmt.Errorf("the workload is already assumed to ClusterQueue %q", assumedCq)
+	}
+	cq, ok := c.clusterQueues[string(w.Status.Admission.ClusterQueue)]
+	if !ok {
+		return nil, nil, errCqNotFound
+	}
+	if _, exist := cq.Workloads[k]; exist {
+		return nil, nil, errWorkloadAlreadyExists
+	}
+	if err := cq.validatePodSetAssignments(w); err != nil {
+		return nil, nil, err
+	}
+	dryRun := wi == nil
+	if dryRun {
+		wi = cq.newWorkloadInfo(w)
+	}
+	if err := cq.checkWorkloadSize(wi); err != nil {
+		return nil, nil, err
+	}
+
+	victimKeys := sets.List(sets.New(victims...))
+	victimCQs := make([]*ClusterQueue, len(victimKeys))
+	for i, vKey := range victimKeys {
+		for _, vCq := range c.clusterQueues {
+			if _, ok := vCq.Workloads[vKey]; ok {
+				victimCQs[i] = vCq
+				break
+			}
+		}
+		if victimCQs[i] == nil {
+			return nil, nil, fmt.Errorf("victim %s: %w", vKey, ErrWorkloadNotFound)
+		}
+	}
+
+	removed := make([]*workload.Info, len(victimKeys))
+	for i, vKey := range victimKeys {
+		removed[i] = victimCQs[i].Workloads[vKey]
+		victimCQs[i].deleteWorkload(removed[i].Obj)
+	}
+	restore := func() {
+		for i, vWi := range removed {
+			_ = victimCQs[i].addWorkloadInfo(vWi)
+		}
+	}
+	if !cq.fits(wi) {
+		restore()
+		return nil, nil, errNoFitAfterPreemption
+	}
+	if dryRun {
+		restore()
+		return wi, nil, nil
+	}
+
+	var released []FlavorResourceQuantities
+	for i, vKey := range victimKeys {
+		c.clearPreemptions(vKey)
+		c.cleanupAssumedState(removed[i].Obj)
+		delete(c.admissionTimes, vKey)
+		if usage := c.externalUsage(removed[i]); usage != nil {
+			released = append(released, usage)
+		}
+		if c.preemptors == nil {
+			c.preemptors = make(map[string]string)
+		}
+		c.preemptors[vKey] = k
+	}
+	_ = cq.addWorkloadInfo(wi)
+	c.markAssumed(w, cq.Name)
+	if c.podsReadyTracking {
+		c.podsReadyCond.Broadcast()
+	}
+	return wi, released, nil
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+func TestRecordPreemption(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if err := cache.AddLocalQueue(utiltesting.MakeLocalQueue("lq", "ns").ClusterQueue("foo").Obj()); err != nil {
+		t.Fatalf("Adding LocalQueue: %v", err)
+	}
+	admitted := func(name string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Queue("lq").
+			Request(corev1.ResourceCPU, "1").
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+			Obj()
+	}
+	low1, low2, low3 := admitted("low1"), admitted("low2"), admitted("low3")
+	for _, wl := range []*kueue.Workload{low1, low2, low3} {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Workload %s was not added", wl.Name)
+		}
+	}
+	high := utiltesting.MakeWorkload("high", "ns").Queue("lq").Obj()
+	if !cache.AddOrUpdatePendingWorkload(high) {
+		t.Fatal("Pending workload was not added")
+	}
+	other := utiltesting.MakeWorkload("other", "ns").Queue("lq").Obj()
+	if !cache.AddOrUpdatePendingWorkload(other) {
+		t.Fatal("Pending workload was not added")
+	}
+
+	check := func(preempted, wantPreemptor string) {
+		t.Helper()
+		got, found := cache.PreemptedBy(preempted)
+		if wantFound := wantPreemptor != ""; found != wantFound || got != wantPreemptor {
+			t.Errorf("PreemptedBy(%q) = %q, %t, want %q, %t", preempted, got, found, wantPreemptor, wantFound)
+		}
+	}
+
+	cache.RecordPreemption("ns/high", "ns/low1")
+	cache.RecordPreemption("ns/high", "ns/low2")
+	cache.RecordPreemption("ns/other", "ns/low3")
+	check("ns/low1", "ns/high")
+	check("ns/low2", "ns/high")
+	check("ns/low3", "ns/other")
+	check("ns/high", "")
+
+	// Deleting the preempted workload clears its record.
+	if err := cache.DeleteWorkload(low1); err != nil {
+		t.Fatalf("Deleting workload: %v", err)
+	}
+	check("ns/low1", "")
+	check("ns/low2", "ns/high")
+
+	// Deleting the preemptor clears the records of all the workloads it preempted.
+	cache.DeletePendingWorkload(high)
+	check("ns/low2", "")
+	check("ns/low3", "ns/other")
+
+	// Deleting the preemptor after it's admitted also clears the record.
+	otherAdmitted := admitted("other")
+	if !cache.AddOrUpdateWorkload(otherAdmitted) {
+		t.Fatal("Workload other was not added")
+	}
+	check("ns/low3", "ns/other")
+	if err := cache.DeleteWorkload(otherAdmitted); err != nil {
+		t.Fatalf("Deleting workload: %v", err)
+	}
+	check("ns/low3", "")
+}
+
+func TestAssumeWithPreemption(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	admitted := func(name, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	high := admitted("high", "8")
+	cases := map[string]struct {
+		victims       []string
+		wantError     string
+		wantUsage     int64
+		wantWorkloads []string
+		wantAssumed   map[string]string
+		wantPreempted map[string]string
+	}{
+		"removing the victims barely makes room": {
+			victims:       []string{"ns/v1", "ns/v2"},
+			wantUsage:     10_000,
+			wantWorkloads: []string{"ns/high", "ns/v3"},
+			wantAssumed:   map[string]string{"ns/high": "foo"},
+			wantPreempted: map[string]string{"ns/v1": "ns/high", "ns/v2": "ns/high"},
+		},
+		"not enough room, victims restored": {
+			victims:       []string{"ns/v1"},
+			wantError:     errNoFitAfterPreemption.Error(),
+			wantUsage:     9_000,
+			wantWorkloads: []string{"ns/v1", "ns/v2", "ns/v3"},
+			wantAssumed:   map[string]string{"ns/v2": "foo"},
+		},
+		"unknown victim": {
+			victims:       []string{"ns/v1", "ns/v4"},
+			wantError:     "victim ns/v4: " + ErrWorkloadNotFound.Error(),
+			wantUsage:     9_000,
+			wantWorkloads: []string{"ns/v1", "ns/v2", "ns/v3"},
+			wantAssumed:   map[string]string{"ns/v2": "foo"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			for _, wl := range []*kueue.Workload{admitted("v1", "4"), admitted("v3", "2")} {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", wl.Name)
+				}
+			}
+			if err := cache.AssumeWorkload(admitted("v2", "3")); err != nil {
+				t.Fatalf("Assuming workload: %v", err)
+			}
+
+			err := cache.AssumeWithPreemption(workload.NewInfo(high), tc.victims)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			cqImpl := cache.clusterQueues["foo"]
+			if got := cqImpl.Usage["default"][corev1.ResourceCPU]; got != tc.wantUsage {
+				t.Errorf("Got usage %d, want %d", got, tc.wantUsage)
+			}
+			gotWorkloads := sortedKeys(cqImpl.Workloads)
+			if diff := cmp.Diff(tc.wantWorkloads, gotWorkloads); diff != "" {
+				t.Errorf("Unexpected workloads (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantAssumed, cache.assumedWorkloads); diff != "" {
+				t.Errorf("Unexpected assumed workloads (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantPreempted, cache.preemptors, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Unexpected preemptions (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
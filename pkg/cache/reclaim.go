@@ -0,0 +1,164 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/util/priority"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+// CohortReclaimCandidates returns the workloads in other ClusterQueues of the
+// cohort that the workload could preempt to reclaim the nominal quota that
+// the ClusterQueue lent. Only the resources requested by the workload, in
+// the flavors where the ClusterQueue is below its nominal quota, are
+// considered, and only the members borrowing them are candidates, as
+// ClusterQueues using their own nominal quota can't be reclaimed from.
+// With ReclaimWithinCohort=LowerPriority, only workloads with lower priority
+// than the workload are returned. The candidates are sorted by the quota that
+// their ClusterQueue borrows, more first, then by increasing priority and by
+// most recent admission.
+func (c *Cache) CohortReclaimCandidates(cqName string, wl *kueue.Workload) ([]*workload.Info, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	if cq.Cohort == nil || cq.Preemption.ReclaimWithinCohort == kueue.PreemptionPolicyNever {
+		return nil, nil
+	}
+	reclaimable := cq.reclaimableResources(wl)
+	if len(reclaimable) == 0 {
+		return nil, nil
+	}
+
+	wlPriority := priority.Priority(wl)
+	borrowed := make(map[string]int64)
+	var candidates []*workload.Info
+	for member := range cq.Cohort.Members {
+		if member == cq {
+			continue
+		}
+		b := member.borrowedIn(reclaimable)
+		if b == 0 {
+			continue
+		}
+		borrowed[member.Name] = b
+		for _, candidate := range member.Workloads {
+			if cq.Preemption.ReclaimWithinCohort == kueue.PreemptionPolicyLowerPriority && priority.Priority(candidate.Obj) >= wlPriority {
+				continue
+			}
+			if !usesAnyResource(candidate, reclaimable) {
+				continue
+			}
+			candidates = append(candidates, candidate.DeepCopy())
+		}
+	}
+
+	now := c.clock.Now()
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if ba, bb := borrowed[a.ClusterQueue], borrowed[b.ClusterQueue]; ba != bb {
+			return ba > bb
+		}
+		if pa, pb := priority.Priority(a.Obj), priority.Priority(b.Obj); pa != pb {
+			return pa < pb
+		}
+		if ta, tb := admissionTime(a.Obj, now), admissionTime(b.Obj, now); !ta.Equal(tb) {
+			return tb.Before(ta)
+		}
+		return workload.Key(a.Obj) < workload.Key(b.Obj)
+	})
+	return candidates, nil
+}
+
+// reclaimableResources returns the resources requested by the workload, per
+// flavor, for which the ClusterQueue uses less than its nominal quota.
+func (c *ClusterQueue) reclaimableResources(wl *kueue.Workload) map[kueue.ResourceFlavorReference]sets.Set[corev1.ResourceName] {
+	requested := sets.New[corev1.ResourceName]()
+	for _, ps := range c.newWorkloadInfo(wl).TotalRequests {
+		for rName, v := range ps.Requests {
+			if v > 0 {
+				requested.Insert(rName)
+			}
+		}
+	}
+	reclaimable := make(map[kueue.ResourceFlavorReference]sets.Set[corev1.ResourceName])
+	for _, rg := range c.ResourceGroups {
+		for _, flvQuotas := range rg.Flavors {
+			for rName, rQuota := range flvQuotas.Resources {
+				if !requested.Has(rName) || c.Usage[flvQuotas.Name][rName] >= rQuota.Nominal {
+					continue
+				}
+				if reclaimable[flvQuotas.Name] == nil {
+					reclaimable[flvQuotas.Name] = sets.New[corev1.ResourceName]()
+				}
+				reclaimable[flvQuotas.Name].Insert(rName)
+			}
+		}
+	}
+	return reclaimable
+}
+
+// borrowedIn returns the total usage above the nominal quota of the given
+// resources.
+func (c *ClusterQueue) borrowedIn(resources map[kueue.ResourceFlavorReference]sets.Set[corev1.ResourceName]) int64 {
+	var borrowed int64
+	for fName, rNames := range resources {
+		for rName := range rNames {
+			var nominal int64
+			if rQuota := c.resourceQuota(fName, rName); rQuota != nil {
+				nominal = rQuota.Nominal
+			}
+			if b := c.Usage[fName][rName] - nominal; b > 0 {
+				borrowed += b
+			}
+		}
+	}
+	return borrowed
+}
+
+func usesAnyResource(wi *workload.Info, resources map[kueue.ResourceFlavorReference]sets.Set[corev1.ResourceName]) bool {
+	for _, ps := range wi.TotalRequests {
+		for rName, fName := range ps.Flavors {
+			if resources[fName].Has(rName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// admissionTime returns the time when the workload was admitted, or now if
+// the Admitted condition is not populated yet.
+func admissionTime(wl *kueue.Workload, now time.Time) time.Time {
+	cond := apimeta.FindStatusCondition(wl.Status.Conditions, kueue.WorkloadAdmitted)
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		return now
+	}
+	return cond.LastTransitionTime.Time
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+func TestCohortReclaimCandidates(t *testing.T) {
+	member := func(name string, nominal string, reclaim kueue.PreemptionPolicy) *kueue.ClusterQueue {
+		return utiltesting.MakeClusterQueue(name).
+			Cohort("one").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, nominal).Obj()).
+			Preemption(kueue.ClusterQueuePreemption{
+				ReclaimWithinCohort: reclaim,
+				WithinClusterQueue:  kueue.PreemptionPolicyNever,
+			}).
+			Obj()
+	}
+	admitted := func(name, cq string, prio int32, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Priority(prio).
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission(cq).Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+	otherMembers := []*kueue.ClusterQueue{
+		member("borrowing", "5", kueue.PreemptionPolicyNever),
+		member("borrowing-less", "5", kueue.PreemptionPolicyNever),
+		member("not-borrowing", "5", kueue.PreemptionPolicyNever),
+	}
+	otherWorkloads := []*kueue.Workload{
+		admitted("b1", "borrowing", 0, "4"),
+		admitted("b2", "borrowing", 5, "5"),
+		admitted("l1", "borrowing-less", 0, "6"),
+		admitted("n1", "not-borrowing", 0, "3"),
+	}
+	preemptor := utiltesting.MakeWorkload("preemptor", "ns").
+		Priority(3).
+		Request(corev1.ResourceCPU, "4").
+		Obj()
+
+	aliasPreemptor := utiltesting.MakeWorkload("preemptor", "ns").
+		Request("example.com/cpu", "4").
+		Obj()
+
+	cases := map[string]struct {
+		cq        *kueue.ClusterQueue
+		preemptor *kueue.Workload
+		admitted  []*kueue.Workload
+		want      []string
+		wantError string
+	}{
+		"reclaim lower priority": {
+			cq:   member("a", "10", kueue.PreemptionPolicyLowerPriority),
+			want: []string{"ns/b1", "ns/l1"},
+		},
+		"reclaim any priority": {
+			cq:   member("a", "10", kueue.PreemptionPolicyAny),
+			want: []string{"ns/b1", "ns/b2", "ns/l1"},
+		},
+		"preemptor using a resource alias": {
+			cq:        member("a", "10", kueue.PreemptionPolicyAny),
+			preemptor: aliasPreemptor,
+			want:      []string{"ns/b1", "ns/b2", "ns/l1"},
+		},
+		"reclaim disabled": {
+			cq: member("a", "10", kueue.PreemptionPolicyNever),
+		},
+		"clusterQueue at its nominal quota": {
+			cq:       member("a", "10", kueue.PreemptionPolicyAny),
+			admitted: []*kueue.Workload{admitted("a1", "a", 0, "10")},
+		},
+		"unknown clusterQueue": {
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient(), WithResourceAliases(map[corev1.ResourceName]corev1.ResourceName{
+				"example.com/cpu": corev1.ResourceCPU,
+			}))
+			cqs := otherMembers
+			cqName := "nonexistent"
+			if tc.cq != nil {
+				cqs = append([]*kueue.ClusterQueue{tc.cq}, cqs...)
+				cqName = tc.cq.Name
+			}
+			for _, cq := range cqs {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			for _, wl := range append(otherWorkloads, tc.admitted...) {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", workload.Key(wl))
+				}
+			}
+			wl := preemptor
+			if tc.preemptor != nil {
+				wl = tc.preemptor
+			}
+			candidates, err := cache.CohortReclaimCandidates(cqName, wl)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			var got []string
+			for _, c := range candidates {
+				got = append(got, workload.Key(c.Obj))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected candidates (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
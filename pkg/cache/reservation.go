@@ -0,0 +1,150 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// reservationsCleanupInterval is how often CleanUpOnContext releases the
+// expired reservations.
+const reservationsCleanupInterval = time.Second
+
+// reservation is a temporary hold of quota in a ClusterQueue that isn't
+// backed by a workload.
+type reservation struct {
+	clusterQueue string
+	usage        FlavorResourceQuantities
+	expiration   time.Time
+}
+
+// ReserveQuota holds the usage in the ClusterQueue, as if it was used by an
+// admitted workload, until it's released with ReleaseReservation or the ttl
+// passes. Returns the ID of the reservation.
+func (c *Cache) ReserveQuota(cqName string, usage FlavorResourceQuantities, ttl time.Duration) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return "", errCqNotFound
+	}
+	for fName, resUsage := range usage {
+		for rName := range resUsage {
+			if cq.resourceQuota(fName, rName) == nil {
+				return "", fmt.Errorf("flavor %s doesn't provide quota for %s in the ClusterQueue", fName, rName)
+			}
+		}
+	}
+	if c.reservations == nil {
+		c.reservations = make(map[string]*reservation)
+	}
+	c.reservationsCount++
+	id := fmt.Sprintf("%s-%d", cqName, c.reservationsCount)
+	r := &reservation{
+		clusterQueue: cqName,
+		usage:        make(FlavorResourceQuantities, len(usage)),
+		expiration:   c.clock.Now().Add(ttl),
+	}
+	for fName, resUsage := range usage {
+		r.usage[fName] = make(map[corev1.ResourceName]int64, len(resUsage))
+		for rName, v := range resUsage {
+			r.usage[fName][rName] = v
+		}
+	}
+	c.reservations[id] = r
+	cq.updateReservedUsage(r.usage, 1)
+	return id, nil
+}
+
+// ReleaseReservation releases the quota held by the reservation. It's a no-op
+// if the reservation doesn't exist or already expired.
+func (c *Cache) ReleaseReservation(id string) {
+	c.Lock()
+	defer c.Unlock()
+	c.releaseReservation(id)
+}
+
+func (c *Cache) releaseReservation(id string) {
+	r, ok := c.reservations[id]
+	if !ok {
+		return
+	}
+	delete(c.reservations, id)
+	if cq, ok := c.clusterQueues[r.clusterQueue]; ok {
+		cq.updateReservedUsage(r.usage, -1)
+	}
+}
+
+// expireReservations releases the reservations past their ttl.
+func (c *Cache) expireReservations() {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.clock.Now()
+	for id, r := range c.reservations {
+		if !now.Before(r.expiration) {
+			c.releaseReservation(id)
+		}
+	}
+}
+
+// deleteReservations drops the reservations in the ClusterQueue, without
+// updating its usage.
+func (c *Cache) deleteReservations(cqName string) {
+	for id, r := range c.reservations {
+		if r.clusterQueue == cqName {
+			delete(c.reservations, id)
+		}
+	}
+}
+
+// pruneReservations drops from the reservations in the ClusterQueue the
+// flavors and resources that it no longer tracks the usage of. Their usage,
+// including the reserved quota, was discarded when they were removed from the
+// spec, so releasing them later would subtract quota that is not held.
+func (c *Cache) pruneReservations(cq *ClusterQueue) {
+	for _, r := range c.reservations {
+		if r.clusterQueue != cq.Name {
+			continue
+		}
+		for fName, resUsage := range r.usage {
+			for rName := range resUsage {
+				if _, ok := cq.Usage[fName][rName]; !ok {
+					delete(resUsage, rName)
+				}
+			}
+			if len(resUsage) == 0 {
+				delete(r.usage, fName)
+			}
+		}
+	}
+}
+
+func (c *ClusterQueue) updateReservedUsage(usage FlavorResourceQuantities, m int64) {
+	for fName, resUsage := range usage {
+		for rName, v := range resUsage {
+			if _, ok := c.Usage[fName][rName]; ok {
+				c.Usage[fName][rName] += v * m
+			}
+		}
+	}
+	c.reportUsage()
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	testingclock "k8s.io/utils/clock/testing"
+
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+func TestReserveQuota(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	wl := workload.NewInfo(utiltesting.MakeWorkload("wl", "ns").
+		Request(corev1.ResourceCPU, "4").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+		Obj())
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	cache := New(utiltesting.NewFakeClient())
+	cache.clock = fakeClock
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	checkFits := func(want bool) {
+		t.Helper()
+		got, err := cache.CanFit("foo", wl)
+		if err != nil {
+			t.Fatalf("CanFit failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("CanFit() = %t, want %t", got, want)
+		}
+	}
+
+	if _, err := cache.ReserveQuota("bar", nil, time.Minute); err == nil {
+		t.Error("Reserving quota in an unknown ClusterQueue succeeded")
+	}
+	if _, err := cache.ReserveQuota("foo", FlavorResourceQuantities{"spot": {corev1.ResourceCPU: 1_000}}, time.Minute); err == nil {
+		t.Error("Reserving quota in a flavor without quota succeeded")
+	}
+
+	id, err := cache.ReserveQuota("foo", FlavorResourceQuantities{"default": {corev1.ResourceCPU: 8_000}}, time.Minute)
+	if err != nil {
+		t.Fatalf("Reserving quota: %v", err)
+	}
+	if diff := cmp.Diff(FlavorResourceQuantities{"default": {corev1.ResourceCPU: 8_000}}, cache.clusterQueues["foo"].Usage); diff != "" {
+		t.Errorf("Unexpected usage with the reservation (-want,+got):\n%s", diff)
+	}
+	checkFits(false)
+
+	cache.ReleaseReservation(id)
+	checkFits(true)
+
+	if _, err := cache.ReserveQuota("foo", FlavorResourceQuantities{"default": {corev1.ResourceCPU: 8_000}}, time.Minute); err != nil {
+		t.Fatalf("Reserving quota: %v", err)
+	}
+	checkFits(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cache.CleanUpOnContext(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	if err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return fakeClock.HasWaiters(), nil
+	}); err != nil {
+		t.Fatalf("Waiting for the cleanup ticker: %v", err)
+	}
+	fakeClock.Step(time.Minute)
+	if err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return cache.CanFit("foo", wl)
+	}); err != nil {
+		t.Fatalf("Waiting for the reservation to expire: %v", err)
+	}
+}
+
+func TestReservationAcrossClusterQueueUpdate(t *testing.T) {
+	withSpot := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(
+			*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj(),
+			*utiltesting.MakeFlavorQuotas("spot").Resource(corev1.ResourceCPU, "10").Obj(),
+		).
+		Obj()
+	withoutSpot := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	cache := New(utiltesting.NewFakeClient())
+	if err := cache.AddClusterQueue(context.Background(), withSpot); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	id, err := cache.ReserveQuota("foo", FlavorResourceQuantities{
+		"default": {corev1.ResourceCPU: 2_000},
+		"spot":    {corev1.ResourceCPU: 3_000},
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("Reserving quota: %v", err)
+	}
+
+	if _, err := cache.UpdateClusterQueue(withoutSpot); err != nil {
+		t.Fatalf("Updating ClusterQueue: %v", err)
+	}
+	if diff := cmp.Diff(FlavorResourceQuantities{"default": {corev1.ResourceCPU: 2_000}}, cache.clusterQueues["foo"].Usage); diff != "" {
+		t.Errorf("Unexpected usage after removing the flavor (-want,+got):\n%s", diff)
+	}
+	if _, err := cache.UpdateClusterQueue(withSpot); err != nil {
+		t.Fatalf("Updating ClusterQueue: %v", err)
+	}
+
+	cache.ReleaseReservation(id)
+	wantUsage := FlavorResourceQuantities{
+		"default": {corev1.ResourceCPU: 0},
+		"spot":    {corev1.ResourceCPU: 0},
+	}
+	if diff := cmp.Diff(wantUsage, cache.clusterQueues["foo"].Usage); diff != "" {
+		t.Errorf("Unexpected usage after releasing the reservation (-want,+got):\n%s", diff)
+	}
+}
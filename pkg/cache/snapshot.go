@@ -74,6 +74,8 @@ func (c *Cache) Snapshot() Snapshot {
 	}
 	for _, cohort := range c.cohorts {
 		cohortCopy := newCohort(cohort.Name, cohort.Members.Len())
+		// Shallow copy is enough, the ceiling is replaced as a whole.
+		cohortCopy.BorrowCeiling = cohort.BorrowCeiling
 		for cq := range cohort.Members {
 			if cq.Active() {
 				cqCopy := snap.ClusterQueues[cq.Name]
@@ -98,6 +100,21 @@ func (c *ClusterQueue) snapshot() *ClusterQueue {
 		Preemption:        c.Preemption,
 		NamespaceSelector: c.NamespaceSelector,
 		Status:            c.Status,
+
+		MinBorrowingPriority: c.MinBorrowingPriority,
+		SelfReserve:          c.SelfReserve, // Shallow copy is enough.
+		BorrowingPriority:    c.BorrowingPriority,
+		MinWorkloadSize:      c.MinWorkloadSize, // Shallow copy is enough.
+		MaxWorkloadSize:      c.MaxWorkloadSize, // Shallow copy is enough.
+		AdaptiveBorrowing:    c.AdaptiveBorrowing,
+		BorrowScope:          c.BorrowScope,
+		Headroom:             c.Headroom, // Shallow copy is enough.
+		MaxAdmittedWorkloads: c.MaxAdmittedWorkloads,
+
+		ReclaimableCheckPriority: c.ReclaimableCheckPriority,
+		NamespaceCaps:            c.NamespaceCaps, // Shallow copy is enough.
+		resourceAliases:          c.resourceAliases,
+		quotaMode:                c.quotaMode,
 	}
 	for fName, rUsage := range c.Usage {
 		rUsageCopy := make(map[corev1.ResourceName]int64, len(rUsage))
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"time"
+
+	"sigs.k8s.io/kueue/pkg/metrics"
+)
+
+// pendingStatus is a status change waiting for the debounce to pass before
+// it's notified.
+type pendingStatus struct {
+	status metrics.ClusterQueueStatus
+	since  time.Time
+}
+
+// statusChanged wakes up the waiters for the ClusterQueue to be active and
+// notifies the status change handler if the status of the ClusterQueue is no
+// longer prevStatus, right away or, with a debounce, once the status is stable.
+func (c *Cache) statusChanged(cq *ClusterQueue, prevStatus metrics.ClusterQueueStatus) {
+	if cq.Status == active && prevStatus != active {
+		c.activeCond.Broadcast()
+	}
+	if c.statusHandler == nil || cq.Status == prevStatus {
+		return
+	}
+	if c.statusDebounce == 0 {
+		c.statusHandler(cq.Name, cq.Status)
+		return
+	}
+	if c.pendingStatuses == nil {
+		c.pendingStatuses = make(map[string]pendingStatus)
+		c.notifiedStatuses = make(map[string]metrics.ClusterQueueStatus)
+	}
+	if _, ok := c.notifiedStatuses[cq.Name]; !ok {
+		c.notifiedStatuses[cq.Name] = prevStatus
+	}
+	c.pendingStatuses[cq.Name] = pendingStatus{status: cq.Status, since: c.clock.Now()}
+}
+
+// flushStatusChanges notifies the status changes that have been stable for
+// the debounce duration and that differ from the last notified status.
+func (c *Cache) flushStatusChanges() {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.clock.Now()
+	for name, p := range c.pendingStatuses {
+		if now.Sub(p.since) < c.statusDebounce {
+			continue
+		}
+		delete(c.pendingStatuses, name)
+		notified := c.notifiedStatuses[name]
+		delete(c.notifiedStatuses, name)
+		if p.status != notified {
+			c.statusHandler(name, p.status)
+		}
+	}
+}
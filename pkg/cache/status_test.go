@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/kueue/pkg/metrics"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+)
+
+func TestStatusChangeNotifications(t *testing.T) {
+	cq := utiltesting.MakeClusterQueue("cq").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Obj()
+	rf := utiltesting.MakeResourceFlavor("default").Obj()
+
+	cases := map[string]struct {
+		debounce           time.Duration
+		flips              int
+		wantBeforeDebounce []string
+		wantAfterDebounce  []string
+	}{
+		"without debounce": {
+			flips:              3,
+			wantBeforeDebounce: []string{"cq=pending", "cq=active", "cq=pending"},
+			wantAfterDebounce:  []string{"cq=pending", "cq=active", "cq=pending"},
+		},
+		"debounced flapping": {
+			debounce:          time.Minute,
+			flips:             3,
+			wantAfterDebounce: []string{"cq=pending"},
+		},
+		"debounced flapping back to the notified status": {
+			debounce: time.Minute,
+			flips:    2,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			handler := func(cqName string, status metrics.ClusterQueueStatus) {
+				got = append(got, cqName+"="+string(status))
+			}
+			fakeClock := testingclock.NewFakeClock(time.Now())
+			cache := New(utiltesting.NewFakeClient(), WithStatusChangeHandler(handler), WithStatusDebounce(tc.debounce))
+			cache.clock = fakeClock
+			cache.AddOrUpdateResourceFlavor(rf)
+			if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+				t.Fatalf("Adding ClusterQueue: %v", err)
+			}
+			for i := 0; i < tc.flips; i++ {
+				if i%2 == 0 {
+					cache.DeleteResourceFlavor(rf)
+				} else {
+					cache.AddOrUpdateResourceFlavor(rf)
+				}
+				fakeClock.Step(time.Second)
+			}
+			cache.flushStatusChanges()
+			if diff := cmp.Diff(tc.wantBeforeDebounce, got); diff != "" {
+				t.Errorf("Unexpected notifications before the debounce (-want,+got):\n%s", diff)
+			}
+			fakeClock.Step(tc.debounce)
+			cache.flushStatusChanges()
+			if diff := cmp.Diff(tc.wantAfterDebounce, got); diff != "" {
+				t.Errorf("Unexpected notifications after the debounce (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
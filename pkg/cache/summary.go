@@ -0,0 +1,278 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/metrics"
+)
+
+// ClusterQueueSummary is a copy of the quota and usage of a ClusterQueue.
+// The Status tells apart the ClusterQueues that can't admit workloads, like
+// the pending ones.
+type ClusterQueueSummary struct {
+	Name    string
+	Status  metrics.ClusterQueueStatus
+	Nominal FlavorResourceQuantities
+	Usage   FlavorResourceQuantities
+}
+
+// ListClusterQueuesInCohort returns the summaries of the members of the
+// cohort, sorted by name.
+func (c *Cache) ListClusterQueuesInCohort(cohortName string) ([]ClusterQueueSummary, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cohort, ok := c.cohorts[cohortName]
+	if !ok {
+		return nil, errCohortNotFound
+	}
+	summaries := make([]ClusterQueueSummary, 0, cohort.Members.Len())
+	for cq := range cohort.Members {
+		summaries = append(summaries, cq.summary())
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries, nil
+}
+
+func (c *ClusterQueue) summary() ClusterQueueSummary {
+	s := ClusterQueueSummary{
+		Name:    c.Name,
+		Status:  c.Status,
+		Nominal: make(FlavorResourceQuantities),
+		Usage:   make(FlavorResourceQuantities, len(c.Usage)),
+	}
+	for _, rg := range c.ResourceGroups {
+		for _, flvQuotas := range rg.Flavors {
+			resNominal := make(map[corev1.ResourceName]int64, len(flvQuotas.Resources))
+			for rName, rQuota := range flvQuotas.Resources {
+				resNominal[rName] = rQuota.Nominal
+			}
+			s.Nominal[flvQuotas.Name] = resNominal
+		}
+	}
+	for fName, resUsage := range c.Usage {
+		resUsageCopy := make(map[corev1.ResourceName]int64, len(resUsage))
+		for rName, v := range resUsage {
+			resUsageCopy[rName] = v
+		}
+		s.Usage[fName] = resUsageCopy
+	}
+	return s
+}
+
+// CohortSummary is an overview of the quota and usage of a cohort. Like in
+// CohortCapacity, the Capacity only includes the nominal quota of the active
+// members, while the Usage includes all the members.
+type CohortSummary struct {
+	Name     string
+	Members  int
+	Capacity FlavorResourceQuantities
+	Usage    FlavorResourceQuantities
+}
+
+// ListCohorts returns the summaries of the cohorts with members, sorted by
+// name.
+func (c *Cache) ListCohorts() []CohortSummary {
+	c.RLock()
+	defer c.RUnlock()
+
+	summaries := make([]CohortSummary, 0, len(c.cohorts))
+	for name, cohort := range c.cohorts {
+		if cohort.Members.Len() == 0 {
+			continue
+		}
+		s := CohortSummary{
+			Name:     name,
+			Members:  cohort.Members.Len(),
+			Capacity: cohortCapacity(cohort),
+			Usage:    make(FlavorResourceQuantities),
+		}
+		for cq := range cohort.Members {
+			for fName, resUsage := range cq.Usage {
+				for rName, v := range resUsage {
+					addQuantity(s.Usage, fName, rName, v)
+				}
+			}
+		}
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
+
+// FlavorUtilization is the utilization of a flavor across all the
+// ClusterQueues, as the ratio between the usage and the nominal quota of its
+// most utilized resource.
+type FlavorUtilization struct {
+	Name        string
+	Resource    corev1.ResourceName
+	Utilization float64
+}
+
+// HottestFlavors returns the topN most utilized flavors across all the
+// ClusterQueues, sorted by decreasing utilization and then by name, to spot
+// where capacity is most needed. The resources without nominal quota in any
+// ClusterQueue are ignored, and so are the flavors with none of them. A
+// non-positive topN returns all the flavors.
+func (c *Cache) HottestFlavors(topN int) []FlavorUtilization {
+	c.RLock()
+	defer c.RUnlock()
+
+	nominal := make(FlavorResourceQuantities)
+	usage := make(FlavorResourceQuantities)
+	for _, cq := range c.clusterQueues {
+		for _, rg := range cq.ResourceGroups {
+			for _, flvQuotas := range rg.Flavors {
+				for rName, rQuota := range flvQuotas.Resources {
+					addQuantity(nominal, flvQuotas.Name, rName, rQuota.Nominal)
+				}
+			}
+		}
+		for fName, resUsage := range cq.Usage {
+			for rName, v := range resUsage {
+				addQuantity(usage, fName, rName, v)
+			}
+		}
+	}
+
+	utilizations := make([]FlavorUtilization, 0, len(nominal))
+	for fName, resNominal := range nominal {
+		var hottest *FlavorUtilization
+		for _, rName := range sortedKeys(resNominal) {
+			if resNominal[rName] == 0 {
+				continue
+			}
+			ratio := float64(usage[fName][rName]) / float64(resNominal[rName])
+			if hottest == nil || ratio > hottest.Utilization {
+				hottest = &FlavorUtilization{Name: string(fName), Resource: rName, Utilization: ratio}
+			}
+		}
+		if hottest != nil {
+			utilizations = append(utilizations, *hottest)
+		}
+	}
+	sort.Slice(utilizations, func(i, j int) bool {
+		if utilizations[i].Utilization != utilizations[j].Utilization {
+			return utilizations[i].Utilization > utilizations[j].Utilization
+		}
+		return utilizations[i].Name < utilizations[j].Name
+	})
+	if topN > 0 && len(utilizations) > topN {
+		utilizations = utilizations[:topN]
+	}
+	return utilizations
+}
+
+// CQView is a copy of the quotas and usage of a ClusterQueue that the
+// scheduler needs to evaluate workloads for it, so that it can be read
+// without holding the cache lock.
+type CQView struct {
+	Name    string
+	Cohort  string
+	Nominal FlavorResourceQuantities
+	Usage   FlavorResourceQuantities
+	// BorrowingLimits holds the resources with a borrowing limit, per flavor.
+	// The resources missing from it can borrow without limit.
+	BorrowingLimits FlavorResourceQuantities
+	// CohortAvailable is the unused quota in the cohort that the ClusterQueue
+	// can use, per flavor and resource. It's nil without a cohort.
+	CohortAvailable FlavorResourceQuantities
+}
+
+// SchedulingView returns a copy of the quotas and usage of the ClusterQueue,
+// along with the quota available in its cohort.
+func (c *Cache) SchedulingView(cqName string) (*CQView, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	summary := cq.summary()
+	view := &CQView{
+		Name:            cq.Name,
+		Nominal:         summary.Nominal,
+		Usage:           summary.Usage,
+		BorrowingLimits: make(FlavorResourceQuantities),
+	}
+	if cq.Cohort != nil {
+		view.Cohort = cq.Cohort.Name
+		view.CohortAvailable = make(FlavorResourceQuantities)
+	}
+	for _, rg := range cq.ResourceGroups {
+		for _, flvQuotas := range rg.Flavors {
+			for rName, rQuota := range flvQuotas.Resources {
+				if rQuota.BorrowingLimit != nil {
+					addQuantity(view.BorrowingLimits, flvQuotas.Name, rName, *rQuota.BorrowingLimit)
+				}
+				if cq.Cohort != nil {
+					addQuantity(view.CohortAvailable, flvQuotas.Name, rName, cq.cohortAvailable(flvQuotas.Name, rName))
+				}
+			}
+		}
+	}
+	return view, nil
+}
+
+// ClusterQueueInfo is a copy of the public fields of a ClusterQueue that
+// doesn't share memory with the cache, so it isn't affected by later changes
+// in the cache. The cohort is referenced by name.
+type ClusterQueueInfo struct {
+	Name              string
+	Cohort            string
+	Status            metrics.ClusterQueueStatus
+	ResourceGroups    []ResourceGroup
+	Usage             FlavorResourceQuantities
+	Preemption        kueue.ClusterQueuePreemption
+	NamespaceSelector labels.Selector
+}
+
+// GetClusterQueue returns a copy of the ClusterQueue, and whether it exists.
+func (c *Cache) GetClusterQueue(name string) (*ClusterQueueInfo, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[name]
+	if !ok {
+		return nil, false
+	}
+	info := &ClusterQueueInfo{
+		Name:           cq.Name,
+		Status:         cq.Status,
+		ResourceGroups: copyResourceGroups(cq.ResourceGroups),
+		Usage:          copyQuantities(cq.Usage),
+		Preemption:     cq.Preemption,
+	}
+	if cq.Cohort != nil {
+		info.Cohort = cq.Cohort.Name
+	}
+	if cq.NamespaceSelector != nil {
+		info.NamespaceSelector = cq.NamespaceSelector.DeepCopySelector()
+	}
+	return info, true
+}
@@ -0,0 +1,500 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/metrics"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+)
+
+func TestListClusterQueuesInCohort(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "15").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("c").
+			Cohort("two").
+			Obj(),
+		utiltesting.MakeClusterQueue("d").
+			Obj(),
+		utiltesting.MakeClusterQueue("e").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("nonexistent-flavor").Resource(corev1.ResourceCPU, "15").Obj()).
+			Cohort("two").
+			Obj(),
+	}
+	wl := utiltesting.MakeWorkload("wl", "ns").
+		Request(corev1.ResourceCPU, "12").
+		Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "default", "12").Obj()).
+		Obj()
+
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatal("Failed adding workload")
+	}
+
+	cases := map[string]struct {
+		cohort    string
+		want      []ClusterQueueSummary
+		wantError string
+	}{
+		"cohort one": {
+			cohort: "one",
+			want: []ClusterQueueSummary{
+				{
+					Name:    "a",
+					Status:  active,
+					Nominal: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 10_000}},
+					Usage:   FlavorResourceQuantities{"default": {corev1.ResourceCPU: 12_000}},
+				},
+				{
+					Name:    "b",
+					Status:  active,
+					Nominal: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 15_000}},
+					Usage:   FlavorResourceQuantities{"default": {corev1.ResourceCPU: 0}},
+				},
+			},
+		},
+		"cohort two with a pending clusterQueue": {
+			cohort: "two",
+			want: []ClusterQueueSummary{
+				{
+					Name:    "c",
+					Status:  active,
+					Nominal: FlavorResourceQuantities{},
+					Usage:   FlavorResourceQuantities{},
+				},
+				{
+					Name:    "e",
+					Status:  pending,
+					Nominal: FlavorResourceQuantities{"nonexistent-flavor": {corev1.ResourceCPU: 15_000}},
+					Usage:   FlavorResourceQuantities{"nonexistent-flavor": {corev1.ResourceCPU: 0}},
+				},
+			},
+		},
+		"unknown cohort": {
+			cohort:    "three",
+			wantError: errCohortNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := cache.ListClusterQueuesInCohort(tc.cohort)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected summaries (-want,+got):\n%s", diff)
+			}
+		})
+	}
+
+	// The summaries are copies.
+	got, _ := cache.ListClusterQueuesInCohort("one")
+	got[0].Usage["default"][corev1.ResourceCPU] = 0
+	if used := cache.clusterQueues["a"].Usage["default"][corev1.ResourceCPU]; used != 12_000 {
+		t.Errorf("Modifying the summary changed the usage in the cache to %d", used)
+	}
+}
+
+func TestListCohorts(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "10").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "15").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("c").
+			Cohort("two").
+			Obj(),
+		utiltesting.MakeClusterQueue("d").
+			Obj(),
+		// Pending, as the flavor doesn't exist.
+		utiltesting.MakeClusterQueue("e").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("nonexistent-flavor").Resource(corev1.ResourceCPU, "15").Obj()).
+			Cohort("two").
+			Obj(),
+		utiltesting.MakeClusterQueue("f").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "5").Obj()).
+			Cohort("three").
+			Obj(),
+	}
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	wl := utiltesting.MakeWorkload("a-wl", "ns").
+		Request(corev1.ResourceCPU, "12").
+		Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "default", "12").Obj()).
+		Obj()
+	if !cache.AddOrUpdateWorkload(wl) {
+		t.Fatalf("Workload %s was not added", wl.Name)
+	}
+	// Cohort three is left without members.
+	cache.DeleteClusterQueue(clusterQueues[5])
+
+	want := []CohortSummary{
+		{
+			Name:     "one",
+			Members:  2,
+			Capacity: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 25_000}},
+			Usage:    FlavorResourceQuantities{"default": {corev1.ResourceCPU: 12_000}},
+		},
+		{
+			// The pending ClusterQueue e counts as a member, but its quota
+			// isn't part of the capacity, like in CohortCapacity.
+			Name:     "two",
+			Members:  2,
+			Capacity: FlavorResourceQuantities{},
+			Usage:    FlavorResourceQuantities{"nonexistent-flavor": {corev1.ResourceCPU: 0}},
+		},
+	}
+	if diff := cmp.Diff(want, cache.ListCohorts()); diff != "" {
+		t.Errorf("Unexpected cohorts (-want,+got):\n%s", diff)
+	}
+	capacity, err := cache.CohortCapacity("two")
+	if err != nil {
+		t.Fatalf("Getting the capacity of cohort two: %v", err)
+	}
+	if diff := cmp.Diff(want[1].Capacity, capacity); diff != "" {
+		t.Errorf("Unexpected capacity of cohort two (-want,+got):\n%s", diff)
+	}
+}
+
+func TestHottestFlavors(t *testing.T) {
+	cache := New(utiltesting.NewFakeClient())
+	for _, rf := range []string{"alpha", "beta", "gamma", "delta", "epsilon"} {
+		cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor(rf).Obj())
+	}
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("alpha").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("alpha").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("c").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("beta").
+				Resource(corev1.ResourceCPU, "4").
+				Resource(corev1.ResourceMemory, "10").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("d").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("gamma").Resource(corev1.ResourceCPU, "4").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("e").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("delta").Resource(corev1.ResourceCPU, "0").Obj()).
+			Obj(),
+		utiltesting.MakeClusterQueue("f").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("epsilon").Resource(corev1.ResourceCPU, "10").Obj()).
+			Obj(),
+	}
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	workloads := []*kueue.Workload{
+		utiltesting.MakeWorkload("a-wl", "ns").
+			Request(corev1.ResourceCPU, "5").
+			Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "alpha", "5").Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("c-wl", "ns").
+			Request(corev1.ResourceCPU, "3").
+			Request(corev1.ResourceMemory, "2").
+			Admit(utiltesting.MakeAdmission("c").
+				Assignment(corev1.ResourceCPU, "beta", "3").
+				Assignment(corev1.ResourceMemory, "beta", "2").Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("d-wl", "ns").
+			Request(corev1.ResourceCPU, "3").
+			Admit(utiltesting.MakeAdmission("d").Assignment(corev1.ResourceCPU, "gamma", "3").Obj()).
+			Obj(),
+	}
+	for _, wl := range workloads {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Workload %s was not added", wl.Name)
+		}
+	}
+
+	// The delta flavor has no nominal quota, so it's excluded.
+	all := []FlavorUtilization{
+		{Name: "beta", Resource: corev1.ResourceCPU, Utilization: 0.75},
+		{Name: "gamma", Resource: corev1.ResourceCPU, Utilization: 0.75},
+		{Name: "alpha", Resource: corev1.ResourceCPU, Utilization: 0.25},
+		{Name: "epsilon", Resource: corev1.ResourceCPU, Utilization: 0},
+	}
+	cases := map[string]struct {
+		topN int
+		want []FlavorUtilization
+	}{
+		"top 2": {
+			topN: 2,
+			want: all[:2],
+		},
+		"top 3": {
+			topN: 3,
+			want: all[:3],
+		},
+		"more than the flavors": {
+			topN: 10,
+			want: all,
+		},
+		"all": {
+			want: all,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, cache.HottestFlavors(tc.topN)); diff != "" {
+				t.Errorf("Unexpected flavors (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSchedulingView(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "10", "5").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+				Resource(corev1.ResourceCPU, "15").
+				Resource(corev1.ResourceMemory, "10Gi").
+				Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("standalone").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "4", "2").Obj()).
+			Obj(),
+	}
+	workloads := []*kueue.Workload{
+		utiltesting.MakeWorkload("a-wl", "ns").
+			Request(corev1.ResourceCPU, "12").
+			Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "default", "12").Obj()).
+			Obj(),
+		utiltesting.MakeWorkload("b-wl", "ns").
+			Request(corev1.ResourceCPU, "3").
+			Request(corev1.ResourceMemory, "1Gi").
+			Admit(utiltesting.MakeAdmission("b").
+				Assignment(corev1.ResourceCPU, "default", "3").
+				Assignment(corev1.ResourceMemory, "default", "1Gi").
+				Obj()).
+			Obj(),
+	}
+
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	for _, cq := range clusterQueues {
+		if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+			t.Fatalf("Adding ClusterQueue: %v", err)
+		}
+	}
+	for _, wl := range workloads {
+		if !cache.AddOrUpdateWorkload(wl) {
+			t.Fatalf("Workload %s was not added", wl.Name)
+		}
+	}
+
+	cases := map[string]struct {
+		cq        string
+		want      *CQView
+		wantError string
+	}{
+		"member of a cohort": {
+			cq: "a",
+			want: &CQView{
+				Name:   "a",
+				Cohort: "one",
+				Nominal: FlavorResourceQuantities{
+					"default": {corev1.ResourceCPU: 10_000, corev1.ResourceMemory: 10 * 1024 * 1024 * 1024},
+				},
+				Usage: FlavorResourceQuantities{
+					"default": {corev1.ResourceCPU: 12_000, corev1.ResourceMemory: 0},
+				},
+				BorrowingLimits: FlavorResourceQuantities{
+					"default": {corev1.ResourceCPU: 5_000},
+				},
+				CohortAvailable: FlavorResourceQuantities{
+					"default": {corev1.ResourceCPU: 10_000, corev1.ResourceMemory: 19 * 1024 * 1024 * 1024},
+				},
+			},
+		},
+		"without cohort": {
+			cq: "standalone",
+			want: &CQView{
+				Name:            "standalone",
+				Nominal:         FlavorResourceQuantities{"default": {corev1.ResourceCPU: 4_000}},
+				Usage:           FlavorResourceQuantities{"default": {corev1.ResourceCPU: 0}},
+				BorrowingLimits: FlavorResourceQuantities{"default": {corev1.ResourceCPU: 2_000}},
+			},
+		},
+		"unknown clusterQueue": {
+			cq:        "nonexistent",
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := cache.SchedulingView(tc.cq)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected view (-want,+got):\n%s", diff)
+			}
+			if got == nil {
+				return
+			}
+			cq := cache.clusterQueues[tc.cq]
+			if diff := cmp.Diff(cq.Usage, got.Usage); diff != "" {
+				t.Errorf("View usage differs from the ClusterQueue usage (-cache,+view):\n%s", diff)
+			}
+			for _, rg := range cq.ResourceGroups {
+				for _, flvQuotas := range rg.Flavors {
+					for rName, rQuota := range flvQuotas.Resources {
+						if nominal := got.Nominal[flvQuotas.Name][rName]; nominal != rQuota.Nominal {
+							t.Errorf("View nominal quota for %s in flavor %s is %d, want %d", rName, flvQuotas.Name, nominal, rQuota.Nominal)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGetClusterQueue(t *testing.T) {
+	preemption := kueue.ClusterQueuePreemption{
+		ReclaimWithinCohort: kueue.PreemptionPolicyAny,
+		WithinClusterQueue:  kueue.PreemptionPolicyLowerPriority,
+	}
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "5").Obj()).
+		Cohort("one").
+		NamespaceSelector(&metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}).
+		Preemption(preemption).
+		Obj()
+	admitted := func(name, cpu string) *kueue.Workload {
+		return utiltesting.MakeWorkload(name, "ns").
+			Request(corev1.ResourceCPU, cpu).
+			Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", cpu).Obj()).
+			Obj()
+	}
+
+	cache := New(utiltesting.NewFakeClient())
+	cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+	if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+		t.Fatalf("Adding ClusterQueue: %v", err)
+	}
+	if !cache.AddOrUpdateWorkload(admitted("a", "2")) {
+		t.Fatal("Workload a was not added")
+	}
+
+	if _, found := cache.GetClusterQueue("bar"); found {
+		t.Error("Found unknown ClusterQueue bar")
+	}
+	got, found := cache.GetClusterQueue("foo")
+	if !found {
+		t.Fatal("ClusterQueue foo not found")
+	}
+	want := &ClusterQueueInfo{
+		Name:   "foo",
+		Cohort: "one",
+		Status: metrics.CQStatusActive,
+		ResourceGroups: []ResourceGroup{{
+			CoveredResources: sets.New(corev1.ResourceCPU),
+			Flavors: []FlavorQuotas{{
+				Name: "default",
+				Resources: map[corev1.ResourceName]*ResourceQuota{
+					corev1.ResourceCPU: {Nominal: 10_000, BorrowingLimit: pointer.Int64(5_000)},
+				},
+			}},
+		}},
+		Usage:      FlavorResourceQuantities{"default": {corev1.ResourceCPU: 2_000}},
+		Preemption: preemption,
+	}
+	opts := []cmp.Option{
+		cmpopts.EquateEmpty(),
+		cmpopts.IgnoreFields(ClusterQueueInfo{}, "NamespaceSelector"),
+	}
+	if diff := cmp.Diff(want, got, opts...); diff != "" {
+		t.Errorf("Unexpected ClusterQueue (-want,+got):\n%s", diff)
+	}
+	if got.NamespaceSelector.String() != "team=a" {
+		t.Errorf("Got namespace selector %q, want %q", got.NamespaceSelector.String(), "team=a")
+	}
+
+	// Changes in the cache don't affect the copy.
+	if !cache.AddOrUpdateWorkload(admitted("b", "3")) {
+		t.Fatal("Workload b was not added")
+	}
+	if err := cache.OverrideFlavorQuota("foo", "default", corev1.ResourceCPU, 20_000, time.Hour); err != nil {
+		t.Fatalf("Overriding quota: %v", err)
+	}
+	if _, err := cache.UpdateClusterQueue(utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10", "5").Obj()).
+		Cohort("two").
+		Obj()); err != nil {
+		t.Fatalf("Updating ClusterQueue: %v", err)
+	}
+	if diff := cmp.Diff(want, got, opts...); diff != "" {
+		t.Errorf("Copy changed after updating the cache (-want,+got):\n%s", diff)
+	}
+
+	// Changes in the copy don't affect the cache.
+	got.Usage["default"][corev1.ResourceCPU] = 0
+	got.ResourceGroups[0].Flavors[0].Resources[corev1.ResourceCPU].Nominal = 0
+	cqImpl := cache.clusterQueues["foo"]
+	if used := cqImpl.Usage["default"][corev1.ResourceCPU]; used != 5_000 {
+		t.Errorf("Got usage %d in the cache, want 5000", used)
+	}
+	if nominal := cqImpl.resourceQuota("default", corev1.ResourceCPU).Nominal; nominal != 20_000 {
+		t.Errorf("Got nominal quota %d in the cache, want 20000", nominal)
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	"sigs.k8s.io/kueue/pkg/util/priority"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+// TraceCheck identifies a check performed by TraceAdmission.
+type TraceCheck string
+
+const (
+	// TraceCheckActive verifies that the ClusterQueue is active.
+	TraceCheckActive TraceCheck = "ClusterQueueActive"
+	// TraceCheckConcurrencyLimit verifies that the ClusterQueue has fewer
+	// admitted workloads than its MaxAdmittedWorkloads. It's only performed
+	// for ClusterQueues with a limit.
+	TraceCheckConcurrencyLimit TraceCheck = "ConcurrencyLimit"
+	// TraceCheckNamespace verifies that the ClusterQueue's namespaceSelector
+	// matches the workload's namespace.
+	TraceCheckNamespace TraceCheck = "NamespaceSelector"
+	// TraceCheckWorkloadSize verifies that the workload is within the size
+	// bounds of the ClusterQueue. It's only performed for ClusterQueues with
+	// bounds.
+	TraceCheckWorkloadSize TraceCheck = "WorkloadSize"
+	// TraceCheckFlavorCoverage verifies that the ClusterQueue provides quota
+	// for a resource requested by the workload, in the assigned flavor.
+	TraceCheckFlavorCoverage TraceCheck = "FlavorCoverage"
+	// TraceCheckUsageCap verifies that the request fits under the usage cap
+	// of the resource in the flavor. It's only performed for resources with a
+	// cap.
+	TraceCheckUsageCap TraceCheck = "UsageCap"
+	// TraceCheckNamespaceCap verifies that the request fits under the cap of
+	// the workload namespace. It's only performed for namespaces with a cap
+	// for the resource in the flavor.
+	TraceCheckNamespaceCap TraceCheck = "NamespaceCap"
+	// TraceCheckQuota verifies that the request fits in the unused nominal
+	// quota of the ClusterQueue, net of its headroom.
+	TraceCheckQuota TraceCheck = "Quota"
+	// TraceCheckBorrowing verifies that the part of the request that doesn't
+	// fit in the nominal quota can be borrowed from the cohort.
+	TraceCheckBorrowing TraceCheck = "Borrowing"
+	// TraceCheckAdmissionChecks verifies that all the admission checks of the
+	// workload, listed in AdmissionChecksAnnotation, are Ready. It's only
+	// performed for workloads with admission checks.
+	TraceCheckAdmissionChecks TraceCheck = "AdmissionChecks"
+)
+
+// AdmissionTrace is the result of evaluating the admission of a workload in a
+// ClusterQueue, listing every check performed.
+type AdmissionTrace struct {
+	ClusterQueue string
+	Workload     string
+	Admissible   bool
+	Steps        []TraceStep
+}
+
+// TraceStep is the result of a single check. Flavor, Resource, Requested and
+// Available are only populated for the checks on resources.
+type TraceStep struct {
+	Check     TraceCheck
+	Passed    bool
+	Flavor    kueue.ResourceFlavorReference
+	Resource  corev1.ResourceName
+	Requested int64
+	Available int64
+	Message   string
+}
+
+// TraceAdmission evaluates whether the workload, using the flavors assigned
+// in its admission, could be admitted by the ClusterQueue and returns every
+// check performed. The checks on the quota are the ones of CanFit. The cache
+// is not modified. If the namespace of the workload can't be read, the
+// namespace check fails.
+func (c *Cache) TraceAdmission(wl *kueue.Workload, cqName string) (*AdmissionTrace, error) {
+	var ns corev1.Namespace
+	nsErr := c.client.Get(context.Background(), types.NamespacedName{Name: wl.Namespace}, &ns)
+
+	c.RLock()
+	defer c.RUnlock()
+
+	cq, ok := c.clusterQueues[cqName]
+	if !ok {
+		return nil, errCqNotFound
+	}
+	trace := &AdmissionTrace{
+		ClusterQueue: cqName,
+		Workload:     workload.Key(wl),
+		Admissible:   true,
+	}
+	trace.add(TraceStep{
+		Check:   TraceCheckActive,
+		Passed:  cq.Active(),
+		Message: fmt.Sprintf("ClusterQueue is %s", cq.Status),
+	})
+	if cq.MaxAdmittedWorkloads != nil {
+		trace.add(TraceStep{
+			Check:     TraceCheckConcurrencyLimit,
+			Passed:    !cq.atConcurrencyLimit(),
+			Requested: 1,
+			Available: nonNegative(int64(*cq.MaxAdmittedWorkloads) - int64(len(cq.Workloads))),
+			Message:   fmt.Sprintf("%d of %d workloads admitted", len(cq.Workloads), *cq.MaxAdmittedWorkloads),
+		})
+	}
+	nsStep := TraceStep{
+		Check:   TraceCheckNamespace,
+		Passed:  nsErr == nil && cq.NamespaceSelector.Matches(labels.Set(ns.Labels)),
+		Message: fmt.Sprintf("namespace %s matches the namespaceSelector", wl.Namespace),
+	}
+	switch {
+	case nsErr != nil:
+		nsStep.Message = fmt.Sprintf("getting namespace %s: %v", wl.Namespace, nsErr)
+	case !nsStep.Passed:
+		nsStep.Message = fmt.Sprintf("namespace %s doesn't match the namespaceSelector", wl.Namespace)
+	}
+	trace.add(nsStep)
+
+	wi := cq.newWorkloadInfo(wl)
+	if len(cq.MinWorkloadSize) > 0 || len(cq.MaxWorkloadSize) > 0 {
+		sizeStep := TraceStep{
+			Check:   TraceCheckWorkloadSize,
+			Passed:  true,
+			Message: "workload is within the size bounds",
+		}
+		if err := cq.checkWorkloadSize(wi); err != nil {
+			sizeStep.Passed = false
+			sizeStep.Message = err.Error()
+		}
+		trace.add(sizeStep)
+	}
+
+	canBorrow := cq.CanBorrow(priority.Priority(wl))
+	nsCaps := cq.NamespaceCaps[wl.Namespace]
+	var nsUsage FlavorResourceQuantities
+	if len(nsCaps) > 0 {
+		nsUsage = cq.namespaceUsage(wl.Namespace)
+	}
+	usage := workloadUsage(wi)
+	for _, fName := range sortedKeys(usage) {
+		for _, rName := range sortedKeys(usage[fName]) {
+			trace.traceResource(cq, fName, rName, usage[fName][rName], canBorrow, nsCaps, nsUsage)
+		}
+	}
+	if states := admissionCheckStates(wl); len(states) > 0 {
+		trace.traceAdmissionChecks(states)
+	}
+	return trace, nil
+}
+
+func (t *AdmissionTrace) traceAdmissionChecks(states map[string]AdmissionCheckState) {
+	var notReady []string
+	for _, name := range sortedKeys(states) {
+		if states[name] != CheckStateReady {
+			notReady = append(notReady, fmt.Sprintf("%s=%s", name, states[name]))
+		}
+	}
+	step := TraceStep{
+		Check:   TraceCheckAdmissionChecks,
+		Passed:  len(notReady) == 0,
+		Message: "all the admission checks are Ready",
+	}
+	if !step.Passed {
+		step.Message = fmt.Sprintf("admission checks not Ready: %s", strings.Join(notReady, ", "))
+	}
+	t.add(step)
+}
+
+func (t *AdmissionTrace) add(step TraceStep) {
+	t.Steps = append(t.Steps, step)
+	if !step.Passed && step.Check != TraceCheckQuota {
+		// Failing the Quota check can be compensated by borrowing.
+		t.Admissible = false
+	}
+}
+
+func (t *AdmissionTrace) traceResource(cq *ClusterQueue, fName kueue.ResourceFlavorReference, rName corev1.ResourceName, val int64, canBorrow bool, nsCaps, nsUsage FlavorResourceQuantities) {
+	rQuota := cq.resourceQuota(fName, rName)
+	coverage := TraceStep{
+		Check:    TraceCheckFlavorCoverage,
+		Passed:   rQuota != nil,
+		Flavor:   fName,
+		Resource: rName,
+		Message:  fmt.Sprintf("flavor %s provides quota for %s", fName, rName),
+	}
+	if rQuota == nil {
+		coverage.Message = fmt.Sprintf("flavor %s doesn't provide quota for %s in the ClusterQueue", fName, rName)
+		t.add(coverage)
+		return
+	}
+	t.add(coverage)
+
+	used := cq.usedWithHeadroom(fName, rName)
+	if rQuota.UsageCap != nil {
+		usageCap := TraceStep{
+			Check:     TraceCheckUsageCap,
+			Passed:    used+val <= *rQuota.UsageCap,
+			Flavor:    fName,
+			Resource:  rName,
+			Requested: val,
+			Available: nonNegative(*rQuota.UsageCap - used),
+			Message:   fmt.Sprintf("%s fits under the usage cap", rName),
+		}
+		if !usageCap.Passed {
+			usageCap.Message = fmt.Sprintf("usage cap of %s in flavor %s reached", rName, fName)
+		}
+		t.add(usageCap)
+	}
+	if nsCap, found := nsCaps[fName][rName]; found {
+		nsCapStep := TraceStep{
+			Check:     TraceCheckNamespaceCap,
+			Passed:    nsUsage[fName][rName]+val <= nsCap,
+			Flavor:    fName,
+			Resource:  rName,
+			Requested: val,
+			Available: nonNegative(nsCap - nsUsage[fName][rName]),
+			Message:   fmt.Sprintf("%s fits under the namespace cap", rName),
+		}
+		if !nsCapStep.Passed {
+			nsCapStep.Message = fmt.Sprintf("namespace cap of %s in flavor %s reached", rName, fName)
+		}
+		t.add(nsCapStep)
+	}
+
+	unused := nonNegative(rQuota.Nominal - used)
+	if cq.Cohort != nil {
+		if cohortAvailable := nonNegative(cq.cohortAvailable(fName, rName)); cohortAvailable < unused {
+			unused = cohortAvailable
+		}
+	}
+	quota := TraceStep{
+		Check:     TraceCheckQuota,
+		Passed:    val <= unused,
+		Flavor:    fName,
+		Resource:  rName,
+		Requested: val,
+		Available: unused,
+		Message:   fmt.Sprintf("%s fits in the unused nominal quota", rName),
+	}
+	if quota.Passed {
+		t.add(quota)
+		return
+	}
+	quota.Message = fmt.Sprintf("insufficient unused nominal quota for %s in flavor %s", rName, fName)
+	t.add(quota)
+
+	borrowing := TraceStep{
+		Check:     TraceCheckBorrowing,
+		Flavor:    fName,
+		Resource:  rName,
+		Requested: val - unused,
+	}
+	switch {
+	case cq.Cohort == nil:
+		borrowing.Message = "ClusterQueue doesn't belong to a cohort"
+	case !canBorrow:
+		borrowing.Message = fmt.Sprintf("workload priority is below the minimum borrowing priority %d", *cq.MinBorrowingPriority)
+	default:
+		borrowing.Available = cq.availableToBorrow(fName, rName)
+		borrowing.Passed = borrowing.Requested <= borrowing.Available
+		if borrowing.Passed {
+			borrowing.Message = fmt.Sprintf("%s can be borrowed from the cohort", rName)
+		} else {
+			borrowing.Message = fmt.Sprintf("insufficient quota to borrow for %s in flavor %s", rName, fName)
+		}
+	}
+	t.add(borrowing)
+}
+
+func nonNegative(v int64) int64 {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+	"sigs.k8s.io/kueue/pkg/workload"
+)
+
+func TestTraceAdmission(t *testing.T) {
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "ns",
+			Labels: map[string]string{"team": "a"},
+		},
+	}
+	cq := utiltesting.MakeClusterQueue("foo").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").
+			Resource(corev1.ResourceCPU, "10").
+			Resource(corev1.ResourceMemory, "10Gi").
+			Resource("example.com/gpu", "2").
+			Obj()).
+		NamespaceSelector(&metav1.LabelSelector{
+			MatchLabels: map[string]string{"team": "a"},
+		}).
+		Obj()
+	limited := utiltesting.MakeClusterQueue("limited").
+		ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+		Annotation(MaxAdmittedWorkloadsAnnotation, "1").
+		Obj()
+	pendingChecks := utiltesting.MakeWorkload("wl", "ns").
+		Request(corev1.ResourceCPU, "4").
+		Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+		Obj()
+	pendingChecks.Annotations = map[string]string{AdmissionChecksAnnotation: "provision=Pending,approval=Ready"}
+	cases := map[string]struct {
+		wl        *kueue.Workload
+		cq        string
+		headroom  int64
+		admitted  []*kueue.Workload
+		want      *AdmissionTrace
+		wantError string
+	}{
+		"fails on memory": {
+			cq: "foo",
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				Request(corev1.ResourceCPU, "4").
+				Request(corev1.ResourceMemory, "12Gi").
+				Admit(utiltesting.MakeAdmission("foo").
+					Assignment(corev1.ResourceCPU, "default", "4").
+					Assignment(corev1.ResourceMemory, "default", "12Gi").
+					Obj()).
+				Obj(),
+			want: &AdmissionTrace{
+				ClusterQueue: "foo",
+				Workload:     "ns/wl",
+				Steps: []TraceStep{
+					{Check: TraceCheckActive, Passed: true},
+					{Check: TraceCheckNamespace, Passed: true},
+					{Check: TraceCheckFlavorCoverage, Passed: true, Flavor: "default", Resource: corev1.ResourceCPU},
+					{
+						Check:     TraceCheckQuota,
+						Passed:    true,
+						Flavor:    "default",
+						Resource:  corev1.ResourceCPU,
+						Requested: 4_000,
+						Available: 10_000,
+					},
+					{Check: TraceCheckFlavorCoverage, Passed: true, Flavor: "default", Resource: corev1.ResourceMemory},
+					{
+						Check:     TraceCheckQuota,
+						Flavor:    "default",
+						Resource:  corev1.ResourceMemory,
+						Requested: 12 * utiltesting.Gi,
+						Available: 10 * utiltesting.Gi,
+					},
+					{
+						Check:     TraceCheckBorrowing,
+						Flavor:    "default",
+						Resource:  corev1.ResourceMemory,
+						Requested: 2 * utiltesting.Gi,
+					},
+				},
+			},
+		},
+		"fits": {
+			cq: "foo",
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				Request(corev1.ResourceCPU, "4").
+				Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+				Obj(),
+			want: &AdmissionTrace{
+				ClusterQueue: "foo",
+				Workload:     "ns/wl",
+				Admissible:   true,
+				Steps: []TraceStep{
+					{Check: TraceCheckActive, Passed: true},
+					{Check: TraceCheckNamespace, Passed: true},
+					{Check: TraceCheckFlavorCoverage, Passed: true, Flavor: "default", Resource: corev1.ResourceCPU},
+					{
+						Check:     TraceCheckQuota,
+						Passed:    true,
+						Flavor:    "default",
+						Resource:  corev1.ResourceCPU,
+						Requested: 4_000,
+						Available: 10_000,
+					},
+				},
+			},
+		},
+		"fails on the headroom": {
+			cq:       "foo",
+			headroom: 4_000,
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				Request(corev1.ResourceCPU, "8").
+				Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "8").Obj()).
+				Obj(),
+			want: &AdmissionTrace{
+				ClusterQueue: "foo",
+				Workload:     "ns/wl",
+				Steps: []TraceStep{
+					{Check: TraceCheckActive, Passed: true},
+					{Check: TraceCheckNamespace, Passed: true},
+					{Check: TraceCheckFlavorCoverage, Passed: true, Flavor: "default", Resource: corev1.ResourceCPU},
+					{
+						Check:     TraceCheckQuota,
+						Flavor:    "default",
+						Resource:  corev1.ResourceCPU,
+						Requested: 8_000,
+						Available: 6_000,
+					},
+					{
+						Check:     TraceCheckBorrowing,
+						Flavor:    "default",
+						Resource:  corev1.ResourceCPU,
+						Requested: 2_000,
+					},
+				},
+			},
+		},
+		"fails on the concurrency limit": {
+			cq: "limited",
+			admitted: []*kueue.Workload{
+				utiltesting.MakeWorkload("other", "ns").
+					Request(corev1.ResourceCPU, "1").
+					Admit(utiltesting.MakeAdmission("limited").Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+					Obj(),
+			},
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				Request(corev1.ResourceCPU, "1").
+				Admit(utiltesting.MakeAdmission("limited").Assignment(corev1.ResourceCPU, "default", "1").Obj()).
+				Obj(),
+			want: &AdmissionTrace{
+				ClusterQueue: "limited",
+				Workload:     "ns/wl",
+				Steps: []TraceStep{
+					{Check: TraceCheckActive, Passed: true},
+					{Check: TraceCheckConcurrencyLimit, Requested: 1},
+					{Check: TraceCheckNamespace, Passed: true},
+					{Check: TraceCheckFlavorCoverage, Passed: true, Flavor: "default", Resource: corev1.ResourceCPU},
+					{
+						Check:     TraceCheckQuota,
+						Passed:    true,
+						Flavor:    "default",
+						Resource:  corev1.ResourceCPU,
+						Requested: 1_000,
+						Available: 9_000,
+					},
+				},
+			},
+		},
+		"resource alias": {
+			cq: "foo",
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				Request("nvidia.com/gpu", "1").
+				Admit(utiltesting.MakeAdmission("foo").Assignment("nvidia.com/gpu", "default", "1").Obj()).
+				Obj(),
+			want: &AdmissionTrace{
+				ClusterQueue: "foo",
+				Workload:     "ns/wl",
+				Admissible:   true,
+				Steps: []TraceStep{
+					{Check: TraceCheckActive, Passed: true},
+					{Check: TraceCheckNamespace, Passed: true},
+					{Check: TraceCheckFlavorCoverage, Passed: true, Flavor: "default", Resource: "example.com/gpu"},
+					{
+						Check:     TraceCheckQuota,
+						Passed:    true,
+						Flavor:    "default",
+						Resource:  "example.com/gpu",
+						Requested: 1,
+						Available: 2,
+					},
+				},
+			},
+		},
+		"pending admission checks": {
+			cq: "foo",
+			wl: pendingChecks,
+			want: &AdmissionTrace{
+				ClusterQueue: "foo",
+				Workload:     "ns/wl",
+				Steps: []TraceStep{
+					{Check: TraceCheckActive, Passed: true},
+					{Check: TraceCheckNamespace, Passed: true},
+					{Check: TraceCheckFlavorCoverage, Passed: true, Flavor: "default", Resource: corev1.ResourceCPU},
+					{
+						Check:     TraceCheckQuota,
+						Passed:    true,
+						Flavor:    "default",
+						Resource:  corev1.ResourceCPU,
+						Requested: 4_000,
+						Available: 10_000,
+					},
+					{Check: TraceCheckAdmissionChecks},
+				},
+			},
+		},
+		"flavor not covered": {
+			cq: "foo",
+			wl: utiltesting.MakeWorkload("wl", "ns").
+				Request(corev1.ResourceCPU, "4").
+				Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "spot", "4").Obj()).
+				Obj(),
+			want: &AdmissionTrace{
+				ClusterQueue: "foo",
+				Workload:     "ns/wl",
+				Steps: []TraceStep{
+					{Check: TraceCheckActive, Passed: true},
+					{Check: TraceCheckNamespace, Passed: true},
+					{Check: TraceCheckFlavorCoverage, Flavor: "spot", Resource: corev1.ResourceCPU},
+				},
+			},
+		},
+		"namespace not found": {
+			cq: "foo",
+			wl: utiltesting.MakeWorkload("wl", "missing").
+				Request(corev1.ResourceCPU, "4").
+				Admit(utiltesting.MakeAdmission("foo").Assignment(corev1.ResourceCPU, "default", "4").Obj()).
+				Obj(),
+			want: &AdmissionTrace{
+				ClusterQueue: "foo",
+				Workload:     "missing/wl",
+				Steps: []TraceStep{
+					{Check: TraceCheckActive, Passed: true},
+					{Check: TraceCheckNamespace},
+					{Check: TraceCheckFlavorCoverage, Passed: true, Flavor: "default", Resource: corev1.ResourceCPU},
+					{
+						Check:     TraceCheckQuota,
+						Passed:    true,
+						Flavor:    "default",
+						Resource:  corev1.ResourceCPU,
+						Requested: 4_000,
+						Available: 10_000,
+					},
+				},
+			},
+		},
+		"unknown clusterQueue": {
+			cq:        "bar",
+			wl:        utiltesting.MakeWorkload("wl", "ns").Obj(),
+			wantError: errCqNotFound.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient(ns), WithResourceAliases(map[corev1.ResourceName]corev1.ResourceName{
+				"nvidia.com/gpu": "example.com/gpu",
+			}))
+			cache.AddOrUpdateResourceFlavor(utiltesting.MakeResourceFlavor("default").Obj())
+			for _, cq := range []*kueue.ClusterQueue{cq, limited} {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			if tc.headroom > 0 {
+				if err := cache.SetHeadroom(tc.cq, "default", corev1.ResourceCPU, tc.headroom); err != nil {
+					t.Fatalf("Setting headroom: %v", err)
+				}
+			}
+			for _, wl := range tc.admitted {
+				if !cache.AddOrUpdateWorkload(wl) {
+					t.Fatalf("Workload %s was not added", wl.Name)
+				}
+			}
+			got, err := cache.TraceAdmission(tc.wl, tc.cq)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(err)); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreFields(TraceStep{}, "Message")); diff != "" {
+				t.Errorf("Unexpected trace (-want,+got):\n%s", diff)
+			}
+			// CanFit checks neither the admission checks nor the namespace.
+			if err == nil && len(admissionCheckStates(tc.wl)) == 0 && tc.wl.Namespace == ns.Name {
+				fits, _ := cache.CanFit(tc.cq, workload.NewInfo(tc.wl))
+				if fits != got.Admissible {
+					t.Errorf("Trace is admissible=%t, inconsistent with CanFit() = %t", got.Admissible, fits)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Verify checks the invariants of the cache and returns an error describing
+// every violation found, or nil if the cache is consistent:
+//   - the ResourceGroups indexed by resource belong to their ClusterQueue,
+//   - the ClusterQueues of the assumed workloads exist,
+//   - the ClusterQueues and their cohorts reference each other,
+//   - the usage of each ClusterQueue covers the resources in its flavors and
+//     only keeps other resources while its workloads use them.
+func (c *Cache) Verify() error {
+	c.RLock()
+	defer c.RUnlock()
+
+	var errs []error
+	for _, name := range sortedKeys(c.clusterQueues) {
+		errs = append(errs, c.clusterQueues[name].verify(c.cohorts)...)
+	}
+	for _, key := range sortedKeys(c.assumedWorkloads) {
+		cqName := c.assumedWorkloads[key]
+		if _, ok := c.clusterQueues[cqName]; !ok {
+			errs = append(errs, fmt.Errorf("assumed workload %s is in unknown ClusterQueue %s", key, cqName))
+		}
+	}
+	for _, name := range sortedKeys(c.cohorts) {
+		cohort := c.cohorts[name]
+		for cq := range cohort.Members {
+			if cq.Cohort != cohort {
+				errs = append(errs, fmt.Errorf("ClusterQueue %s is a member of cohort %s but doesn't reference it", cq.Name, name))
+			}
+			if c.clusterQueues[cq.Name] != cq {
+				errs = append(errs, fmt.Errorf("cohort %s has unknown member %s", name, cq.Name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *ClusterQueue) verify(cohorts map[string]*Cohort) []error {
+	var errs []error
+	for _, rName := range sortedKeys(c.RGByResource) {
+		rg := c.RGByResource[rName]
+		found := false
+		for i := range c.ResourceGroups {
+			if rg == &c.ResourceGroups[i] {
+				found = rg.CoveredResources.Has(rName)
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("ClusterQueue %s indexes resource %s to a ResourceGroup that doesn't cover it", c.Name, rName))
+		}
+	}
+	if c.Cohort != nil {
+		if cohorts[c.Cohort.Name] != c.Cohort || !c.Cohort.Members.Has(c) {
+			errs = append(errs, fmt.Errorf("ClusterQueue %s is not a member of its cohort %s", c.Name, c.Cohort.Name))
+		}
+	}
+
+	inUse := make(FlavorResourceQuantities)
+	for _, rg := range c.ResourceGroups {
+		for _, flvQuotas := range rg.Flavors {
+			for rName := range flvQuotas.Resources {
+				if _, ok := c.Usage[flvQuotas.Name][rName]; !ok {
+					errs = append(errs, fmt.Errorf("ClusterQueue %s has no usage for %s in flavor %s", c.Name, rName, flvQuotas.Name))
+				}
+				addQuantity(inUse, flvQuotas.Name, rName, 0)
+			}
+		}
+	}
+	for _, wi := range c.Workloads {
+		for fName, resUsage := range workloadUsage(wi) {
+			for rName := range resUsage {
+				addQuantity(inUse, fName, rName, 0)
+			}
+		}
+	}
+	for _, fName := range sortedKeys(c.Usage) {
+		for _, rName := range sortedKeys(c.Usage[fName]) {
+			if _, ok := inUse[fName][rName]; !ok {
+				errs = append(errs, fmt.Errorf("ClusterQueue %s has usage for %s in flavor %s, which is neither in its spec nor used by its workloads", c.Name, rName, fName))
+			}
+		}
+	}
+	return errs
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
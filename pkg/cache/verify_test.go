@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+
+	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
+	utiltesting "sigs.k8s.io/kueue/pkg/util/testing"
+)
+
+func TestVerify(t *testing.T) {
+	clusterQueues := []*kueue.ClusterQueue{
+		utiltesting.MakeClusterQueue("a").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("model_a").Resource("example.com/gpu", "5").Obj()).
+			Cohort("one").
+			Obj(),
+		utiltesting.MakeClusterQueue("b").
+			ResourceGroup(*utiltesting.MakeFlavorQuotas("default").Resource(corev1.ResourceCPU, "10").Obj()).
+			Cohort("one").
+			Obj(),
+	}
+	wl := utiltesting.MakeWorkload("wl", "ns").
+		Request(corev1.ResourceCPU, "2").
+		Admit(utiltesting.MakeAdmission("a").Assignment(corev1.ResourceCPU, "default", "2").Obj()).
+		Obj()
+
+	cases := map[string]struct {
+		corrupt   func(*Cache)
+		wantError string
+	}{
+		"consistent": {
+			corrupt: func(*Cache) {},
+		},
+		"resource indexed to a foreign ResourceGroup": {
+			corrupt: func(c *Cache) {
+				c.clusterQueues["a"].RGByResource[corev1.ResourceCPU] = &c.clusterQueues["b"].ResourceGroups[0]
+			},
+			wantError: "ClusterQueue a indexes resource cpu to a ResourceGroup that doesn't cover it",
+		},
+		"resource indexed to a ResourceGroup that doesn't cover it": {
+			corrupt: func(c *Cache) {
+				cq := c.clusterQueues["a"]
+				cq.RGByResource[corev1.ResourceCPU] = &cq.ResourceGroups[1]
+			},
+			wantError: "ClusterQueue a indexes resource cpu to a ResourceGroup that doesn't cover it",
+		},
+		"assumed workload in unknown ClusterQueue": {
+			corrupt: func(c *Cache) {
+				c.assumedWorkloads["ns/other"] = "c"
+			},
+			wantError: "assumed workload ns/other is in unknown ClusterQueue c",
+		},
+		"member doesn't reference its cohort": {
+			corrupt: func(c *Cache) {
+				c.clusterQueues["b"].Cohort = nil
+			},
+			wantError: "ClusterQueue b is a member of cohort one but doesn't reference it",
+		},
+		"ClusterQueue not in the members of its cohort": {
+			corrupt: func(c *Cache) {
+				cq := c.clusterQueues["b"]
+				cq.Cohort.Members.Delete(cq)
+			},
+			wantError: "ClusterQueue b is not a member of its cohort one",
+		},
+		"missing usage": {
+			corrupt: func(c *Cache) {
+				delete(c.clusterQueues["a"].Usage, "model_a")
+			},
+			wantError: "ClusterQueue a has no usage for example.com/gpu in flavor model_a",
+		},
+		"usage for a flavor not in the spec": {
+			corrupt: func(c *Cache) {
+				c.clusterQueues["b"].Usage["spot"] = map[corev1.ResourceName]int64{corev1.ResourceCPU: 0}
+			},
+			wantError: "ClusterQueue b has usage for cpu in flavor spot, which is neither in its spec nor used by its workloads",
+		},
+		"multiple violations": {
+			corrupt: func(c *Cache) {
+				c.clusterQueues["b"].Cohort = nil
+				c.assumedWorkloads["ns/other"] = "c"
+			},
+			wantError: "assumed workload ns/other is in unknown ClusterQueue c\n" +
+				"ClusterQueue b is a member of cohort one but doesn't reference it",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := New(utiltesting.NewFakeClient())
+			for _, cq := range clusterQueues {
+				if err := cache.AddClusterQueue(context.Background(), cq); err != nil {
+					t.Fatalf("Adding ClusterQueue: %v", err)
+				}
+			}
+			if !cache.AddOrUpdateWorkload(wl) {
+				t.Fatal("Failed adding workload")
+			}
+			tc.corrupt(cache)
+			if diff := cmp.Diff(tc.wantError, messageOrEmpty(cache.Verify())); diff != "" {
+				t.Errorf("Unexpected error (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -230,7 +230,7 @@ func (r *ClusterQueueReconciler) Update(e event.UpdateEvent) bool {
 	}
 	defer r.notifyWatchers(oldCq, newCq)
 
-	if err := r.cache.UpdateClusterQueue(newCq); err != nil {
+	if _, err := r.cache.UpdateClusterQueue(newCq); err != nil {
 		log.Error(err, "Failed to update clusterQueue in cache")
 	}
 	if err := r.qManager.UpdateClusterQueue(context.Background(), newCq); err != nil {
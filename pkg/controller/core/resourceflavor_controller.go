@@ -127,11 +127,11 @@ func (r *ResourceFlavorReconciler) Create(e event.CreateEvent) bool {
 	log := r.log.WithValues("resourceFlavor", klog.KObj(flv))
 	log.V(2).Info("ResourceFlavor create event")
 
-	// As long as one clusterQueue becomes active,
+	// As long as one clusterQueue becomes active or its label keys change,
 	// we should inform clusterQueue controller to broadcast the event.
-	if cqNames := r.cache.AddOrUpdateResourceFlavor(flv.DeepCopy()); len(cqNames) > 0 {
+	if _, cqNames := r.cache.AddOrUpdateResourceFlavor(flv.DeepCopy()); len(cqNames) > 0 {
 		r.qManager.QueueInadmissibleWorkloads(context.Background(), cqNames)
-		// If at least one CQ becomes active, then those CQs should now get evaluated by the scheduler;
+		// If at least one CQ changes, then those CQs should now get evaluated by the scheduler;
 		// note that the workloads in those CQs are not necessarily "inadmissible", and hence we trigger a
 		// broadcast here in all cases.
 		r.qManager.Broadcast()
@@ -173,7 +173,7 @@ func (r *ResourceFlavorReconciler) Update(e event.UpdateEvent) bool {
 		return true
 	}
 
-	if cqNames := r.cache.AddOrUpdateResourceFlavor(newFlv.DeepCopy()); len(cqNames) > 0 {
+	if _, cqNames := r.cache.AddOrUpdateResourceFlavor(newFlv.DeepCopy()); len(cqNames) > 0 {
 		r.qManager.QueueInadmissibleWorkloads(context.Background(), cqNames)
 	}
 	return false
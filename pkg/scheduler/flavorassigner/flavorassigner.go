@@ -29,7 +29,6 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
-	"k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
 	"k8s.io/utils/pointer"
 
 	kueue "sigs.k8s.io/kueue/apis/kueue/v1beta1"
@@ -340,8 +339,11 @@ func (a *Assignment) findFlavorForResourceGroup(
 	bestAssignmentMode := NoFit
 
 	// We will only check against the flavors' labels for the resource.
-	selector := flavorSelector(spec, rg.LabelKeys)
-	for _, flvQuotas := range rg.Flavors {
+	selector := cache.FlavorSelector(spec, rg.LabelKeys)
+	// Whether a flavor other than the default ones matches the node labels.
+	// The default flavors are ordered last.
+	specificMatched := false
+	for _, flvQuotas := range rg.OrderedFlavors() {
 		flavor, exist := resourceFlavors[flvQuotas.Name]
 		if !exist {
 			log.Error(nil, "Flavor not found", "Flavor", flvQuotas.Name)
@@ -355,13 +357,23 @@ func (a *Assignment) findFlavorForResourceGroup(
 			status.append(fmt.Sprintf("untolerated taint %s in flavor %s", taint, flvQuotas.Name))
 			continue
 		}
-		if match, err := selector.Match(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: flavor.Spec.NodeLabels}}); !match || err != nil {
-			if err != nil {
-				status.err = err
-				return nil, status
+		// Default flavors admit the workloads that no other flavor matches,
+		// regardless of their node labels.
+		if flvQuotas.IsDefault {
+			if specificMatched {
+				status.append(fmt.Sprintf("default flavor %s is not used, another flavor matches node affinity", flvQuotas.Name))
+				continue
 			}
-			status.append(fmt.Sprintf("flavor %s doesn't match node affinity", flvQuotas.Name))
-			continue
+		} else {
+			if match, err := selector.Match(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: flavor.Spec.NodeLabels}}); !match || err != nil {
+				if err != nil {
+					status.err = err
+					return nil, status
+				}
+				status.append(fmt.Sprintf("flavor %s doesn't match node affinity", flvQuotas.Name))
+				continue
+			}
+			specificMatched = true
 		}
 
 		assignments := make(ResourceAssignment, len(requests))
@@ -401,52 +413,6 @@ func (a *Assignment) findFlavorForResourceGroup(
 	return bestAssignment, status
 }
 
-func flavorSelector(spec *corev1.PodSpec, allowedKeys sets.Set[string]) nodeaffinity.RequiredNodeAffinity {
-	// This function generally replicates the implementation of kube-scheduler's NodeAffintiy
-	// Filter plugin as of v1.24.
-	var specCopy corev1.PodSpec
-
-	// Remove affinity constraints with irrelevant keys.
-	if len(spec.NodeSelector) != 0 {
-		specCopy.NodeSelector = map[string]string{}
-		for k, v := range spec.NodeSelector {
-			if allowedKeys.Has(k) {
-				specCopy.NodeSelector[k] = v
-			}
-		}
-	}
-
-	affinity := spec.Affinity
-	if affinity != nil && affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
-		var termsCopy []corev1.NodeSelectorTerm
-		for _, t := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
-			var expCopy []corev1.NodeSelectorRequirement
-			for _, e := range t.MatchExpressions {
-				if allowedKeys.Has(e.Key) {
-					expCopy = append(expCopy, e)
-				}
-			}
-			// If a term becomes empty, it means node affinity matches any flavor since those terms are ORed,
-			// and so matching gets reduced to spec.NodeSelector
-			if len(expCopy) == 0 {
-				termsCopy = nil
-				break
-			}
-			termsCopy = append(termsCopy, corev1.NodeSelectorTerm{MatchExpressions: expCopy})
-		}
-		if len(termsCopy) != 0 {
-			specCopy.Affinity = &corev1.Affinity{
-				NodeAffinity: &corev1.NodeAffinity{
-					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
-						NodeSelectorTerms: termsCopy,
-					},
-				},
-			}
-		}
-	}
-	return nodeaffinity.GetRequiredNodeAffinity(&corev1.Pod{Spec: specCopy})
-}
-
 // fitsResourceQuota returns how this flavor could be assigned to the resource,
 // according to the remaining quota in the ClusterQueue and cohort.
 // If it fits, also returns any borrowing required.
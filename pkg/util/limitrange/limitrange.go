@@ -100,6 +100,33 @@ func TotalRequests(ps *corev1.PodSpec) corev1.ResourceList {
 	return total
 }
 
+// TotalLimits computes the total resource limits of a pod, taking the
+// requests of the containers that don't set a limit for a resource.
+// total = sum(max(sum(.containers[].limits), initContainers[].limits), overhead)
+func TotalLimits(ps *corev1.PodSpec) corev1.ResourceList {
+	total := corev1.ResourceList{}
+
+	// add the resource from the main containers
+	for i := range ps.Containers {
+		total = resource.MergeResourceListKeepSum(total, containerLimits(&ps.Containers[i]))
+	}
+
+	// take into account the maximum of any init containers
+	for i := range ps.InitContainers {
+		total = resource.MergeResourceListKeepMax(total, containerLimits(&ps.InitContainers[i]))
+	}
+
+	// add the overhead
+	total = resource.MergeResourceListKeepSum(total, ps.Overhead)
+	return total
+}
+
+// containerLimits returns the limits of the container, completed with the
+// requests of the resources without a limit.
+func containerLimits(c *corev1.Container) corev1.ResourceList {
+	return resource.MergeResourceListKeepFirst(c.Resources.Limits, c.Resources.Requests)
+}
+
 // ValidatePodSpec verifies if the provided podSpec (ps) first into the boundaries of the summary (s).
 func (s Summary) ValidatePodSpec(ps *corev1.PodSpec, path *field.Path) []string {
 	reasons := []string{}
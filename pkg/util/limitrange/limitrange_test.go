@@ -246,6 +246,86 @@ func TestTotalRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestTotalLimits(t *testing.T) {
+	containers := []corev1.Container{
+		{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1"),
+					corev1.ResourceMemory: resource.MustParse("1Gi"),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("2"),
+				},
+			},
+		},
+		{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("500m"),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1"),
+					corev1.ResourceMemory: resource.MustParse("2Gi"),
+				},
+			},
+		},
+		{
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("4"),
+				},
+			},
+		},
+	}
+	cases := map[string]struct {
+		podSpec *corev1.PodSpec
+		want    corev1.ResourceList
+	}{
+		"sum up main containers, falling back to requests": {
+			podSpec: &corev1.PodSpec{
+				Containers: containers[:2],
+			},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("3"),
+				corev1.ResourceMemory: resource.MustParse("3Gi"),
+			},
+		},
+		"one init wants more": {
+			podSpec: &corev1.PodSpec{
+				InitContainers: containers[2:],
+				Containers:     containers[:2],
+			},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("3Gi"),
+			},
+		},
+		"adds overhead": {
+			podSpec: &corev1.PodSpec{
+				Containers: containers[:2],
+				Overhead: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("1"),
+				},
+			},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("3Gi"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			result := TotalLimits(tc.podSpec)
+			if diff := cmp.Diff(tc.want, result); diff != "" {
+				t.Errorf("Unexpected result (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestValidatePodSpec(t *testing.T) {
 	podSpec := &corev1.PodSpec{
 		Containers: []corev1.Container{
@@ -82,6 +82,25 @@ func NewInfo(w *kueue.Workload) *Info {
 	return info
 }
 
+// DeepCopy returns a copy of the Info that doesn't share the workload object
+// nor the podset resources with the original.
+func (i *Info) DeepCopy() *Info {
+	out := &Info{
+		Obj:           i.Obj.DeepCopy(),
+		TotalRequests: make([]PodSetResources, len(i.TotalRequests)),
+		ClusterQueue:  i.ClusterQueue,
+	}
+	for j, psr := range i.TotalRequests {
+		out.TotalRequests[j] = PodSetResources{
+			Name:     psr.Name,
+			Requests: maps.Clone(psr.Requests),
+			Count:    psr.Count,
+			Flavors:  maps.Clone(psr.Flavors),
+		}
+	}
+	return out
+}
+
 func (i *Info) Update(wl *kueue.Workload) {
 	i.Obj = wl
 }